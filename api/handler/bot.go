@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormCreateBot struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	Name      string `form:"name" json:"name" binding:"required"`
+}
+
+// 建一个机器人账号，建的人就是主人
+func CreateBot(c *gin.Context) {
+	var formCreateBot FormCreateBot
+	if err := c.ShouldBindBodyWith(&formCreateBot, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.CreateBotRequest{
+		AuthToken: formCreateBot.AuthToken,
+		Name:      formCreateBot.Name,
+	}
+	code, bot, msg := rpc.RpcLogicObj.CreateBot(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", bot)
+}
+
+type FormListBots struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+}
+
+// 我建的机器人
+func ListBots(c *gin.Context) {
+	var formListBots FormListBots
+	if err := c.ShouldBindBodyWith(&formListBots, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	code, bots, msg := rpc.RpcLogicObj.ListBots(&proto.ListBotsRequest{AuthToken: formListBots.AuthToken})
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", bots)
+}
+
+type FormCreateApiKey struct {
+	AuthToken  string   `form:"authToken" json:"authToken" binding:"required"`
+	BotUserId  int      `form:"botUserId" json:"botUserId" binding:"required"`
+	Name       string   `form:"name" json:"name"`
+	Scopes     []string `form:"scopes" json:"scopes" binding:"required"`
+	Rooms      []int    `form:"rooms" json:"rooms" binding:"required"`
+	ExpireDays int      `form:"expireDays" json:"expireDays"`
+}
+
+// 给机器人发 key，明文只在这里返回一次
+func CreateApiKey(c *gin.Context) {
+	var formCreateApiKey FormCreateApiKey
+	if err := c.ShouldBindBodyWith(&formCreateApiKey, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.CreateApiKeyRequest{
+		AuthToken:  formCreateApiKey.AuthToken,
+		BotUserId:  formCreateApiKey.BotUserId,
+		Name:       formCreateApiKey.Name,
+		Scopes:     formCreateApiKey.Scopes,
+		Rooms:      formCreateApiKey.Rooms,
+		ExpireDays: formCreateApiKey.ExpireDays,
+	}
+	code, reply, msg := rpc.RpcLogicObj.CreateApiKey(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{
+		"apiKey": reply.ApiKey,
+		"key":    reply.Key,
+	})
+}
+
+type FormListApiKeys struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	BotUserId int    `form:"botUserId" json:"botUserId" binding:"required"`
+}
+
+func ListApiKeys(c *gin.Context) {
+	var formListApiKeys FormListApiKeys
+	if err := c.ShouldBindBodyWith(&formListApiKeys, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListApiKeysRequest{
+		AuthToken: formListApiKeys.AuthToken,
+		BotUserId: formListApiKeys.BotUserId,
+	}
+	code, keys, msg := rpc.RpcLogicObj.ListApiKeys(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", keys)
+}
+
+type FormRevokeApiKey struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	KeyId     int    `form:"keyId" json:"keyId" binding:"required"`
+}
+
+func RevokeApiKey(c *gin.Context) {
+	var formRevokeApiKey FormRevokeApiKey
+	if err := c.ShouldBindBodyWith(&formRevokeApiKey, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RevokeApiKeyRequest{
+		AuthToken: formRevokeApiKey.AuthToken,
+		KeyId:     formRevokeApiKey.KeyId,
+	}
+	code, msg := rpc.RpcLogicObj.RevokeApiKey(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "revoke ok!", nil)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormListConversations struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	Limit     int    `form:"limit" json:"limit"` // 默认 100，最大 500
+}
+
+// 私信会话列表，最近有消息的在前，带最后一条消息
+func ListConversations(c *gin.Context) {
+	var form FormListConversations
+	if err := c.ShouldBindBodyWith(&form, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListConversationsRequest{AuthToken: form.AuthToken, Limit: form.Limit}
+	code, list, msg := rpc.RpcLogicObj.ListConversations(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", list)
+}
+
+type FormDirectHistory struct {
+	AuthToken      string `form:"authToken" json:"authToken" binding:"required"`
+	ConversationId int64  `form:"conversationId" json:"conversationId"` // 和 peerUserId 二选一
+	PeerUserId     int    `form:"peerUserId" json:"peerUserId"`
+	BeforeId       int64  `form:"beforeId" json:"beforeId"` // 翻页：上一页第一条的 id
+	Limit          int    `form:"limit" json:"limit"`       // 默认 100，最大 500
+}
+
+// 私信历史，正序返回
+func ListDirectHistory(c *gin.Context) {
+	var form FormDirectHistory
+	if err := c.ShouldBindBodyWith(&form, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListDirectMessagesRequest{
+		AuthToken:      form.AuthToken,
+		ConversationId: form.ConversationId,
+		PeerUserId:     form.PeerUserId,
+		BeforeId:       form.BeforeId,
+		Limit:          form.Limit,
+	}
+	code, conversationId, list, msg := rpc.RpcLogicObj.ListDirectMessages(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{
+		"conversationId": conversationId,
+		"messages":       list,
+	})
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type FormRoomHistory struct {
-	AuthToken string `json:"authToken" binding:"required"`
+	AuthToken string `json:"authToken"` // 机器人用 X-Api-Key 时不传
 	RoomId    int    `json:"roomId" binding:"required"`
 	Limit     int    `json:"limit"` // 默认 100，最大 500
 	// 可选分页：BeforeId *int `json:"beforeId"`
@@ -23,16 +23,15 @@ func ListRoomHistory(c *gin.Context) {
 		return
 	}
 
-	// 会话已在中间件校验，这里可不必再校验；如需拿到用户名可再次调用：
-	// code, userId, _ := rpc.RpcLogicObj.CheckAuth(&proto.CheckAuthRequest{AuthToken: form.AuthToken})
-	// if code == tools.CodeFail { tools.FailWithMsg(c, "auth fail"); return }
+	// 会话或者 api key 已在中间件校验，身份在上下文里
 
 	if form.Limit <= 0 || form.Limit > 500 {
 		form.Limit = 100
 	}
 
-	// 调 logic 拉历史
-	req := &proto.ListMessagesRequest{RoomId: form.RoomId, Limit: form.Limit}
+	// 调 logic 拉历史，带上是谁在读，logic 按房间权限检查
+	userId, _, _ := currentUser(c)
+	req := &proto.ListMessagesRequest{UserId: userId, RoomId: form.RoomId, Limit: form.Limit}
 	code, list, msg := rpc.RpcLogicObj.ListRoomMessages(req)
 	if code == tools.CodeFail {
 		tools.FailWithMsg(c, msg)
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 中间件认证通过以后把调用者身份放进 gin 上下文，handler 里直接拿，不用再 rpc 一次 CheckAuth
+
+const (
+	ctxUserId   = "gochat.userId"
+	ctxUserName = "gochat.userName"
+	ctxIsBot    = "gochat.isBot"
+)
+
+func SetCurrentUser(c *gin.Context, userId int, userName string, isBot bool) {
+	c.Set(ctxUserId, userId)
+	c.Set(ctxUserName, userName)
+	c.Set(ctxIsBot, isBot)
+}
+
+func currentUser(c *gin.Context) (userId int, userName string, isBot bool) {
+	userId = c.GetInt(ctxUserId)
+	userName = c.GetString(ctxUserName)
+	isBot = c.GetBool(ctxIsBot)
+	return
+}
@@ -15,11 +15,10 @@ import (
 	"strconv"
 )
 
-// 单聊消息推送
+// 单聊消息推送，私信不属于任何房间，不用传 roomId
 type FormPush struct {
 	Msg       string `form:"msg" json:"msg" binding:"required"`
 	ToUserId  string `form:"toUserId" json:"toUserId" binding:"required"`
-	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
 	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
 }
 
@@ -59,7 +58,6 @@ func Push(c *gin.Context) {
 		tools.FailWithMsg(c, "rpc fail get self info")
 		return
 	}
-	roomId := formPush.RoomId
 
 	// 构造推送请求
 	req := &proto.Send{
@@ -68,22 +66,24 @@ func Push(c *gin.Context) {
 		FromUserName: fromUserName,
 		ToUserId:     toUserIdInt,
 		ToUserName:   toUserName,
-		RoomId:       roomId,
 		Op:           config.OpSingleSend,
 	}
 	// 调用logic层 把信息发到消息队列中，此处已经和代码逻辑中断了，因为用到了中间件，而task自己也是从中间件消费消息
-	code, rpcMsg := rpc.RpcLogicObj.Push(req)
+	code, conversationId, messageId, rpcMsg := rpc.RpcLogicObj.Push(req)
 	if code == tools.CodeFail {
 		tools.FailWithMsg(c, rpcMsg)
 		return
 	}
-	tools.SuccessWithMsg(c, "ok", nil)
+	tools.SuccessWithMsg(c, "ok", gin.H{
+		"conversationId": conversationId,
+		"messageId":      messageId,
+	})
 	return
 }
 
-// 群聊消息
+// 群聊消息，机器人用 X-Api-Key 发的时候没有 authToken
 type FormRoom struct {
-	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	AuthToken string `form:"authToken" json:"authToken"`
 	Msg       string `form:"msg" json:"msg" binding:"required"`
 	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
 }
@@ -98,14 +98,12 @@ func PushRoom(c *gin.Context) {
 		tools.FailWithMsg(c, err.Error())
 		return
 	}
-	authToken := formRoom.AuthToken
 	msg := formRoom.Msg
 	roomId := formRoom.RoomId
 
-	// 检查认证
-	checkAuthReq := &proto.CheckAuthRequest{AuthToken: authToken}
-	authCode, fromUserId, fromUserName := rpc.RpcLogicObj.CheckAuth(checkAuthReq)
-	if authCode == tools.CodeFail {
+	// 中间件已经认证过（会话或者 api key），直接拿身份
+	fromUserId, fromUserName, _ := currentUser(c)
+	if fromUserId <= 0 {
 		tools.FailWithMsg(c, "rpc fail get self info")
 		return
 	}
@@ -118,7 +116,14 @@ func PushRoom(c *gin.Context) {
 	}
 
 	// 发队列
-	code, msg := rpc.RpcLogicObj.PushRoom(req)
+	code, retryAfter, msg := rpc.RpcLogicObj.PushRoom(req)
+	// 慢速模式或者发得太快，告诉客户端多久以后再试
+	if code == config.RateLimitedCode {
+		tools.ResponseWithCode(c, tools.CodeTooManyRequests, msg, gin.H{
+			"retryAfter": retryAfter,
+		})
+		return
+	}
 	if code == tools.CodeFail {
 		tools.FailWithMsg(c, "rpc push room msg fail!")
 		return
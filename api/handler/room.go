@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormRoomPermissions struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+}
+
+// 当前用户在房间里的角色和能做的操作
+func GetRoomPermissions(c *gin.Context) {
+	var formRoomPermissions FormRoomPermissions
+	if err := c.ShouldBindBodyWith(&formRoomPermissions, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetRoomPermissionsRequest{
+		AuthToken: formRoomPermissions.AuthToken,
+		RoomId:    formRoomPermissions.RoomId,
+	}
+	code, permissions, msg := rpc.RpcLogicObj.GetRoomPermissions(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", permissions)
+}
+
+type FormSetRoomRole struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	UserId    int    `form:"userId" json:"userId" binding:"required"`
+	Role      string `form:"role" json:"role"` // owner/moderator/member/guest，空表示恢复默认
+}
+
+// 设置某人在房间里的角色
+func SetRoomRole(c *gin.Context) {
+	var formSetRoomRole FormSetRoomRole
+	if err := c.ShouldBindBodyWith(&formSetRoomRole, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomRoleRequest{
+		AuthToken: formSetRoomRole.AuthToken,
+		RoomId:    formSetRoomRole.RoomId,
+		UserId:    formSetRoomRole.UserId,
+		Role:      formSetRoomRole.Role,
+	}
+	code, msg := rpc.RpcLogicObj.SetRoomRole(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormCreateRoom struct {
+	AuthToken   string `form:"authToken" json:"authToken" binding:"required"`
+	SpaceId     int    `form:"spaceId" json:"spaceId"` // 建在空间里，要求是空间的 owner/admin
+	Name        string `form:"name" json:"name" binding:"required"`
+	Description string `form:"description" json:"description"`
+	Private     bool   `form:"private" json:"private"`
+}
+
+// 建房间，建的人就是房主
+func CreateRoom(c *gin.Context) {
+	var formCreateRoom FormCreateRoom
+	if err := c.ShouldBindBodyWith(&formCreateRoom, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.CreateRoomRequest{
+		AuthToken:   formCreateRoom.AuthToken,
+		SpaceId:     formCreateRoom.SpaceId,
+		Name:        formCreateRoom.Name,
+		Description: formCreateRoom.Description,
+		Private:     formCreateRoom.Private,
+	}
+	code, room, msg := rpc.RpcLogicObj.CreateRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
+
+type FormRoomId struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+}
+
+func GetRoom(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetRoomRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, room, msg := rpc.RpcLogicObj.GetRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
+
+type FormListRooms struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	SpaceId   int    `form:"spaceId" json:"spaceId"` // 只列这个空间里的房间
+	Sort      string `form:"sort" json:"sort"`       // online、members、name、newest
+	Cursor    string `form:"cursor" json:"cursor"`
+	Limit     int    `form:"limit" json:"limit"`
+}
+
+// 房间目录，带成员数和在线人数，nextCursor 为空表示没有下一页
+func ListRooms(c *gin.Context) {
+	var formListRooms FormListRooms
+	if err := c.ShouldBindBodyWith(&formListRooms, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListRoomsRequest{
+		AuthToken: formListRooms.AuthToken,
+		SpaceId:   formListRooms.SpaceId,
+		Sort:      formListRooms.Sort,
+		Cursor:    formListRooms.Cursor,
+		Limit:     formListRooms.Limit,
+	}
+	code, rooms, nextCursor, msg := rpc.RpcLogicObj.ListRooms(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{
+		"rooms":      rooms,
+		"nextCursor": nextCursor,
+	})
+}
+
+type FormSearchRooms struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	SpaceId   int    `form:"spaceId" json:"spaceId"`
+	Query     string `form:"query" json:"query" binding:"required"`
+	Sort      string `form:"sort" json:"sort"`
+	Cursor    string `form:"cursor" json:"cursor"`
+	Limit     int    `form:"limit" json:"limit"`
+}
+
+// 按名字、话题、简介搜房间，翻页和列表一样
+func SearchRooms(c *gin.Context) {
+	var formSearchRooms FormSearchRooms
+	if err := c.ShouldBindBodyWith(&formSearchRooms, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListRoomsRequest{
+		AuthToken: formSearchRooms.AuthToken,
+		SpaceId:   formSearchRooms.SpaceId,
+		Query:     formSearchRooms.Query,
+		Sort:      formSearchRooms.Sort,
+		Cursor:    formSearchRooms.Cursor,
+		Limit:     formSearchRooms.Limit,
+	}
+	code, rooms, nextCursor, msg := rpc.RpcLogicObj.SearchRooms(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{
+		"rooms":      rooms,
+		"nextCursor": nextCursor,
+	})
+}
+
+type FormRenameRoom struct {
+	AuthToken   string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId      int    `form:"roomId" json:"roomId" binding:"required"`
+	Name        string `form:"name" json:"name" binding:"required"`
+	Description string `form:"description" json:"description"`
+}
+
+// 改房间名和简介，房主或管理员
+func RenameRoom(c *gin.Context) {
+	var formRenameRoom FormRenameRoom
+	if err := c.ShouldBindBodyWith(&formRenameRoom, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RenameRoomRequest{
+		AuthToken:   formRenameRoom.AuthToken,
+		RoomId:      formRenameRoom.RoomId,
+		Name:        formRenameRoom.Name,
+		Description: formRenameRoom.Description,
+	}
+	code, room, msg := rpc.RpcLogicObj.RenameRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
+
+type FormArchiveRoom struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Archived  bool   `form:"archived" json:"archived"` // false 是取消归档
+}
+
+func ArchiveRoom(c *gin.Context) {
+	var formArchiveRoom FormArchiveRoom
+	if err := c.ShouldBindBodyWith(&formArchiveRoom, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ArchiveRoomRequest{
+		AuthToken: formArchiveRoom.AuthToken,
+		RoomId:    formArchiveRoom.RoomId,
+		Archived:  formArchiveRoom.Archived,
+	}
+	code, room, msg := rpc.RpcLogicObj.ArchiveRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
+
+func DeleteRoom(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.DeleteRoomRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, msg := rpc.RpcLogicObj.DeleteRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormSetRoomCapacity struct {
+	AuthToken      string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId         int    `form:"roomId" json:"roomId" binding:"required"`
+	MaxMembers     int    `form:"maxMembers" json:"maxMembers"`         // 0 不限
+	MaxOnline      int    `form:"maxOnline" json:"maxOnline"`           // 0 不限
+	OverflowPolicy string `form:"overflowPolicy" json:"overflowPolicy"` // reject 或 spectate
+}
+
+// 成员和在线人数上限，房主或管理员
+func SetRoomCapacity(c *gin.Context) {
+	var formSetRoomCapacity FormSetRoomCapacity
+	if err := c.ShouldBindBodyWith(&formSetRoomCapacity, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomCapacityRequest{
+		AuthToken:      formSetRoomCapacity.AuthToken,
+		RoomId:         formSetRoomCapacity.RoomId,
+		MaxMembers:     formSetRoomCapacity.MaxMembers,
+		MaxOnline:      formSetRoomCapacity.MaxOnline,
+		OverflowPolicy: formSetRoomCapacity.OverflowPolicy,
+	}
+	code, room, msg := rpc.RpcLogicObj.SetRoomCapacity(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
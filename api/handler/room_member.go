@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormSetRoomPrivate struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Private   bool   `form:"private" json:"private"`
+}
+
+// 公开/私有切换，房主或管理员
+func SetRoomPrivate(c *gin.Context) {
+	var formSetRoomPrivate FormSetRoomPrivate
+	if err := c.ShouldBindBodyWith(&formSetRoomPrivate, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomPrivateRequest{
+		AuthToken: formSetRoomPrivate.AuthToken,
+		RoomId:    formSetRoomPrivate.RoomId,
+		Private:   formSetRoomPrivate.Private,
+	}
+	code, room, msg := rpc.RpcLogicObj.SetRoomPrivate(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
+
+func ListRoomMembers(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListRoomMembersRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, members, msg := rpc.RpcLogicObj.ListRoomMembers(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", members)
+}
+
+type FormRoomMember struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	UserId    int    `form:"userId" json:"userId" binding:"required"`
+}
+
+// 移出成员，userId 是自己就是退出房间
+func RemoveRoomMember(c *gin.Context) {
+	var formRoomMember FormRoomMember
+	if err := c.ShouldBindBodyWith(&formRoomMember, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RoomMemberRequest{
+		AuthToken: formRoomMember.AuthToken,
+		RoomId:    formRoomMember.RoomId,
+		UserId:    formRoomMember.UserId,
+	}
+	code, msg := rpc.RpcLogicObj.RemoveRoomMember(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+func InviteRoomMember(c *gin.Context) {
+	var formRoomMember FormRoomMember
+	if err := c.ShouldBindBodyWith(&formRoomMember, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RoomMemberRequest{
+		AuthToken: formRoomMember.AuthToken,
+		RoomId:    formRoomMember.RoomId,
+		UserId:    formRoomMember.UserId,
+	}
+	code, msg := rpc.RpcLogicObj.InviteRoomMember(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormListRoomInvites struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+}
+
+func ListRoomInvites(c *gin.Context) {
+	var formListRoomInvites FormListRoomInvites
+	if err := c.ShouldBindBodyWith(&formListRoomInvites, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListRoomInvitesRequest{AuthToken: formListRoomInvites.AuthToken}
+	code, invites, msg := rpc.RpcLogicObj.ListRoomInvites(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", invites)
+}
+
+type FormRespondRoomInvite struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	InviteId  int    `form:"inviteId" json:"inviteId" binding:"required"`
+	Accept    bool   `form:"accept" json:"accept"`
+}
+
+func RespondRoomInvite(c *gin.Context) {
+	var formRespondRoomInvite FormRespondRoomInvite
+	if err := c.ShouldBindBodyWith(&formRespondRoomInvite, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RespondRoomInviteRequest{
+		AuthToken: formRespondRoomInvite.AuthToken,
+		InviteId:  formRespondRoomInvite.InviteId,
+		Accept:    formRespondRoomInvite.Accept,
+	}
+	code, msg := rpc.RpcLogicObj.RespondRoomInvite(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormRequestJoinRoom struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Message   string `form:"message" json:"message"`
+}
+
+// 申请加入私有房间
+func RequestJoinRoom(c *gin.Context) {
+	var formRequestJoinRoom FormRequestJoinRoom
+	if err := c.ShouldBindBodyWith(&formRequestJoinRoom, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RequestJoinRoomRequest{
+		AuthToken: formRequestJoinRoom.AuthToken,
+		RoomId:    formRequestJoinRoom.RoomId,
+		Message:   formRequestJoinRoom.Message,
+	}
+	code, msg := rpc.RpcLogicObj.RequestJoinRoom(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+func ListJoinRequests(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListJoinRequestsRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, requests, msg := rpc.RpcLogicObj.ListJoinRequests(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", requests)
+}
+
+type FormHandleJoinRequest struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RequestId int    `form:"requestId" json:"requestId" binding:"required"`
+	Approve   bool   `form:"approve" json:"approve"`
+}
+
+// 审批入群申请
+func HandleJoinRequest(c *gin.Context) {
+	var formHandleJoinRequest FormHandleJoinRequest
+	if err := c.ShouldBindBodyWith(&formHandleJoinRequest, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.HandleJoinRequestRequest{
+		AuthToken: formHandleJoinRequest.AuthToken,
+		RequestId: formHandleJoinRequest.RequestId,
+		Approve:   formHandleJoinRequest.Approve,
+	}
+	code, msg := rpc.RpcLogicObj.HandleJoinRequest(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormCreateInviteLink struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Ttl       int    `form:"ttl" json:"ttl"` // 秒，不填用默认有效期
+}
+
+// 生成邀请链接，token 只返回这一次
+func CreateInviteLink(c *gin.Context) {
+	var formCreateInviteLink FormCreateInviteLink
+	if err := c.ShouldBindBodyWith(&formCreateInviteLink, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.CreateInviteLinkRequest{
+		AuthToken: formCreateInviteLink.AuthToken,
+		RoomId:    formCreateInviteLink.RoomId,
+		Ttl:       formCreateInviteLink.Ttl,
+	}
+	code, token, expiresIn, msg := rpc.RpcLogicObj.CreateInviteLink(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{"token": token, "expiresIn": expiresIn})
+}
+
+type FormInviteLink struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	Token     string `form:"token" json:"token" binding:"required"`
+}
+
+func RevokeInviteLink(c *gin.Context) {
+	var formInviteLink FormInviteLink
+	if err := c.ShouldBindBodyWith(&formInviteLink, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.InviteLinkRequest{
+		AuthToken: formInviteLink.AuthToken,
+		Token:     formInviteLink.Token,
+	}
+	code, msg := rpc.RpcLogicObj.RevokeInviteLink(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+// 凭邀请链接加入
+func JoinByInviteLink(c *gin.Context) {
+	var formInviteLink FormInviteLink
+	if err := c.ShouldBindBodyWith(&formInviteLink, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.InviteLinkRequest{
+		AuthToken: formInviteLink.AuthToken,
+		Token:     formInviteLink.Token,
+	}
+	code, room, msg := rpc.RpcLogicObj.JoinByInviteLink(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
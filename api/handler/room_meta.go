@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+func GetRoomMeta(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetRoomPermissionsRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, meta, msg := rpc.RpcLogicObj.GetRoomMeta(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", meta)
+}
+
+type FormSetRoomTopic struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Topic     string `form:"topic" json:"topic"` // 空表示清掉
+}
+
+func SetRoomTopic(c *gin.Context) {
+	var formSetRoomTopic FormSetRoomTopic
+	if err := c.ShouldBindBodyWith(&formSetRoomTopic, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomTopicRequest{
+		AuthToken: formSetRoomTopic.AuthToken,
+		RoomId:    formSetRoomTopic.RoomId,
+		Topic:     formSetRoomTopic.Topic,
+	}
+	code, meta, msg := rpc.RpcLogicObj.SetRoomTopic(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", meta)
+}
+
+type FormSetRoomAnnouncement struct {
+	AuthToken    string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId       int    `form:"roomId" json:"roomId" binding:"required"`
+	Announcement string `form:"announcement" json:"announcement"` // 空表示清掉
+}
+
+func SetRoomAnnouncement(c *gin.Context) {
+	var formSetRoomAnnouncement FormSetRoomAnnouncement
+	if err := c.ShouldBindBodyWith(&formSetRoomAnnouncement, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomAnnouncementRequest{
+		AuthToken:    formSetRoomAnnouncement.AuthToken,
+		RoomId:       formSetRoomAnnouncement.RoomId,
+		Announcement: formSetRoomAnnouncement.Announcement,
+	}
+	code, meta, msg := rpc.RpcLogicObj.SetRoomAnnouncement(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", meta)
+}
+
+type FormRoomPin struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	MessageId int64  `form:"messageId" json:"messageId" binding:"required"` // chat_message.id，就是历史消息里的 id
+}
+
+// 置顶和取消置顶的表单一样
+func roomPin(c *gin.Context, call func(req *proto.RoomPinRequest) (int, proto.RoomMeta, string)) {
+	var formRoomPin FormRoomPin
+	if err := c.ShouldBindBodyWith(&formRoomPin, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RoomPinRequest{
+		AuthToken: formRoomPin.AuthToken,
+		RoomId:    formRoomPin.RoomId,
+		MessageId: formRoomPin.MessageId,
+	}
+	code, meta, msg := call(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", meta)
+}
+
+func PinRoomMessage(c *gin.Context) {
+	roomPin(c, rpc.RpcLogicObj.PinRoomMessage)
+}
+
+func UnpinRoomMessage(c *gin.Context) {
+	roomPin(c, rpc.RpcLogicObj.UnpinRoomMessage)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormModerateRoomUser struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	UserId    int    `form:"userId" json:"userId" binding:"required"`
+	Duration  int    `form:"duration" json:"duration"` // 秒，只有禁言用
+	Reason    string `form:"reason" json:"reason"`
+}
+
+// 禁言、解除禁言、踢出、封禁、解封的表单一样，只是调用的方法不同
+func moderateRoomUser(c *gin.Context, call func(req *proto.ModerateRoomUserRequest) (int, string)) {
+	var formModerate FormModerateRoomUser
+	if err := c.ShouldBindBodyWith(&formModerate, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ModerateRoomUserRequest{
+		AuthToken: formModerate.AuthToken,
+		RoomId:    formModerate.RoomId,
+		UserId:    formModerate.UserId,
+		Duration:  formModerate.Duration,
+		Reason:    formModerate.Reason,
+	}
+	code, msg := call(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+func MuteRoomUser(c *gin.Context) {
+	moderateRoomUser(c, rpc.RpcLogicObj.MuteRoomUser)
+}
+
+func UnmuteRoomUser(c *gin.Context) {
+	moderateRoomUser(c, rpc.RpcLogicObj.UnmuteRoomUser)
+}
+
+func KickRoomUser(c *gin.Context) {
+	moderateRoomUser(c, rpc.RpcLogicObj.KickRoomUser)
+}
+
+func BanRoomUser(c *gin.Context) {
+	moderateRoomUser(c, rpc.RpcLogicObj.BanRoomUser)
+}
+
+func UnbanRoomUser(c *gin.Context) {
+	moderateRoomUser(c, rpc.RpcLogicObj.UnbanRoomUser)
+}
+
+func ListRoomBans(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetRoomPermissionsRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, bans, msg := rpc.RpcLogicObj.ListRoomBans(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", bans)
+}
+
+type FormSetRoomSlowMode struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	Seconds   int    `form:"seconds" json:"seconds"` // 0 关闭慢速模式
+}
+
+func SetRoomSlowMode(c *gin.Context) {
+	var formSetRoomSlowMode FormSetRoomSlowMode
+	if err := c.ShouldBindBodyWith(&formSetRoomSlowMode, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetRoomSlowModeRequest{
+		AuthToken: formSetRoomSlowMode.AuthToken,
+		RoomId:    formSetRoomSlowMode.RoomId,
+		Seconds:   formSetRoomSlowMode.Seconds,
+	}
+	code, room, msg := rpc.RpcLogicObj.SetRoomSlowMode(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", room)
+}
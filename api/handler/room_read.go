@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormMarkRoomRead struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	RoomId    int    `form:"roomId" json:"roomId" binding:"required"`
+	MessageId int64  `form:"messageId" json:"messageId" binding:"required"`
+}
+
+// 标记读到房间里的某条消息，已经读到更新的不会往回退
+func MarkRoomRead(c *gin.Context) {
+	var formMarkRoomRead FormMarkRoomRead
+	if err := c.ShouldBindBodyWith(&formMarkRoomRead, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.MarkRoomReadRequest{
+		AuthToken: formMarkRoomRead.AuthToken,
+		RoomId:    formMarkRoomRead.RoomId,
+		MessageId: formMarkRoomRead.MessageId,
+	}
+	code, lastReadId, msg := rpc.RpcLogicObj.MarkRoomRead(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", gin.H{"roomId": formMarkRoomRead.RoomId, "lastReadId": lastReadId})
+}
+
+func ListRoomUnread(c *gin.Context) {
+	var formCheckAuth FormCheckAuth
+	if err := c.ShouldBindBodyWith(&formCheckAuth, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListRoomUnreadRequest{
+		AuthToken: formCheckAuth.AuthToken,
+	}
+	code, list, msg := rpc.RpcLogicObj.ListRoomUnread(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", list)
+}
+
+func ListRoomReads(c *gin.Context) {
+	var formRoomId FormRoomId
+	if err := c.ShouldBindBodyWith(&formRoomId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetRoomPermissionsRequest{
+		AuthToken: formRoomId.AuthToken,
+		RoomId:    formRoomId.RoomId,
+	}
+	code, list, msg := rpc.RpcLogicObj.ListRoomReads(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", list)
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gochat/api/rpc"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+type FormCreateSpace struct {
+	AuthToken   string `form:"authToken" json:"authToken" binding:"required"`
+	Name        string `form:"name" json:"name" binding:"required"`
+	Description string `form:"description" json:"description"`
+	Private     bool   `form:"private" json:"private"`
+}
+
+// 建空间，建的人就是空间 owner
+func CreateSpace(c *gin.Context) {
+	var formCreateSpace FormCreateSpace
+	if err := c.ShouldBindBodyWith(&formCreateSpace, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.CreateSpaceRequest{
+		AuthToken:   formCreateSpace.AuthToken,
+		Name:        formCreateSpace.Name,
+		Description: formCreateSpace.Description,
+		Private:     formCreateSpace.Private,
+	}
+	code, space, msg := rpc.RpcLogicObj.CreateSpace(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", space)
+}
+
+type FormSpaceId struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	SpaceId   int    `form:"spaceId" json:"spaceId" binding:"required"`
+}
+
+func GetSpace(c *gin.Context) {
+	var formSpaceId FormSpaceId
+	if err := c.ShouldBindBodyWith(&formSpaceId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SpaceRequest{
+		AuthToken: formSpaceId.AuthToken,
+		SpaceId:   formSpaceId.SpaceId,
+	}
+	code, space, msg := rpc.RpcLogicObj.GetSpace(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", space)
+}
+
+// 公开空间和自己加入的空间
+func ListSpaces(c *gin.Context) {
+	var formCheckAuth FormCheckAuth
+	if err := c.ShouldBindBodyWith(&formCheckAuth, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SpaceRequest{
+		AuthToken: formCheckAuth.AuthToken,
+	}
+	code, spaces, msg := rpc.RpcLogicObj.ListSpaces(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", spaces)
+}
+
+func ListSpaceMembers(c *gin.Context) {
+	var formSpaceId FormSpaceId
+	if err := c.ShouldBindBodyWith(&formSpaceId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SpaceRequest{
+		AuthToken: formSpaceId.AuthToken,
+		SpaceId:   formSpaceId.SpaceId,
+	}
+	code, members, msg := rpc.RpcLogicObj.ListSpaceMembers(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", members)
+}
+
+// 加入、退出、删除空间共用
+func spaceAction(c *gin.Context, call func(req *proto.SpaceRequest) (int, string)) {
+	var formSpaceId FormSpaceId
+	if err := c.ShouldBindBodyWith(&formSpaceId, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SpaceRequest{
+		AuthToken: formSpaceId.AuthToken,
+		SpaceId:   formSpaceId.SpaceId,
+	}
+	code, msg := call(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+func JoinSpace(c *gin.Context) {
+	spaceAction(c, rpc.RpcLogicObj.JoinSpace)
+}
+
+func LeaveSpace(c *gin.Context) {
+	spaceAction(c, rpc.RpcLogicObj.LeaveSpace)
+}
+
+func DeleteSpace(c *gin.Context) {
+	spaceAction(c, rpc.RpcLogicObj.DeleteSpace)
+}
+
+type FormSpaceMember struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	SpaceId   int    `form:"spaceId" json:"spaceId" binding:"required"`
+	UserId    int    `form:"userId" json:"userId" binding:"required"`
+	Role      string `form:"role" json:"role"` // 只有设角色用：admin 或 member
+}
+
+// 拉人、移出、设角色共用
+func spaceMemberAction(c *gin.Context, call func(req *proto.SpaceMemberRequest) (int, string)) {
+	var formSpaceMember FormSpaceMember
+	if err := c.ShouldBindBodyWith(&formSpaceMember, binding.JSON); err != nil {
+		tools.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SpaceMemberRequest{
+		AuthToken: formSpaceMember.AuthToken,
+		SpaceId:   formSpaceMember.SpaceId,
+		UserId:    formSpaceMember.UserId,
+		Role:      formSpaceMember.Role,
+	}
+	code, msg := call(req)
+	if code == tools.CodeFail {
+		tools.FailWithMsg(c, msg)
+		return
+	}
+	tools.SuccessWithMsg(c, "ok", nil)
+}
+
+func AddSpaceMember(c *gin.Context) {
+	spaceMemberAction(c, rpc.RpcLogicObj.AddSpaceMember)
+}
+
+func RemoveSpaceMember(c *gin.Context) {
+	spaceMemberAction(c, rpc.RpcLogicObj.RemoveSpaceMember)
+}
+
+func SetSpaceRole(c *gin.Context) {
+	spaceMemberAction(c, rpc.RpcLogicObj.SetSpaceRole)
+}
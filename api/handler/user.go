@@ -9,13 +9,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"gochat/api/rpc"
+	"gochat/config"
 	"gochat/internal/proto"
 	tools2 "gochat/internal/tools"
 )
 
 type FormLogin struct {
-	UserName string `form:"userName" json:"userName" binding:"required"`
-	Password string `form:"passWord" json:"passWord" binding:"required"`
+	UserName   string `form:"userName" json:"userName" binding:"required"`
+	Password   string `form:"passWord" json:"passWord" binding:"required"`
+	DeviceName string `form:"deviceName" json:"deviceName"`
 }
 
 // 登陆肯定需要用用户名和密码，这是不用思考的
@@ -27,20 +29,69 @@ func Login(c *gin.Context) {
 		return
 	}
 	req := &proto.LoginRequest{
-		Name:     formLogin.UserName,
-		Password: tools2.Sha1(formLogin.Password),
+		Name:       formLogin.UserName,
+		Password:   tools2.Sha1(formLogin.Password),
+		DeviceName: formLogin.DeviceName,
+		UserAgent:  c.Request.UserAgent(),
+		ClientIp:   c.ClientIP(),
+	}
+	code, reply, msg := rpc.RpcLogicObj.Login(req)
+	// 失败太多次被限制了，告诉客户端多久以后再试
+	if reply.RetryAfter > 0 {
+		tools2.ResponseWithCode(c, tools2.CodeTooManyRequests, "too many login attempts, please retry later", gin.H{
+			"retryAfter": reply.RetryAfter,
+		})
+		return
+	}
+	// 开了两步验证，密码对了也只给挑战 token，再调 /user/login/2fa
+	if code == tools2.CodeSuccess && reply.ChallengeToken != "" {
+		tools2.ResponseWithCode(c, tools2.CodeTwoFactorNeeded, "two factor code required", gin.H{
+			"challengeToken": reply.ChallengeToken,
+			"expiresIn":      reply.ChallengeExpiresIn,
+		})
+		return
+	}
+	if code == tools2.CodeFail || reply.AuthToken == "" {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "login success", authTokenData(reply.AuthToken, reply.RefreshToken, reply.ExpiresIn))
+}
+
+type FormLogin2fa struct {
+	ChallengeToken string `form:"challengeToken" json:"challengeToken" binding:"required"`
+	Code           string `form:"code" json:"code" binding:"required"`
+}
+
+// 登录第二步：挑战 token + 动态码（或恢复码）换 token
+func Login2fa(c *gin.Context) {
+	var formLogin2fa FormLogin2fa
+	if err := c.ShouldBindBodyWith(&formLogin2fa, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.Login2faRequest{
+		ChallengeToken: formLogin2fa.ChallengeToken,
+		Code:           formLogin2fa.Code,
+	}
+	code, reply, msg := rpc.RpcLogicObj.Login2fa(req)
+	if reply.RetryAfter > 0 {
+		tools2.ResponseWithCode(c, tools2.CodeTooManyRequests, "too many login attempts, please retry later", gin.H{
+			"retryAfter": reply.RetryAfter,
+		})
+		return
 	}
-	code, authToken, msg := rpc.RpcLogicObj.Login(req)
-	if code == tools2.CodeFail || authToken == "" {
+	if code == tools2.CodeFail || reply.AuthToken == "" {
 		tools2.FailWithMsg(c, msg)
 		return
 	}
-	tools2.SuccessWithMsg(c, "login success", authToken)
+	tools2.SuccessWithMsg(c, "login success", authTokenData(reply.AuthToken, reply.RefreshToken, reply.ExpiresIn))
 }
 
 type FormRegister struct {
-	UserName string `form:"userName" json:"userName" binding:"required"`
-	Password string `form:"passWord" json:"passWord" binding:"required"`
+	UserName   string `form:"userName" json:"userName" binding:"required"`
+	Password   string `form:"passWord" json:"passWord" binding:"required"`
+	DeviceName string `form:"deviceName" json:"deviceName"`
 }
 
 // 注册消息自然也需要用户名和密码
@@ -52,15 +103,55 @@ func Register(c *gin.Context) {
 		return
 	}
 	req := &proto.RegisterRequest{
-		Name:     formRegister.UserName,
-		Password: tools2.Sha1(formRegister.Password),
+		Name:       formRegister.UserName,
+		Password:   tools2.Sha1(formRegister.Password),
+		DeviceName: formRegister.DeviceName,
+		UserAgent:  c.Request.UserAgent(),
+		ClientIp:   c.ClientIP(),
+	}
+	code, reply, msg := rpc.RpcLogicObj.Register(req)
+	if code == tools2.CodeFail || reply.AuthToken == "" {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "register success", authTokenData(reply.AuthToken, reply.RefreshToken, reply.ExpiresIn))
+}
+
+// redis 会话模式还是只返回 token 字符串；签名 token 模式把 refresh token 一起返回
+func authTokenData(authToken string, refreshToken string, expiresIn int) interface{} {
+	if !config.Conf.Api.ApiAuth.IsTokenMode() {
+		return authToken
+	}
+	return map[string]interface{}{
+		"authToken":    authToken,
+		"refreshToken": refreshToken,
+		"expiresIn":    expiresIn,
+	}
+}
+
+type FormRefreshToken struct {
+	RefreshToken string `form:"refreshToken" json:"refreshToken" binding:"required"`
+	AuthToken    string `form:"authToken" json:"authToken"` // 当前的 access token，过期了也传
+}
+
+// 签名 token 模式下 access token 过期了，用 refresh token 换一对新的
+// refresh token 只能用一次，用完就换新的
+func RefreshToken(c *gin.Context) {
+	var formRefreshToken FormRefreshToken
+	if err := c.ShouldBindBodyWith(&formRefreshToken, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
 	}
-	code, authToken, msg := rpc.RpcLogicObj.Register(req)
-	if code == tools2.CodeFail || authToken == "" {
+	req := &proto.RefreshTokenRequest{
+		RefreshToken: formRefreshToken.RefreshToken,
+		AuthToken:    formRefreshToken.AuthToken,
+	}
+	code, reply, msg := rpc.RpcLogicObj.RefreshToken(req)
+	if code == tools2.CodeFail || reply.AuthToken == "" {
 		tools2.FailWithMsg(c, msg)
 		return
 	}
-	tools2.SuccessWithMsg(c, "register success", authToken)
+	tools2.SuccessWithMsg(c, "refresh success", authTokenData(reply.AuthToken, reply.RefreshToken, reply.ExpiresIn))
 }
 
 type FormCheckAuth struct {
@@ -113,3 +204,318 @@ func Logout(c *gin.Context) {
 	}
 	tools2.SuccessWithMsg(c, "logout ok!", nil)
 }
+
+type FormSessions struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+}
+
+// 当前用户所有登录设备，sessionId 用来踢设备，不是token
+func ListSessions(c *gin.Context) {
+	var formSessions FormSessions
+	if err := c.ShouldBindBodyWith(&formSessions, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ListSessionsRequest{AuthToken: formSessions.AuthToken}
+	code, sessions, msg := rpc.RpcLogicObj.ListSessions(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "ok", sessions)
+}
+
+type FormRevokeSession struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	SessionId string `form:"sessionId" json:"sessionId" binding:"required"`
+}
+
+// 踢掉某一个设备
+func RevokeSession(c *gin.Context) {
+	var formRevokeSession FormRevokeSession
+	if err := c.ShouldBindBodyWith(&formRevokeSession, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RevokeSessionRequest{
+		AuthToken: formRevokeSession.AuthToken,
+		SessionId: formRevokeSession.SessionId,
+	}
+	code, msg := rpc.RpcLogicObj.RevokeSession(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "revoke ok!", nil)
+}
+
+// 除了当前设备，其他设备全部下线
+func RevokeOtherSessions(c *gin.Context) {
+	var formSessions FormSessions
+	if err := c.ShouldBindBodyWith(&formSessions, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.RevokeOtherSessionsRequest{AuthToken: formSessions.AuthToken}
+	code, msg := rpc.RpcLogicObj.RevokeOtherSessions(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "revoke ok!", nil)
+}
+
+type Form2faSetup struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+}
+
+// 开始绑定两步验证，返回密钥和 otpauth 链接
+func Setup2fa(c *gin.Context) {
+	var form2faSetup Form2faSetup
+	if err := c.ShouldBindBodyWith(&form2faSetup, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.TwoFactorSetupRequest{AuthToken: form2faSetup.AuthToken}
+	code, reply, msg := rpc.RpcLogicObj.Setup2fa(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "ok", gin.H{
+		"secret": reply.Secret,
+		"uri":    reply.Uri,
+	})
+}
+
+type Form2faCode struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	Code      string `form:"code" json:"code" binding:"required"`
+}
+
+// 输入 app 上的动态码确认绑定，恢复码只返回这一次
+func Confirm2fa(c *gin.Context) {
+	var form2faCode Form2faCode
+	if err := c.ShouldBindBodyWith(&form2faCode, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.TwoFactorConfirmRequest{
+		AuthToken: form2faCode.AuthToken,
+		Code:      form2faCode.Code,
+	}
+	code, recoveryCodes, msg := rpc.RpcLogicObj.Confirm2fa(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "two factor enabled", gin.H{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// 关闭两步验证，要动态码或者恢复码
+func Disable2fa(c *gin.Context) {
+	var form2faCode Form2faCode
+	if err := c.ShouldBindBodyWith(&form2faCode, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.TwoFactorDisableRequest{
+		AuthToken: form2faCode.AuthToken,
+		Code:      form2faCode.Code,
+	}
+	code, msg := rpc.RpcLogicObj.Disable2fa(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "two factor disabled", nil)
+}
+
+type FormChangePassword struct {
+	AuthToken   string `form:"authToken" json:"authToken" binding:"required"`
+	OldPassword string `form:"oldPassWord" json:"oldPassWord" binding:"required"`
+	NewPassword string `form:"newPassWord" json:"newPassWord" binding:"required"`
+}
+
+// 改密码要旧密码，改完其他设备会被踢下线
+func ChangePassword(c *gin.Context) {
+	var formChangePassword FormChangePassword
+	if err := c.ShouldBindBodyWith(&formChangePassword, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ChangePasswordRequest{
+		AuthToken:   formChangePassword.AuthToken,
+		OldPassword: tools2.Sha1(formChangePassword.OldPassword),
+		NewPassword: tools2.Sha1(formChangePassword.NewPassword),
+	}
+	code, msg := rpc.RpcLogicObj.ChangePassword(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "password changed", nil)
+}
+
+type FormForgotPassword struct {
+	UserName string `form:"userName" json:"userName" binding:"required"`
+}
+
+// 忘记密码，发重置验证码；用户名存不存在都返回一样的结果
+func ForgotPassword(c *gin.Context) {
+	var formForgotPassword FormForgotPassword
+	if err := c.ShouldBindBodyWith(&formForgotPassword, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ForgotPasswordRequest{UserName: formForgotPassword.UserName}
+	code, msg := rpc.RpcLogicObj.ForgotPassword(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "if the account exists, a reset code has been sent", nil)
+}
+
+type FormResetPassword struct {
+	UserName    string `form:"userName" json:"userName" binding:"required"`
+	Code        string `form:"code" json:"code" binding:"required"`
+	NewPassword string `form:"newPassWord" json:"newPassWord" binding:"required"`
+}
+
+// 验证码重置密码，成功以后所有设备都要重新登录
+func ResetPassword(c *gin.Context) {
+	var formResetPassword FormResetPassword
+	if err := c.ShouldBindBodyWith(&formResetPassword, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.ResetPasswordRequest{
+		UserName:    formResetPassword.UserName,
+		Code:        formResetPassword.Code,
+		NewPassword: tools2.Sha1(formResetPassword.NewPassword),
+	}
+	code, msg := rpc.RpcLogicObj.ResetPassword(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "password reset, please login again", nil)
+}
+
+type FormGetProfile struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	UserId    int    `form:"userId" json:"userId"`
+}
+
+// 查用户资料，不传 userId 就是看自己的
+func GetProfile(c *gin.Context) {
+	var formGetProfile FormGetProfile
+	if err := c.ShouldBindBodyWith(&formGetProfile, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.GetProfileRequest{
+		AuthToken: formGetProfile.AuthToken,
+		UserId:    formGetProfile.UserId,
+	}
+	code, profile, msg := rpc.RpcLogicObj.GetProfile(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "ok", profile)
+}
+
+// 不传的字段不改，传空字符串是清空
+type FormUpdateProfile struct {
+	AuthToken   string  `form:"authToken" json:"authToken" binding:"required"`
+	DisplayName *string `form:"displayName" json:"displayName"`
+	AvatarUrl   *string `form:"avatarUrl" json:"avatarUrl"`
+	Bio         *string `form:"bio" json:"bio"`
+	StatusText  *string `form:"statusText" json:"statusText"`
+	Locale      *string `form:"locale" json:"locale"`
+	TimeZone    *string `form:"timeZone" json:"timeZone"`
+
+	HideReadReceipts *bool `form:"hideReadReceipts" json:"hideReadReceipts"`
+}
+
+// 修改自己的资料
+func UpdateProfile(c *gin.Context) {
+	var formUpdateProfile FormUpdateProfile
+	if err := c.ShouldBindBodyWith(&formUpdateProfile, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.UpdateProfileRequest{
+		AuthToken:   formUpdateProfile.AuthToken,
+		DisplayName: formUpdateProfile.DisplayName,
+		AvatarUrl:   formUpdateProfile.AvatarUrl,
+		Bio:         formUpdateProfile.Bio,
+		StatusText:  formUpdateProfile.StatusText,
+		Locale:      formUpdateProfile.Locale,
+		TimeZone:    formUpdateProfile.TimeZone,
+
+		HideReadReceipts: formUpdateProfile.HideReadReceipts,
+	}
+	code, profile, msg := rpc.RpcLogicObj.UpdateProfile(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "profile updated", profile)
+}
+
+type FormSetUserRole struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	UserId    int    `form:"userId" json:"userId" binding:"required"`
+	Role      string `form:"role" json:"role"` // admin 或者空
+}
+
+// 设置全局角色，管理员才能调
+func SetUserRole(c *gin.Context) {
+	var formSetUserRole FormSetUserRole
+	if err := c.ShouldBindBodyWith(&formSetUserRole, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.SetUserRoleRequest{
+		AuthToken: formSetUserRole.AuthToken,
+		UserId:    formSetUserRole.UserId,
+		Role:      formSetUserRole.Role,
+	}
+	code, msg := rpc.RpcLogicObj.SetUserRole(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "ok", nil)
+}
+
+type FormUnlockLogin struct {
+	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
+	UserName  string `form:"userName" json:"userName"`
+	ClientIp  string `form:"clientIp" json:"clientIp"`
+}
+
+// 解锁被登录保护锁住的账号或IP，管理员才能调
+func UnlockLogin(c *gin.Context) {
+	var formUnlockLogin FormUnlockLogin
+	if err := c.ShouldBindBodyWith(&formUnlockLogin, binding.JSON); err != nil {
+		tools2.FailWithMsg(c, err.Error())
+		return
+	}
+	req := &proto.UnlockLoginRequest{
+		AuthToken: formUnlockLogin.AuthToken,
+		UserName:  formUnlockLogin.UserName,
+		ClientIp:  formUnlockLogin.ClientIp,
+	}
+	code, msg := rpc.RpcLogicObj.UnlockLogin(req)
+	if code == tools2.CodeFail {
+		tools2.FailWithMsg(c, msg)
+		return
+	}
+	tools2.SuccessWithMsg(c, "ok", nil)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"gochat/api/handler"
 	"gochat/api/rpc"
+	"gochat/config"
 	"gochat/internal/proto"
 	"gochat/internal/tools"
 	"net/http"
@@ -27,6 +28,14 @@ func Register() *gin.Engine {
 	initHistoryRouter(r)
 	// 初始化ai相关路由
 	initAIRouter(r)
+	// 初始化机器人路由
+	initBotRouter(r)
+	// 初始化房间路由
+	initRoomRouter(r)
+	// 初始化空间路由
+	initSpaceRouter(r)
+	// 初始化私信路由
+	initDmRouter(r)
 
 	// 自定义404处理
 	r.NoRoute(func(c *gin.Context) {
@@ -39,20 +48,36 @@ func initUserRouter(r *gin.Engine) {
 	userGroup := r.Group("/user")
 	userGroup.POST("/login", handler.Login)
 	userGroup.POST("/register", handler.Register)
+	userGroup.POST("/refresh", handler.RefreshToken)
+	userGroup.POST("/login/2fa", handler.Login2fa)
+	userGroup.POST("/password/forgot", handler.ForgotPassword)
+	userGroup.POST("/password/reset", handler.ResetPassword)
 	userGroup.Use(CheckSessionId())
 	{
 		userGroup.POST("/checkAuth", handler.CheckAuth)
 		userGroup.POST("/logout", handler.Logout)
+		userGroup.POST("/sessions", handler.ListSessions)
+		userGroup.POST("/sessions/revoke", handler.RevokeSession)
+		userGroup.POST("/sessions/revokeOthers", handler.RevokeOtherSessions)
+		userGroup.POST("/password", handler.ChangePassword)
+		userGroup.POST("/profile", handler.GetProfile)
+		userGroup.POST("/profile/update", handler.UpdateProfile)
+		userGroup.POST("/role/set", handler.SetUserRole)
+		userGroup.POST("/login/unlock", handler.UnlockLogin)
+		userGroup.POST("/2fa/setup", handler.Setup2fa)
+		userGroup.POST("/2fa/confirm", handler.Confirm2fa)
+		userGroup.POST("/2fa/disable", handler.Disable2fa)
 	}
 
 }
 
 func initPushRouter(r *gin.Engine) {
 	pushGroup := r.Group("/push")
+	// 机器人可以带 X-Api-Key 往房间发消息
+	pushGroup.POST("/pushRoom", CheckApiKeyOrSession(config.ApiKeyScopePushRoom), handler.PushRoom)
 	pushGroup.Use(CheckSessionId())
 	{
 		pushGroup.POST("/push", handler.Push)
-		pushGroup.POST("/pushRoom", handler.PushRoom)
 		pushGroup.POST("/count", handler.Count)
 		pushGroup.POST("/getRoomInfo", handler.GetRoomInfo)
 	}
@@ -61,7 +86,7 @@ func initPushRouter(r *gin.Engine) {
 
 func initHistoryRouter(r *gin.Engine) {
 	g := r.Group("/history")
-	g.Use(CheckSessionId())
+	g.Use(CheckApiKeyOrSession(config.ApiKeyScopeHistoryRead))
 	{
 		g.POST("/list", handler.ListRoomHistory) // 拉取房间历史消息
 	}
@@ -75,6 +100,88 @@ func initAIRouter(r *gin.Engine) {
 	}
 }
 
+func initBotRouter(r *gin.Engine) {
+	g := r.Group("/bot")
+	g.Use(CheckSessionId())
+	{
+		g.POST("/create", handler.CreateBot)
+		g.POST("/list", handler.ListBots)
+		g.POST("/key/create", handler.CreateApiKey)
+		g.POST("/key/list", handler.ListApiKeys)
+		g.POST("/key/revoke", handler.RevokeApiKey)
+	}
+}
+
+func initRoomRouter(r *gin.Engine) {
+	g := r.Group("/room")
+	g.Use(CheckSessionId())
+	{
+		g.POST("/create", handler.CreateRoom)
+		g.POST("/get", handler.GetRoom)
+		g.POST("/list", handler.ListRooms)
+		g.POST("/search", handler.SearchRooms)
+		g.POST("/rename", handler.RenameRoom)
+		g.POST("/archive", handler.ArchiveRoom)
+		g.POST("/delete", handler.DeleteRoom)
+		g.POST("/private", handler.SetRoomPrivate)
+		g.POST("/members", handler.ListRoomMembers)
+		g.POST("/member/remove", handler.RemoveRoomMember)
+		g.POST("/invite", handler.InviteRoomMember)
+		g.POST("/invites", handler.ListRoomInvites) // 我收到的邀请
+		g.POST("/invite/respond", handler.RespondRoomInvite)
+		g.POST("/join/request", handler.RequestJoinRoom)
+		g.POST("/join/requests", handler.ListJoinRequests)
+		g.POST("/join/handle", handler.HandleJoinRequest)
+		g.POST("/link/create", handler.CreateInviteLink)
+		g.POST("/link/revoke", handler.RevokeInviteLink)
+		g.POST("/link/join", handler.JoinByInviteLink)
+		g.POST("/permissions", handler.GetRoomPermissions) // 当前用户在房间里能做什么
+		g.POST("/role/set", handler.SetRoomRole)
+		g.POST("/mute", handler.MuteRoomUser)
+		g.POST("/unmute", handler.UnmuteRoomUser)
+		g.POST("/kick", handler.KickRoomUser)
+		g.POST("/ban", handler.BanRoomUser)
+		g.POST("/unban", handler.UnbanRoomUser)
+		g.POST("/bans", handler.ListRoomBans)
+		g.POST("/slowmode", handler.SetRoomSlowMode)
+		g.POST("/capacity", handler.SetRoomCapacity)
+		g.POST("/meta", handler.GetRoomMeta) // 话题、公告和置顶
+		g.POST("/topic", handler.SetRoomTopic)
+		g.POST("/announcement", handler.SetRoomAnnouncement)
+		g.POST("/pin", handler.PinRoomMessage)
+		g.POST("/unpin", handler.UnpinRoomMessage)
+		g.POST("/read", handler.MarkRoomRead)
+		g.POST("/unread", handler.ListRoomUnread) // 我加入的每个房间的未读数和 @ 我的条数
+		g.POST("/reads", handler.ListRoomReads)   // 房间里每个人读到了哪
+	}
+}
+
+func initSpaceRouter(r *gin.Engine) {
+	g := r.Group("/space")
+	g.Use(CheckSessionId())
+	{
+		g.POST("/create", handler.CreateSpace)
+		g.POST("/get", handler.GetSpace)
+		g.POST("/list", handler.ListSpaces) // 公开空间和自己加入的空间
+		g.POST("/join", handler.JoinSpace)
+		g.POST("/leave", handler.LeaveSpace)
+		g.POST("/delete", handler.DeleteSpace)
+		g.POST("/members", handler.ListSpaceMembers)
+		g.POST("/member/add", handler.AddSpaceMember)
+		g.POST("/member/remove", handler.RemoveSpaceMember)
+		g.POST("/role/set", handler.SetSpaceRole)
+	}
+}
+
+func initDmRouter(r *gin.Engine) {
+	g := r.Group("/dm")
+	g.Use(CheckSessionId())
+	{
+		g.POST("/list", handler.ListConversations)    // 会话列表，带最后一条消息
+		g.POST("/history", handler.ListDirectHistory) // 一个会话的消息
+	}
+}
+
 type FormCheckSessionId struct {
 	AuthToken string `form:"authToken" json:"authToken" binding:"required"`
 }
@@ -97,18 +204,78 @@ func CheckSessionId() gin.HandlerFunc {
 
 		// 调logic rpc
 		code, userId, userName := rpc.RpcLogicObj.CheckAuth(req)
+		// 会话过期单独给个码，客户端好区分是要重新登录（或刷新 token）
+		if code == config.SessionExpiredCode {
+			c.Abort()
+			tools.ResponseWithCode(c, tools.CodeSessionExpired, nil, nil)
+			return
+		}
 		if code == tools.CodeFail || userId <= 0 || userName == "" {
 			c.Abort()
 			tools.ResponseWithCode(c, tools.CodeSessionError, nil, nil)
 			return
 		}
 
-		// 认证通过，后续处理
+		// 认证通过，身份放进上下文，后续处理
+		handler.SetCurrentUser(c, userId, userName, false)
 		c.Next()
 		return
 	}
 }
 
+type FormApiKeyRoom struct {
+	RoomId int `form:"roomId" json:"roomId"`
+}
+
+// 中间件：带了 X-Api-Key 就按机器人 key 认证（检查权限范围和房间），否则走普通会话认证
+func CheckApiKeyOrSession(scope string) gin.HandlerFunc {
+	checkSession := CheckSessionId()
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader("X-Api-Key")
+		if apiKey == "" {
+			checkSession(c)
+			return
+		}
+		code, reply := rpc.RpcLogicObj.AuthApiKey(&proto.AuthApiKeyRequest{ApiKey: apiKey})
+		if code == tools.CodeFail || reply.UserId <= 0 {
+			c.Abort()
+			tools.ResponseWithCode(c, tools.CodeSessionError, "api key invalid", nil)
+			return
+		}
+		if !containsString(reply.Scopes, scope) {
+			c.Abort()
+			tools.FailWithMsg(c, "api key scope not allowed")
+			return
+		}
+		var formApiKeyRoom FormApiKeyRoom
+		if err := c.ShouldBindBodyWith(&formApiKeyRoom, binding.JSON); err != nil || !containsInt(reply.Rooms, formApiKeyRoom.RoomId) {
+			c.Abort()
+			tools.FailWithMsg(c, "api key not allowed in this room")
+			return
+		}
+		handler.SetCurrentUser(c, reply.UserId, reply.UserName, true)
+		c.Next()
+	}
+}
+
+func containsString(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, item int) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
 // 跨域中间件
 func CorsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
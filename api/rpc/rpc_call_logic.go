@@ -12,7 +12,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/smallnest/rpcx/client"
 	"gochat/config"
+	"gochat/internal/pkg/authtoken"
 	proto2 "gochat/internal/proto"
+	"gochat/internal/tools"
 	"sync"
 	"time"
 )
@@ -54,25 +56,570 @@ func InitLogicRpcClient() {
 	}
 }
 
-func (rpc *RpcLogic) Login(req *proto2.LoginRequest) (code int, authToken string, msg string) {
-	reply := &proto2.LoginResponse{}
+func (rpc *RpcLogic) Login(req *proto2.LoginRequest) (code int, reply *proto2.LoginResponse, msg string) {
+	reply = &proto2.LoginResponse{}
 	err := LogicRpcClient.Call(context.Background(), "Login", req, reply)
 	if err != nil {
 		msg = err.Error()
 	}
 	code = reply.Code
-	authToken = reply.AuthToken
 	return
 }
 
-func (rpc *RpcLogic) Register(req *proto2.RegisterRequest) (code int, authToken string, msg string) {
-	reply := &proto2.RegisterReply{}
+func (rpc *RpcLogic) Register(req *proto2.RegisterRequest) (code int, reply *proto2.RegisterReply, msg string) {
+	reply = &proto2.RegisterReply{}
 	err := LogicRpcClient.Call(context.Background(), "Register", req, reply)
 	if err != nil {
 		msg = err.Error()
 	}
 	code = reply.Code
-	authToken = reply.AuthToken
+	return
+}
+
+func (rpc *RpcLogic) RefreshToken(req *proto2.RefreshTokenRequest) (code int, reply *proto2.RefreshTokenResponse, msg string) {
+	reply = &proto2.RefreshTokenResponse{}
+	err := LogicRpcClient.Call(context.Background(), "RefreshToken", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) Login2fa(req *proto2.Login2faRequest) (code int, reply *proto2.LoginResponse, msg string) {
+	reply = &proto2.LoginResponse{}
+	err := LogicRpcClient.Call(context.Background(), "Login2fa", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) Setup2fa(req *proto2.TwoFactorSetupRequest) (code int, reply *proto2.TwoFactorSetupResponse, msg string) {
+	reply = &proto2.TwoFactorSetupResponse{}
+	err := LogicRpcClient.Call(context.Background(), "Setup2fa", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) Confirm2fa(req *proto2.TwoFactorConfirmRequest) (code int, recoveryCodes []string, msg string) {
+	reply := &proto2.TwoFactorConfirmResponse{}
+	err := LogicRpcClient.Call(context.Background(), "Confirm2fa", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	recoveryCodes = reply.RecoveryCodes
+	return
+}
+
+func (rpc *RpcLogic) Disable2fa(req *proto2.TwoFactorDisableRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "Disable2fa", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ChangePassword(req *proto2.ChangePasswordRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "ChangePassword", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ForgotPassword(req *proto2.ForgotPasswordRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "ForgotPassword", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ResetPassword(req *proto2.ResetPasswordRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "ResetPassword", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) GetProfile(req *proto2.GetProfileRequest) (code int, profile proto2.UserProfile, msg string) {
+	reply := &proto2.GetProfileResponse{}
+	err := LogicRpcClient.Call(context.Background(), "GetProfile", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	profile = reply.Profile
+	return
+}
+
+func (rpc *RpcLogic) UpdateProfile(req *proto2.UpdateProfileRequest) (code int, profile proto2.UserProfile, msg string) {
+	reply := &proto2.GetProfileResponse{}
+	err := LogicRpcClient.Call(context.Background(), "UpdateProfile", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	profile = reply.Profile
+	return
+}
+
+func (rpc *RpcLogic) CreateBot(req *proto2.CreateBotRequest) (code int, bot proto2.BotInfo, msg string) {
+	reply := &proto2.CreateBotResponse{}
+	err := LogicRpcClient.Call(context.Background(), "CreateBot", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	bot = reply.Bot
+	return
+}
+
+func (rpc *RpcLogic) ListBots(req *proto2.ListBotsRequest) (code int, bots []proto2.BotInfo, msg string) {
+	reply := &proto2.ListBotsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListBots", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	bots = reply.Bots
+	return
+}
+
+func (rpc *RpcLogic) CreateApiKey(req *proto2.CreateApiKeyRequest) (code int, reply *proto2.CreateApiKeyResponse, msg string) {
+	reply = &proto2.CreateApiKeyResponse{}
+	err := LogicRpcClient.Call(context.Background(), "CreateApiKey", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ListApiKeys(req *proto2.ListApiKeysRequest) (code int, keys []proto2.ApiKeyInfo, msg string) {
+	reply := &proto2.ListApiKeysResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListApiKeys", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	keys = reply.Keys
+	return
+}
+
+func (rpc *RpcLogic) RevokeApiKey(req *proto2.RevokeApiKeyRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RevokeApiKey", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) AuthApiKey(req *proto2.AuthApiKeyRequest) (code int, reply *proto2.AuthApiKeyResponse) {
+	reply = &proto2.AuthApiKeyResponse{}
+	LogicRpcClient.Call(context.Background(), "AuthApiKey", req, reply)
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) GetRoomPermissions(req *proto2.GetRoomPermissionsRequest) (code int, permissions proto2.RoomPermissions, msg string) {
+	reply := &proto2.GetRoomPermissionsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "GetRoomPermissions", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	permissions = reply.Permissions
+	return
+}
+
+func (rpc *RpcLogic) SetRoomRole(req *proto2.SetRoomRoleRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomRole", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) SetUserRole(req *proto2.SetUserRoleRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "SetUserRole", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) UnlockLogin(req *proto2.UnlockLoginRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "UnlockLogin", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) CreateRoom(req *proto2.CreateRoomRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "CreateRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) GetRoom(req *proto2.GetRoomRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "GetRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) RenameRoom(req *proto2.RenameRoomRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "RenameRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) ArchiveRoom(req *proto2.ArchiveRoomRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ArchiveRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) ListRooms(req *proto2.ListRoomsRequest) (code int, rooms []proto2.RoomDirectoryEntry, nextCursor string, msg string) {
+	reply := &proto2.ListRoomsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRooms", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	rooms = reply.Rooms
+	nextCursor = reply.NextCursor
+	return
+}
+
+func (rpc *RpcLogic) SearchRooms(req *proto2.ListRoomsRequest) (code int, rooms []proto2.RoomDirectoryEntry, nextCursor string, msg string) {
+	reply := &proto2.ListRoomsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SearchRooms", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	rooms = reply.Rooms
+	nextCursor = reply.NextCursor
+	return
+}
+
+func (rpc *RpcLogic) DeleteRoom(req *proto2.DeleteRoomRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "DeleteRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) SetRoomSlowMode(req *proto2.SetRoomSlowModeRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomSlowMode", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) SetRoomCapacity(req *proto2.SetRoomCapacityRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomCapacity", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) SetRoomPrivate(req *proto2.SetRoomPrivateRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomPrivate", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) ListRoomMembers(req *proto2.ListRoomMembersRequest) (code int, members []proto2.RoomMemberInfo, msg string) {
+	reply := &proto2.ListRoomMembersResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRoomMembers", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	members = reply.Members
+	return
+}
+
+func (rpc *RpcLogic) RemoveRoomMember(req *proto2.RoomMemberRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RemoveRoomMember", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) InviteRoomMember(req *proto2.RoomMemberRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "InviteRoomMember", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ListRoomInvites(req *proto2.ListRoomInvitesRequest) (code int, invites []proto2.RoomInviteInfo, msg string) {
+	reply := &proto2.ListRoomInvitesResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRoomInvites", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	invites = reply.Invites
+	return
+}
+
+func (rpc *RpcLogic) RespondRoomInvite(req *proto2.RespondRoomInviteRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RespondRoomInvite", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) RequestJoinRoom(req *proto2.RequestJoinRoomRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RequestJoinRoom", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ListJoinRequests(req *proto2.ListJoinRequestsRequest) (code int, requests []proto2.RoomJoinRequestInfo, msg string) {
+	reply := &proto2.ListJoinRequestsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListJoinRequests", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	requests = reply.Requests
+	return
+}
+
+func (rpc *RpcLogic) HandleJoinRequest(req *proto2.HandleJoinRequestRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "HandleJoinRequest", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) CreateInviteLink(req *proto2.CreateInviteLinkRequest) (code int, token string, expiresIn int, msg string) {
+	reply := &proto2.CreateInviteLinkResponse{}
+	err := LogicRpcClient.Call(context.Background(), "CreateInviteLink", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	token = reply.Token
+	expiresIn = reply.ExpiresIn
+	return
+}
+
+func (rpc *RpcLogic) RevokeInviteLink(req *proto2.InviteLinkRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RevokeInviteLink", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) JoinByInviteLink(req *proto2.InviteLinkRequest) (code int, room proto2.RoomInfo, msg string) {
+	reply := &proto2.RoomInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "JoinByInviteLink", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	room = reply.Room
+	return
+}
+
+func (rpc *RpcLogic) MuteRoomUser(req *proto2.ModerateRoomUserRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "MuteRoomUser", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) UnmuteRoomUser(req *proto2.ModerateRoomUserRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "UnmuteRoomUser", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) KickRoomUser(req *proto2.ModerateRoomUserRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "KickRoomUser", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) BanRoomUser(req *proto2.ModerateRoomUserRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "BanRoomUser", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) UnbanRoomUser(req *proto2.ModerateRoomUserRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "UnbanRoomUser", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) ListRoomBans(req *proto2.GetRoomPermissionsRequest) (code int, bans []proto2.RoomBanInfo, msg string) {
+	reply := &proto2.ListRoomBansResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRoomBans", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	bans = reply.Bans
+	return
+}
+
+func (rpc *RpcLogic) SetRoomTopic(req *proto2.SetRoomTopicRequest) (code int, meta proto2.RoomMeta, msg string) {
+	reply := &proto2.RoomMetaResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomTopic", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	meta = reply.Meta
+	return
+}
+
+func (rpc *RpcLogic) SetRoomAnnouncement(req *proto2.SetRoomAnnouncementRequest) (code int, meta proto2.RoomMeta, msg string) {
+	reply := &proto2.RoomMetaResponse{}
+	err := LogicRpcClient.Call(context.Background(), "SetRoomAnnouncement", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	meta = reply.Meta
+	return
+}
+
+func (rpc *RpcLogic) PinRoomMessage(req *proto2.RoomPinRequest) (code int, meta proto2.RoomMeta, msg string) {
+	reply := &proto2.RoomMetaResponse{}
+	err := LogicRpcClient.Call(context.Background(), "PinRoomMessage", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	meta = reply.Meta
+	return
+}
+
+func (rpc *RpcLogic) UnpinRoomMessage(req *proto2.RoomPinRequest) (code int, meta proto2.RoomMeta, msg string) {
+	reply := &proto2.RoomMetaResponse{}
+	err := LogicRpcClient.Call(context.Background(), "UnpinRoomMessage", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	meta = reply.Meta
+	return
+}
+
+func (rpc *RpcLogic) GetRoomMeta(req *proto2.GetRoomPermissionsRequest) (code int, meta proto2.RoomMeta, msg string) {
+	reply := &proto2.RoomMetaResponse{}
+	err := LogicRpcClient.Call(context.Background(), "GetRoomMeta", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	meta = reply.Meta
 	return
 }
 
@@ -85,6 +632,18 @@ func (rpc *RpcLogic) GetUserNameByUserId(req *proto2.GetUserInfoRequest) (code i
 }
 
 func (rpc *RpcLogic) CheckAuth(req *proto2.CheckAuthRequest) (code int, userId int, userName string) {
+	// 签名 token 模式本地验签，省掉一次 rpc 和 redis 会话查询
+	if config.Conf.Api.ApiAuth.IsTokenMode() {
+		claims, err := tools.VerifyAccessToken(req.AuthToken)
+		if err == authtoken.ErrTokenExpired {
+			return config.SessionExpiredCode, 0, ""
+		}
+		if err != nil {
+			logrus.Infof("api verify access token fail:%s", err.Error())
+			return tools.CodeFail, 0, ""
+		}
+		return tools.CodeSuccess, claims.UserId, claims.UserName
+	}
 	reply := &proto2.CheckAuthResponse{}
 	LogicRpcClient.Call(context.Background(), "CheckAuth", req, reply)
 	code = reply.Code
@@ -93,6 +652,37 @@ func (rpc *RpcLogic) CheckAuth(req *proto2.CheckAuthRequest) (code int, userId i
 	return
 }
 
+func (rpc *RpcLogic) ListSessions(req *proto2.ListSessionsRequest) (code int, sessions []proto2.SessionInfo, msg string) {
+	reply := &proto2.ListSessionsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListSessions", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	sessions = reply.Sessions
+	return
+}
+
+func (rpc *RpcLogic) RevokeSession(req *proto2.RevokeSessionRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RevokeSession", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) RevokeOtherSessions(req *proto2.RevokeOtherSessionsRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RevokeOtherSessions", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
 func (rpc *RpcLogic) Logout(req *proto2.LogoutRequest) (code int) {
 	reply := &proto2.LogoutResponse{}
 	LogicRpcClient.Call(context.Background(), "Logout", req, reply)
@@ -100,19 +690,51 @@ func (rpc *RpcLogic) Logout(req *proto2.LogoutRequest) (code int) {
 	return
 }
 
-func (rpc *RpcLogic) Push(req *proto2.Send) (code int, msg string) {
-	reply := &proto2.SuccessReply{}
-	LogicRpcClient.Call(context.Background(), "Push", req, reply)
+func (rpc *RpcLogic) Push(req *proto2.Send) (code int, conversationId int64, messageId int64, msg string) {
+	reply := &proto2.PushReply{}
+	err := LogicRpcClient.Call(context.Background(), "Push", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
 	code = reply.Code
-	msg = reply.Msg
+	conversationId = reply.ConversationId
+	messageId = reply.MessageId
 	return
 }
 
-func (rpc *RpcLogic) PushRoom(req *proto2.Send) (code int, msg string) {
-	reply := &proto2.SuccessReply{}
-	LogicRpcClient.Call(context.Background(), "PushRoom", req, reply)
+func (rpc *RpcLogic) ListConversations(req *proto2.ListConversationsRequest) (code int, list []proto2.ConversationDTO, msg string) {
+	reply := &proto2.ListConversationsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListConversations", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	list = reply.Data
+	return
+}
+
+func (rpc *RpcLogic) ListDirectMessages(req *proto2.ListDirectMessagesRequest) (code int, conversationId int64, list []proto2.DirectMessageDTO, msg string) {
+	reply := &proto2.ListDirectMessagesResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListDirectMessages", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	conversationId = reply.ConversationId
+	list = reply.Data
+	return
+}
+
+// 被限流时 code 是 config.RateLimitedCode，retryAfter 是多少秒后再试
+func (rpc *RpcLogic) PushRoom(req *proto2.Send) (code int, retryAfter int, msg string) {
+	reply := &proto2.PushRoomReply{}
+	err := LogicRpcClient.Call(context.Background(), "PushRoom", req, reply)
 	code = reply.Code
+	retryAfter = reply.RetryAfter
 	msg = reply.Msg
+	if err != nil {
+		msg = err.Error()
+	}
 	return
 }
 
@@ -144,3 +766,140 @@ func (rpc *RpcLogic) ListRoomMessages(req *proto2.ListMessagesRequest) (code int
 	list = reply.Data
 	return
 }
+
+func (rpc *RpcLogic) CreateSpace(req *proto2.CreateSpaceRequest) (code int, space proto2.SpaceInfo, msg string) {
+	reply := &proto2.SpaceInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "CreateSpace", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	space = reply.Space
+	return
+}
+
+func (rpc *RpcLogic) GetSpace(req *proto2.SpaceRequest) (code int, space proto2.SpaceInfo, msg string) {
+	reply := &proto2.SpaceInfoResponse{}
+	err := LogicRpcClient.Call(context.Background(), "GetSpace", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	space = reply.Space
+	return
+}
+
+func (rpc *RpcLogic) ListSpaces(req *proto2.SpaceRequest) (code int, spaces []proto2.SpaceInfo, msg string) {
+	reply := &proto2.ListSpacesResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListSpaces", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	spaces = reply.Spaces
+	return
+}
+
+func (rpc *RpcLogic) ListSpaceMembers(req *proto2.SpaceRequest) (code int, members []proto2.RoomMemberInfo, msg string) {
+	reply := &proto2.ListSpaceMembersResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListSpaceMembers", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	members = reply.Members
+	return
+}
+
+func (rpc *RpcLogic) JoinSpace(req *proto2.SpaceRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "JoinSpace", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) LeaveSpace(req *proto2.SpaceRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "LeaveSpace", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) DeleteSpace(req *proto2.SpaceRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "DeleteSpace", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) AddSpaceMember(req *proto2.SpaceMemberRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "AddSpaceMember", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) RemoveSpaceMember(req *proto2.SpaceMemberRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "RemoveSpaceMember", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) SetSpaceRole(req *proto2.SpaceMemberRequest) (code int, msg string) {
+	reply := &proto2.SuccessReply{}
+	err := LogicRpcClient.Call(context.Background(), "SetSpaceRole", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	return
+}
+
+func (rpc *RpcLogic) MarkRoomRead(req *proto2.MarkRoomReadRequest) (code int, lastReadId int64, msg string) {
+	reply := &proto2.MarkRoomReadReply{}
+	err := LogicRpcClient.Call(context.Background(), "MarkRoomRead", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	lastReadId = reply.LastReadId
+	return
+}
+
+func (rpc *RpcLogic) ListRoomUnread(req *proto2.ListRoomUnreadRequest) (code int, list []proto2.RoomUnread, msg string) {
+	reply := &proto2.ListRoomUnreadResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRoomUnread", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	list = reply.Data
+	return
+}
+
+func (rpc *RpcLogic) ListRoomReads(req *proto2.GetRoomPermissionsRequest) (code int, list []proto2.RoomRead, msg string) {
+	reply := &proto2.ListRoomReadsResponse{}
+	err := LogicRpcClient.Call(context.Background(), "ListRoomReads", req, reply)
+	if err != nil {
+		msg = err.Error()
+	}
+	code = reply.Code
+	list = reply.Data
+	return
+}
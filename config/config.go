@@ -18,20 +18,53 @@ var realPath string
 var Conf *Config
 
 const (
-	SuccessReplyCode      = 0
-	FailReplyCode         = 1
-	SuccessReplyMsg       = "success"
-	QueueName             = "gochat_queue"
-	RedisBaseValidTime    = 86400
-	RedisPrefix           = "gochat_"
-	RedisRoomPrefix       = "gochat_room_"
-	RedisRoomOnlinePrefix = "gochat_room_online_count_"
-	MsgVersion            = 1
-	OpSingleSend          = 2 // single user
-	OpRoomSend            = 3 // send to room
-	OpRoomCountSend       = 4 // get online user count
-	OpRoomInfoSend        = 5 // send info to room
-	OpBuildTcpConn        = 6 // build tcp conn
+	SuccessReplyCode         = 0
+	FailReplyCode            = 1
+	SessionExpiredCode       = 2 // 会话空闲超时或者超过最长有效期，客户端需要重新登录
+	PermissionDeniedCode     = 3 // 没有房间权限，比如进不了的房间
+	RoomNotFoundCode         = 4 // 房间不存在或者已归档
+	RateLimitedCode          = 5 // 发言太快被限流，reply 里带多少秒后再试
+	RoomFullCode             = 6 // 房间成员或在线人数满了，并且房间设置的是满了就拒绝
+	SuccessReplyMsg          = "success"
+	QueueName                = "gochat_queue"
+	TypingChannel            = "gochat_typing" // 正在输入走 redis 发布订阅，在所有 connect 之间广播
+	RedisBaseValidTime       = 86400
+	RedisPrefix              = "gochat_"
+	RedisRoomPrefix          = "gochat_room_"
+	RedisRoomOnlinePrefix    = "gochat_room_online_count_"
+	RedisTokenDenyPrefix     = "gochat_token_deny_"
+	RedisLoginFailPrefix     = "gochat_login_fail_"
+	RedisLoginLockPrefix     = "gochat_login_lock_"
+	RedisLoginWaitPrefix     = "gochat_login_wait_"
+	RedisLogin2faPrefix      = "gochat_login_2fa_"
+	RedisTotpSetupPrefix     = "gochat_totp_setup_"
+	RedisTotpUsedPrefix      = "gochat_totp_used_"
+	RedisPwdResetPrefix      = "gochat_pwd_reset_"
+	RedisRoomInvitePrefix    = "gochat_room_invite_"
+	RedisRoomMutePrefix      = "gochat_room_mute_"
+	RedisRoomSlowPrefix      = "gochat_room_slow_"
+	RedisRoomSpectatorPrefix = "gochat_room_spectator_"
+	RedisSendBucketPrefix    = "gochat_send_bucket_"
+	RedisOfflinePrefix       = "gochat_offline_"
+	RedisRoomSeenPrefix      = "gochat_room_seen_"
+	RedisRefreshPrefix       = "gochat_refresh_"
+	RedisRefreshSetPrefix    = "gochat_refresh_set_"
+	MsgVersion               = 1
+	OpSingleSend             = 2  // single user
+	OpRoomSend               = 3  // send to room
+	OpRoomCountSend          = 4  // get online user count
+	OpRoomInfoSend           = 5  // send info to room
+	OpBuildTcpConn           = 6  // build tcp conn
+	OpJoinRoom               = 7  // 已建连的连接再订阅一个房间
+	OpLeaveRoom              = 8  // 退订一个房间，连接不断
+	OpSwitchRoom             = 9  // 换房间：进新房间，成功以后退出其他房间
+	OpRoomKick               = 10 // 被踢出房间，logic 经队列路由到用户所在的 connect
+	OpRoomMetaSend           = 11 // 房间话题、公告、置顶消息变了，广播给房间里的人
+	OpAck                    = 12 // 客户端确认收到一条消息，带上消息的 seq
+	OpDeliveredReceipt       = 13 // 私信送达回执，推给发私信的人
+	OpReadRoom               = 14 // 客户端标记房间已读，带上读到的消息 id
+	OpRoomReadSend           = 15 // 有人读了房间里的消息，推给房间里的人
+	OpTyping                 = 16 // 正在输入，客户端发给 connect，connect 直接推给本机房间里的其他人
 )
 
 // 各个层的配置
@@ -233,8 +266,57 @@ type LogicBase struct {
 	KeyPath    string `mapstructure:"keyPath"`
 }
 
+type LogicAuth struct {
+	PasswordCost       int    `mapstructure:"passwordCost"`       // bcrypt cost，改了以后老密码会在下次登录时重新哈希
+	LoginFailWindow    int    `mapstructure:"loginFailWindow"`    // 秒，登录失败计数的统计窗口
+	LoginMaxFailures   int    `mapstructure:"loginMaxFailures"`   // 同一账号窗口内失败多少次锁定
+	LoginIpMaxFailures int    `mapstructure:"loginIpMaxFailures"` // 同一IP窗口内失败多少次锁定
+	LoginLockSeconds   int    `mapstructure:"loginLockSeconds"`   // 锁定时长(秒)，也是退避等待的上限
+	LoginBackoffBase   int    `mapstructure:"loginBackoffBase"`   // 退避基数(秒)，第n次失败后要等 base*2^(n-1) 秒
+	TotpIssuer         string `mapstructure:"totpIssuer"`         // 两步验证 app 里显示的发行方
+	TotpSkew           int    `mapstructure:"totpSkew"`           // 允许前后偏差几个 30 秒步长
+	LoginChallengeTtl  int    `mapstructure:"loginChallengeTtl"`  // 秒，密码通过以后多久内要完成两步验证
+	PasswordResetTtl   int    `mapstructure:"passwordResetTtl"`   // 秒，重置密码验证码有效期
+	BootstrapAdmin     string `mapstructure:"bootstrapAdmin"`     // logic 启动时把这个用户设为全局管理员，用来建第一个管理员
+}
+
+type LogicNotify struct {
+	Driver   string `mapstructure:"driver"`   // 通知发送方式，目前只有 file
+	FilePath string `mapstructure:"filePath"` // file 方式写到哪个文件
+}
+
+type LogicRoom struct {
+	InviteLinkTtl    int `mapstructure:"inviteLinkTtl"`    // 秒，邀请链接默认有效期
+	InviteLinkMaxTtl int `mapstructure:"inviteLinkMaxTtl"` // 秒，邀请链接最长有效期
+	MuteMaxTtl       int `mapstructure:"muteMaxTtl"`       // 秒，禁言最长时长
+	SlowModeMax      int `mapstructure:"slowModeMax"`      // 秒，慢速模式最长间隔
+}
+
+// 每个用户全局的发言令牌桶，所有房间共用
+type LogicSend struct {
+	Burst         int `mapstructure:"burst"`         // 桶容量，最多能连着发几条
+	RatePerMinute int `mapstructure:"ratePerMinute"` // 每分钟补充多少条，0 表示不限
+}
+
+// 离线收件箱：用户不在线时收到的单聊消息和所在房间的消息，上线以后按顺序补发
+type LogicOffline struct {
+	MaxSize int `mapstructure:"maxSize"` // 每个用户最多存多少条，超过丢最早的，0 表示不存
+	Ttl     int `mapstructure:"ttl"`     // 秒，最后一条进来以后多久没上线就清掉
+}
+
+type LogicSession struct {
+	IdleTimeout     int `mapstructure:"idleTimeout"`     // 秒，多久没活动会话失效，有活动就续期
+	AbsoluteTimeout int `mapstructure:"absoluteTimeout"` // 秒，登录以后最长有效期，续期也不能超过
+}
+
 type LogicConfig struct {
-	LogicBase LogicBase `mapstructure:"logic-base"`
+	LogicBase    LogicBase    `mapstructure:"logic-base"`
+	LogicAuth    LogicAuth    `mapstructure:"logic-auth"`
+	LogicSession LogicSession `mapstructure:"logic-session"`
+	LogicNotify  LogicNotify  `mapstructure:"logic-notify"`
+	LogicRoom    LogicRoom    `mapstructure:"logic-room"`
+	LogicSend    LogicSend    `mapstructure:"logic-send"`
+	LogicOffline LogicOffline `mapstructure:"logic-offline"`
 }
 
 type TaskBase struct {
@@ -254,8 +336,54 @@ type ApiBase struct {
 	ListenPort int `mapstructure:"listenPort"`
 }
 
+const (
+	AuthModeSession = "session" // redis 会话，默认
+	AuthModeToken   = "token"   // 签名 access token + refresh token
+)
+
+// 全局角色和房间角色，房间角色从高到低：owner > moderator > member > guest
+const (
+	RoleAdmin         = "admin"
+	RoomRoleOwner     = "owner"
+	RoomRoleModerator = "moderator"
+	RoomRoleMember    = "member"
+	RoomRoleGuest     = "guest"
+	DefaultRoomRole   = RoomRoleMember // 房间里没有记录的用户按这个角色算
+)
+
+// 空间角色，从高到低：owner > admin > member；空间的 owner/admin 在空间里的房间分别按房主/moderator 算
+const (
+	SpaceRoleOwner  = "owner"
+	SpaceRoleAdmin  = "admin"
+	SpaceRoleMember = "member"
+)
+
+// 房间满了以后怎么处理
+const (
+	RoomOverflowReject   = "reject"   // 直接拒绝，回 RoomFullCode
+	RoomOverflowSpectate = "spectate" // 以观众身份进，只能看不能发言，不占名额
+)
+
+// 机器人 api key 的权限范围
+const (
+	ApiKeyScopePushRoom    = "push_room"    // 往房间发消息
+	ApiKeyScopeHistoryRead = "history_read" // 读房间历史
+)
+
+type ApiAuth struct {
+	Mode            string `mapstructure:"mode"`
+	TokenSecret     string `mapstructure:"tokenSecret"`
+	AccessTokenTtl  int    `mapstructure:"accessTokenTtl"`  // 秒
+	RefreshTokenTtl int    `mapstructure:"refreshTokenTtl"` // 秒
+}
+
+func (a ApiAuth) IsTokenMode() bool {
+	return a.Mode == AuthModeToken
+}
+
 type ApiConfig struct {
 	ApiBase ApiBase `mapstructure:"api-base"`
+	ApiAuth ApiAuth `mapstructure:"api-auth"`
 }
 
 type SiteBase struct {
@@ -0,0 +1,136 @@
+package connect
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 客户端确认：建连时带上 ack 的连接，聊天消息套一层带上 seq 发出去，客户端回 config.OpAck
+// seq 由连接自己递增分配，上游带过来的 SeqId 可能重复，不能拿来认消息
+// 没确认的过了 AckTimeout 重新放进广播通道，最多重发 AckMaxRetry 次；连接断了就不管了
+
+// 等客户端确认的一条消息
+type pendingMsg struct {
+	seq    uint64
+	msg    *proto.Msg
+	sentAt time.Time
+	retry  int
+}
+
+// 只有聊天消息要确认，名单、人数、进出房间的结果丢了也会被下一次覆盖
+func needAck(op int) bool {
+	return op == config.OpSingleSend || op == config.OpRoomSend
+}
+
+func (ch *Channel) enableAck(enable bool) {
+	ch.ackLock.Lock()
+	ch.ackEnabled = enable
+	ch.ackLock.Unlock()
+}
+
+// 记下要确认的消息，返回要发出去的消息；广播通道满了 Push 会丢消息，记下了就还能重发
+// 房间消息是多个连接共用的，复制一份再填这个连接的 seq
+// 等确认的太多说明客户端不回 ack，不再记，免得越攒越多
+func (ch *Channel) track(msg *proto.Msg) *proto.Msg {
+	if !needAck(msg.Operation) {
+		return msg
+	}
+	ch.ackLock.Lock()
+	defer ch.ackLock.Unlock()
+	if !ch.ackEnabled {
+		return msg
+	}
+	if len(ch.pending) >= cap(ch.broadcast) {
+		logrus.Warnf("userId:%d too many unacked msg,drop seq:%s", ch.userId, msg.SeqId)
+		return msg
+	}
+	ch.ackSeq++
+	tracked := *msg
+	tracked.SeqId = strconv.FormatUint(ch.ackSeq, 10)
+	ch.pending[tracked.SeqId] = &pendingMsg{seq: ch.ackSeq, msg: &tracked, sentAt: time.Now()}
+	return &tracked
+}
+
+// 客户端确认了，返回确认的消息；不认识的 seq 返回 nil
+func (ch *Channel) ack(seqId string) *proto.Msg {
+	ch.ackLock.Lock()
+	defer ch.ackLock.Unlock()
+	pending, ok := ch.pending[seqId]
+	if !ok {
+		return nil
+	}
+	delete(ch.pending, seqId)
+	return pending.msg
+}
+
+// 写协程定时调用，超时没确认的按原来的顺序重新放进广播通道
+func (ch *Channel) redeliver(timeout time.Duration, maxRetry int) {
+	now := time.Now()
+	ch.ackLock.Lock()
+	expired := make([]*pendingMsg, 0)
+	for seqId, pending := range ch.pending {
+		if now.Sub(pending.sentAt) < timeout {
+			continue
+		}
+		if pending.retry >= maxRetry {
+			logrus.Warnf("userId:%d msg seq:%s not acked after %d retry,give up", ch.userId, seqId, pending.retry)
+			delete(ch.pending, seqId)
+			continue
+		}
+		pending.retry++
+		pending.sentAt = now
+		expired = append(expired, pending)
+	}
+	ch.ackLock.Unlock()
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].seq < expired[j].seq
+	})
+	for _, pending := range expired {
+		ch.enqueue(pending.msg)
+	}
+}
+
+// 写协程发出去的内容：要确认的消息套一层带上 seq，其他的原样发
+func (ch *Channel) frame(msg *proto.Msg) []byte {
+	ch.ackLock.Lock()
+	pending, ok := ch.pending[msg.SeqId]
+	ch.ackLock.Unlock()
+	if !ok || pending.msg != msg {
+		return msg.Body
+	}
+	body, err := json.Marshal(proto.AckFrame{
+		Ver:  msg.Ver,
+		Op:   msg.Operation,
+		Seq:  msg.SeqId,
+		Body: msg.Body,
+	})
+	if err != nil {
+		// body 不是 json 就没法套，原样发
+		return msg.Body
+	}
+	return body
+}
+
+// 客户端确认收到；确认的是私信就告诉 logic 已送达，由 logic 给发信人推回执
+func (s *Server) ack(ch *Channel, seqId string) {
+	msg := ch.ack(seqId)
+	if msg == nil || msg.Operation != config.OpSingleSend {
+		return
+	}
+	var send proto.Send
+	if err := json.Unmarshal(msg.Body, &send); err != nil {
+		logrus.Warnf("ack unmarshal single msg err:%s", err.Error())
+		return
+	}
+	if send.ConversationId <= 0 || send.ClientMsgId <= 0 {
+		return
+	}
+	if err := s.operator.Delivered(&proto.DeliveredRequest{UserId: ch.userId, MessageId: send.ClientMsgId}); err != nil {
+		logrus.Warnf("Delivered rpc err :%s", err.Error())
+	}
+}
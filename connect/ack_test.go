@@ -0,0 +1,137 @@
+package connect
+
+import (
+	"gochat/config"
+	"gochat/internal/proto"
+	"testing"
+	"time"
+)
+
+func Test_TrackAck(t *testing.T) {
+	cases := []struct {
+		name    string
+		enabled bool
+		op      int
+		unknown bool
+		wantAck bool
+	}{
+		{"room msg", true, config.OpRoomSend, false, true},
+		{"single msg", true, config.OpSingleSend, false, true},
+		{"roster not tracked", true, config.OpRoomInfoSend, false, false},
+		{"ack disabled", false, config.OpRoomSend, false, false},
+		{"unknown seq", true, config.OpRoomSend, true, false},
+	}
+	for _, c := range cases {
+		ch := NewChannel(4)
+		ch.enableAck(c.enabled)
+		msg := &proto.Msg{Operation: c.op, SeqId: "42"}
+		sent := ch.track(msg)
+		seq := sent.SeqId
+		if c.unknown {
+			seq = "999"
+		}
+		got := ch.ack(seq)
+		if (got != nil) != c.wantAck {
+			t.Fatalf("%s: ack got %v want %v", c.name, got != nil, c.wantAck)
+		}
+		if got != nil && got != sent {
+			t.Fatalf("%s: ack returned another msg", c.name)
+		}
+		if ch.ack(seq) != nil {
+			t.Fatalf("%s: second ack should return nil", c.name)
+		}
+	}
+}
+
+func Test_TrackSameSeq(t *testing.T) {
+	ch := NewChannel(4)
+	ch.enableAck(true)
+	// 上游同一毫秒生成的 seq 会一样，两条都要能单独确认
+	first := &proto.Msg{Operation: config.OpSingleSend, SeqId: "7", Body: []byte("a")}
+	second := &proto.Msg{Operation: config.OpSingleSend, SeqId: "7", Body: []byte("b")}
+	_ = ch.Push(first)
+	_ = ch.Push(second)
+	a, b := <-ch.broadcast, <-ch.broadcast
+	if a.SeqId == b.SeqId {
+		t.Fatalf("back-to-back msgs share seq %s", a.SeqId)
+	}
+	if first.SeqId != "7" || second.SeqId != "7" {
+		t.Fatal("track should not modify the shared msg")
+	}
+	if len(ch.pending) != 2 {
+		t.Fatalf("pending got %d want 2", len(ch.pending))
+	}
+	if got := ch.ack(a.SeqId); got == nil || string(got.Body) != "a" {
+		t.Fatal("ack first msg failed")
+	}
+	if got := ch.ack(b.SeqId); got == nil || string(got.Body) != "b" {
+		t.Fatal("ack second msg failed")
+	}
+}
+
+func Test_TrackCap(t *testing.T) {
+	ch := NewChannel(2)
+	ch.enableAck(true)
+	var msg, sent *proto.Msg
+	for i := 0; i < 3; i++ {
+		msg = &proto.Msg{Operation: config.OpRoomSend, SeqId: "1"}
+		sent = ch.track(msg)
+	}
+	if len(ch.pending) != 2 {
+		t.Fatalf("pending got %d want 2", len(ch.pending))
+	}
+	if sent != msg {
+		t.Fatal("msg over the cap should not be tracked")
+	}
+}
+
+func Test_RedeliverOrder(t *testing.T) {
+	ch := NewChannel(8)
+	ch.enableAck(true)
+	bodies := []string{"100", "9", "11", "10"}
+	for _, body := range bodies {
+		ch.track(&proto.Msg{Operation: config.OpRoomSend, SeqId: "1", Body: []byte(body)})
+	}
+	ch.redeliver(0, 3)
+	for _, want := range bodies {
+		select {
+		case msg := <-ch.broadcast:
+			if string(msg.Body) != want {
+				t.Fatalf("redeliver got %s want %s", msg.Body, want)
+			}
+		default:
+			t.Fatalf("redeliver missing %s", want)
+		}
+	}
+}
+
+func Test_RedeliverRetry(t *testing.T) {
+	ch := NewChannel(8)
+	ch.enableAck(true)
+	ch.track(&proto.Msg{Operation: config.OpRoomSend, SeqId: "1"})
+	// 一轮一轮按顺序跑，最多重发 2 次
+	cases := []struct {
+		name        string
+		timeout     time.Duration
+		wantResent  int
+		wantPending int
+	}{
+		{"not timed out", time.Hour, 0, 1},
+		{"retry 1", 0, 1, 1},
+		{"retry 2", 0, 1, 1},
+		{"give up", 0, 0, 0},
+		{"nothing left", 0, 0, 0},
+	}
+	for _, c := range cases {
+		ch.redeliver(c.timeout, 2)
+		if len(ch.broadcast) != c.wantResent {
+			t.Fatalf("%s: resent got %d want %d", c.name, len(ch.broadcast), c.wantResent)
+		}
+		for len(ch.broadcast) > 0 {
+			<-ch.broadcast
+		}
+		if len(ch.pending) != c.wantPending {
+			t.Fatalf("%s: pending got %d want %d", c.name, len(ch.pending), c.wantPending)
+		}
+	}
+}
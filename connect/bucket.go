@@ -62,7 +62,7 @@ func (b *Bucket) PushRoom(ch chan *proto.PushRoomMsgRequest) {
 		)
 		arg = <-ch
 		if room = b.Room(arg.RoomId); room != nil {
-			room.Push(&arg.Msg)
+			room.Push(&arg.Msg, arg.ExceptUserId)
 		}
 	}
 }
@@ -77,52 +77,60 @@ func (b *Bucket) Room(rid int) (room *Room) {
 
 // 添加链接？将用户/链接/房间 入桶管理
 func (b *Bucket) Put(userId int, roomId int, ch *Channel) (err error) {
-	var (
-		room *Room
-		ok   bool
-	)
 	b.cLock.Lock()
-
-	// 房间管理，添加新房间
-	if roomId != NoRoom {
-		if room, ok = b.rooms[roomId]; !ok {
-			room = NewRoom(roomId)
-			b.rooms[roomId] = room
-		}
-		ch.Room = room
-	}
 	// 关联链接，有个疑问，链接已经被存储到room中了，干嘛还要单独存一个链接关联呢，可能是找的方便吧，待解释
 	ch.userId = userId
 	b.chs[userId] = ch
 	b.cLock.Unlock()
 
 	// 将链接添加到房间中
-	if room != nil {
-		err = room.Put(ch)
+	if roomId != NoRoom {
+		err = b.JoinRoom(roomId, ch)
+	}
+	return
+}
+
+// 连接再订阅一个房间，房间不存在就建一个
+func (b *Bucket) JoinRoom(roomId int, ch *Channel) (err error) {
+	b.cLock.Lock()
+	defer b.cLock.Unlock()
+	room, ok := b.rooms[roomId]
+	if !ok {
+		room = NewRoom(roomId)
+		b.rooms[roomId] = room
+	}
+	if err = room.Put(ch); err != nil {
+		return
 	}
+	ch.addRoom(room)
 	return
 }
 
-// 原来是为了删除方便
+// 连接退订一个房间，房间空了就删掉
+func (b *Bucket) LeaveRoom(roomId int, ch *Channel) {
+	b.cLock.Lock()
+	defer b.cLock.Unlock()
+	room := ch.removeRoom(roomId)
+	if room == nil {
+		return
+	}
+	if room.DeleteChannel(ch) {
+		// 如果房间为空，那就删掉这个房间
+		delete(b.rooms, room.Id)
+	}
+}
+
+// 原来是为了删除方便；连接断开时退出它订阅的所有房间
 func (b *Bucket) DeleteChannel(ch *Channel) {
-	var (
-		ok   bool
-		room *Room
-	)
-	b.cLock.RLock()
-	if ch, ok = b.chs[ch.userId]; ok {
-		room = b.chs[ch.userId].Room
-		//delete from bucket
+	b.cLock.Lock()
+	// 同一个用户重连以后 chs 里已经是新连接了，不能把新连接删掉
+	if old, ok := b.chs[ch.userId]; ok && old == ch {
 		delete(b.chs, ch.userId)
 	}
-	if room != nil && room.DeleteChannel(ch) {
-		// if room empty delete,will mark room.drop is true
-		// 如果房间为空，那就删掉这个房间
-		if room.drop == true {
-			delete(b.rooms, room.Id)
-		}
+	b.cLock.Unlock()
+	for _, roomId := range ch.RoomIds() {
+		b.LeaveRoom(roomId, ch)
 	}
-	b.cLock.RUnlock()
 }
 
 // 返回userid 对应的链接
@@ -0,0 +1,131 @@
+package connect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_RoomPutDelete(t *testing.T) {
+	a, b := NewChannel(1), NewChannel(1)
+	room := NewRoom(1)
+	cases := []struct {
+		name      string
+		put       bool
+		ch        *Channel
+		wantCount int
+		wantDrop  bool
+	}{
+		{"put a", true, a, 1, false},
+		{"put a again", true, a, 1, false},
+		{"put b", true, b, 2, false},
+		{"delete a", false, a, 1, false},
+		{"delete a again", false, a, 1, false},
+		{"delete b", false, b, 0, true},
+	}
+	for _, c := range cases {
+		if c.put {
+			if err := room.Put(c.ch); err != nil {
+				t.Fatalf("%s: put err %s", c.name, err.Error())
+			}
+		} else if drop := room.DeleteChannel(c.ch); drop != c.wantDrop {
+			t.Fatalf("%s: drop got %v want %v", c.name, drop, c.wantDrop)
+		}
+		if room.OnlineCount != c.wantCount {
+			t.Fatalf("%s: online got %d want %d", c.name, room.OnlineCount, c.wantCount)
+		}
+	}
+	if err := room.Put(a); err == nil {
+		t.Fatal("put into dropped room should fail")
+	}
+}
+
+func Test_BucketJoinLeaveRoom(t *testing.T) {
+	b := NewBucket(BucketOptions{ChannelSize: 4, RoomSize: 4, ChToPushRoomMsgCount: 1, RoutineSize: 1})
+	a, c := NewChannel(1), NewChannel(1)
+	_ = b.Put(1, NoRoom, a)
+	_ = b.Put(2, NoRoom, c)
+	// wantOnline 里 0 表示房间已经删掉了
+	cases := []struct {
+		name       string
+		join       bool
+		ch         *Channel
+		roomId     int
+		wantRooms  []int
+		wantOnline map[int]int
+	}{
+		{"a joins 1", true, a, 1, []int{1}, map[int]int{1: 1}},
+		{"a joins 2", true, a, 2, []int{1, 2}, map[int]int{1: 1, 2: 1}},
+		{"c joins 2", true, c, 2, []int{2}, map[int]int{1: 1, 2: 2}},
+		{"a joins 2 again", true, a, 2, []int{1, 2}, map[int]int{1: 1, 2: 2}},
+		{"a leaves 1", false, a, 1, []int{2}, map[int]int{1: 0, 2: 2}},
+		{"a leaves 1 again", false, a, 1, []int{2}, map[int]int{1: 0, 2: 2}},
+		{"c leaves 2", false, c, 2, []int{}, map[int]int{2: 1}},
+		{"a leaves 2", false, a, 2, []int{}, map[int]int{2: 0}},
+		{"a joins 2 after drop", true, a, 2, []int{2}, map[int]int{2: 1}},
+	}
+	for _, cs := range cases {
+		if cs.join {
+			if err := b.JoinRoom(cs.roomId, cs.ch); err != nil {
+				t.Fatalf("%s: join err %s", cs.name, err.Error())
+			}
+		} else {
+			b.LeaveRoom(cs.roomId, cs.ch)
+		}
+		if got := cs.ch.RoomIds(); !reflect.DeepEqual(got, cs.wantRooms) {
+			t.Fatalf("%s: rooms got %v want %v", cs.name, got, cs.wantRooms)
+		}
+		for roomId, want := range cs.wantOnline {
+			room := b.Room(roomId)
+			if want == 0 {
+				if room != nil {
+					t.Fatalf("%s: room %d should be dropped", cs.name, roomId)
+				}
+				continue
+			}
+			if room == nil || room.OnlineCount != want {
+				t.Fatalf("%s: room %d online want %d", cs.name, roomId, want)
+			}
+		}
+	}
+}
+
+func Test_BucketDeleteChannel(t *testing.T) {
+	b := NewBucket(BucketOptions{ChannelSize: 4, RoomSize: 4, ChToPushRoomMsgCount: 1, RoutineSize: 1})
+	old, fresh, other := NewChannel(1), NewChannel(1), NewChannel(1)
+	_ = b.Put(1, 1, old)
+	_ = b.JoinRoom(3, old)
+	_ = b.Put(2, 3, other)
+	// 同一个用户重连，新连接先入桶，旧连接后断开
+	_ = b.Put(1, NoRoom, fresh)
+	b.DeleteChannel(old)
+	cases := []struct {
+		name   string
+		roomId int
+		online int
+	}{
+		{"room only old was in is dropped", 1, 0},
+		{"room shared with other keeps other", 3, 1},
+	}
+	for _, c := range cases {
+		room := b.Room(c.roomId)
+		if c.online == 0 {
+			if room != nil {
+				t.Fatalf("%s: room %d should be dropped", c.name, c.roomId)
+			}
+			continue
+		}
+		if room == nil || room.OnlineCount != c.online {
+			t.Fatalf("%s: room %d online want %d", c.name, c.roomId, c.online)
+		}
+	}
+	if len(old.RoomIds()) != 0 {
+		t.Fatalf("old channel still in rooms %v", old.RoomIds())
+	}
+	if b.Channel(1) != fresh {
+		t.Fatal("deleting old channel removed the reconnected one")
+	}
+	b.DeleteChannel(fresh)
+	if b.Channel(1) != nil {
+		t.Fatal("channel not removed")
+	}
+}
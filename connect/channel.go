@@ -9,32 +9,88 @@ import (
 	"github.com/gorilla/websocket"
 	"gochat/internal/proto"
 	"net"
+	"sort"
+	"sync"
+	"time"
 )
 
 // in fact, Channel it's a user Connect session
+// 一个连接可以同时订阅多个房间，rooms 记着它在哪些房间里，房间那边也记着它
 type Channel struct {
-	Room      *Room // 有点意思，ROOM能用指针找到Channel，Channel还能找回去
-	Next      *Channel
-	Prev      *Channel
+	rLock     sync.RWMutex
+	rooms     map[int]*Room   // 房间ID => 房间，Room 能找到 Channel，Channel 也能找回去
 	broadcast chan *proto.Msg // 消息广播通道
 	userId    int             // 用户ID
+	authToken string          // 建连时的令牌，后面进房间没带令牌就用它
 	conn      *websocket.Conn
 	connTcp   *net.TCPConn
+	// 客户端确认，见 ack.go
+	ackLock    sync.Mutex
+	ackEnabled bool
+	ackSeq     uint64                 // 上一个分配出去的 seq
+	pending    map[string]*pendingMsg // seq => 等确认的消息
+	// 正在输入，见 typing.go
+	typingLock sync.Mutex
+	typing     map[int]time.Time // 房间ID => 上一次转发「正在输入」的时间
+	spectating map[int]bool      // 以观众身份进的房间
+	mutedUntil map[int]time.Time // 房间ID => 进房间时记下的禁言到期时间
 }
 
 func NewChannel(size int) (c *Channel) {
 	c = new(Channel)
 	c.broadcast = make(chan *proto.Msg, size)
-	c.Next = nil
-	c.Prev = nil
+	c.rooms = make(map[int]*Room)
+	c.pending = make(map[string]*pendingMsg)
+	c.typing = make(map[int]time.Time)
+	c.spectating = make(map[int]bool)
+	c.mutedUntil = make(map[int]time.Time)
 	return
 }
 
 // 这里的链接究竟是谁的呢，如果是双方的，那为什么只有一个userid呢，如果不是单方的，那为什么这里说的是广播呢？
 func (ch *Channel) Push(msg *proto.Msg) (err error) {
+	ch.enqueue(ch.track(msg))
+	return
+}
+
+// 广播通道满了就丢，要确认的消息还会重发
+func (ch *Channel) enqueue(msg *proto.Msg) {
 	select {
 	case ch.broadcast <- msg:
 	default:
 	}
+}
+
+func (ch *Channel) addRoom(room *Room) {
+	ch.rLock.Lock()
+	ch.rooms[room.Id] = room
+	ch.rLock.Unlock()
+}
+
+func (ch *Channel) removeRoom(roomId int) (room *Room) {
+	ch.rLock.Lock()
+	room = ch.rooms[roomId]
+	delete(ch.rooms, roomId)
+	ch.rLock.Unlock()
+	return
+}
+
+// 是否已经在这个房间里
+func (ch *Channel) InRoom(roomId int) bool {
+	ch.rLock.RLock()
+	_, ok := ch.rooms[roomId]
+	ch.rLock.RUnlock()
+	return ok
+}
+
+// 当前订阅的所有房间，按房间号排好
+func (ch *Channel) RoomIds() (roomIds []int) {
+	ch.rLock.RLock()
+	roomIds = make([]int, 0, len(ch.rooms))
+	for roomId := range ch.rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	ch.rLock.RUnlock()
+	sort.Ints(roomIds)
 	return
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"gochat/api/rpc"
 	"gochat/config"
 	_ "net/http/pprof"
 	"runtime"
@@ -60,8 +61,15 @@ func (c *Connect) Run() {
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		BroadcastSize:   512,
+		AckTimeout:      10 * time.Second,
+		AckMaxRetry:     3,
+		TypingInterval:  3 * time.Second,
+		TypingTtl:       6 * time.Second,
 	})
 	c.ServerId = fmt.Sprintf("%s-%s", "ws", uuid.New().String())
+	if err := c.InitTypingRedisClient(); err != nil {
+		logrus.Warnf("InitTypingRedisClient err:%s, typing only broadcast locally", err.Error())
+	}
 	//init Connect layer rpc server ,task layer will call this
 	// Task 层会调用？
 	if err := c.InitConnectWebsocketRpcServer(); err != nil {
@@ -86,6 +94,8 @@ func (c *Connect) RunTcp() {
 	if err := c.InitLogicRpcClient(); err != nil {
 		logrus.Panicf("InitLogicRpcClient err:%s", err.Error())
 	}
+	// tcp 发消息直接走 api 的 logic rpc 客户端
+	rpc.InitLogicRpcClient()
 	//init Connect layer rpc server, logic client will call this
 	Buckets := make([]*Bucket, connectConfig.ConnectBucket.CpuNum)
 	for i := 0; i < connectConfig.ConnectBucket.CpuNum; i++ {
@@ -105,11 +115,18 @@ func (c *Connect) RunTcp() {
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		BroadcastSize:   512,
+		AckTimeout:      10 * time.Second,
+		AckMaxRetry:     3,
+		TypingInterval:  3 * time.Second,
+		TypingTtl:       6 * time.Second,
 	})
 	//go func() {
 	//	http.ListenAndServe("0.0.0.0:9000", nil)
 	//}()
 	c.ServerId = fmt.Sprintf("%s-%s", "tcp", uuid.New().String())
+	if err := c.InitTypingRedisClient(); err != nil {
+		logrus.Warnf("InitTypingRedisClient err:%s, typing only broadcast locally", err.Error())
+	}
 	//init Connect layer rpc server ,task layer will call this
 	if err := c.InitConnectTcpRpcServer(); err != nil {
 		logrus.Panicf("InitConnectWebsocketRpcServer Fatal error: %s \n", err.Error())
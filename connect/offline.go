@@ -0,0 +1,60 @@
+package connect
+
+import (
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+)
+
+// 建连成功、连接已经入桶以后，再找 logic 取走不在线期间攒下的消息按顺序补发；
+// 入桶失败的连接不取，消息留在 logic 那里等下次
+// 走广播通道，和之后的实时消息排在同一个队列里，顺序不会乱
+func (s *Server) flushOffline(ch *Channel) {
+	msgs, err := s.operator.TakeOffline(ch.userId)
+	if err != nil {
+		logrus.Warnf("take offline msg for userId:%d err:%s", ch.userId, err.Error())
+		return
+	}
+	for _, msg := range msgs {
+		_ = ch.Push(&proto.Msg{
+			Ver:       config.MsgVersion,
+			Operation: msg.Op,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      msg.Body,
+		})
+	}
+	if len(msgs) > 0 {
+		logrus.Infof("flush %d offline msg to userId:%d", len(msgs), ch.userId)
+	}
+}
+
+// 连接断开：出桶，离开订阅的每个房间；这台 connect 上没有这个用户的连接了，顺带告诉 logic 用户下线
+func (s *Server) disConnect(ch *Channel, serverId string) {
+	roomIds := ch.RoomIds()
+	for _, roomId := range roomIds {
+		s.clearTyping(ch, roomId)
+	}
+	b := s.Bucket(ch.userId)
+	b.DeleteChannel(ch)
+	offline := b.Channel(ch.userId) == nil
+	if len(roomIds) == 0 {
+		if !offline {
+			return
+		}
+		// 不在任何房间里也要清掉所在服务器
+		roomIds = []int{NoRoom}
+	}
+	for _, roomId := range roomIds {
+		disConnectRequest := new(proto.DisConnectRequest)
+		disConnectRequest.RoomId = roomId
+		disConnectRequest.UserId = ch.userId
+		disConnectRequest.ServerId = serverId
+		disConnectRequest.Offline = offline
+		if err := s.operator.DisConnect(disConnectRequest); err != nil {
+			logrus.Warnf("DisConnect rpc err :%s", err.Error())
+		}
+		// 一次就够了
+		offline = false
+	}
+}
@@ -6,13 +6,31 @@
 package connect
 
 import (
+	"errors"
 	"gochat/internal/proto"
 )
 
+// 会话过期，ws/tcp 需要明确告诉客户端重新登录
+var ErrSessionExpired = errors.New("session expired")
+
+// 没有进这个房间的权限
+var ErrPermissionDenied = errors.New("permission denied")
+
+// 房间不存在或者已归档
+var ErrRoomNotFound = errors.New("room not found")
+
+// 房间满了，并且房间设置的是满了就拒绝
+var ErrRoomFull = errors.New("room full")
+
 // 操作符？这是什么形式，代理吗？
 type Operator interface {
-	Connect(conn *proto.ConnectRequest) (int, error)         // 用于加入房间请求
-	DisConnect(disConn *proto.DisConnectRequest) (err error) // 用于离开房间请求
+	Connect(conn *proto.ConnectRequest) (int, proto.RoomSeat, error)                    // 用于加入房间请求
+	TakeOffline(userId int) ([]proto.OfflineMsg, error)                                 // 入桶以后取走离线消息
+	DisConnect(disConn *proto.DisConnectRequest) (err error)                            // 用于离开房间请求
+	JoinRoom(join *proto.JoinRoomRequest) (userId int, room proto.RoomState, err error) // 已建连的连接再进一个房间
+	LeaveRoom(leave *proto.DisConnectRequest) (err error)                               // 连接不断，只离开一个房间
+	Delivered(delivered *proto.DeliveredRequest) (err error)                            // 客户端确认收到了一条私信
+	MarkRoomRead(read *proto.MarkRoomReadRequest) (userId int, err error)               // 标记房间已读
 }
 
 // 默认操作符只提供加入房间和离开房间的方法
@@ -20,9 +38,16 @@ type DefaultOperator struct {
 }
 
 // rpc call logic layer
-func (o *DefaultOperator) Connect(conn *proto.ConnectRequest) (uid int, err error) {
+func (o *DefaultOperator) Connect(conn *proto.ConnectRequest) (uid int, seat proto.RoomSeat, err error) {
 	rpcConnect := new(RpcConnect)
-	uid, err = rpcConnect.Connect(conn)
+	uid, seat, err = rpcConnect.Connect(conn)
+	return
+}
+
+// rpc call logic layer
+func (o *DefaultOperator) TakeOffline(userId int) (offline []proto.OfflineMsg, err error) {
+	rpcConnect := new(RpcConnect)
+	offline, err = rpcConnect.TakeOffline(userId)
 	return
 }
 
@@ -32,3 +57,31 @@ func (o *DefaultOperator) DisConnect(disConn *proto.DisConnectRequest) (err erro
 	err = rpcConnect.DisConnect(disConn)
 	return
 }
+
+// rpc call logic layer
+func (o *DefaultOperator) JoinRoom(join *proto.JoinRoomRequest) (userId int, room proto.RoomState, err error) {
+	rpcConnect := new(RpcConnect)
+	userId, room, err = rpcConnect.JoinRoom(join)
+	return
+}
+
+// rpc call logic layer
+func (o *DefaultOperator) LeaveRoom(leave *proto.DisConnectRequest) (err error) {
+	rpcConnect := new(RpcConnect)
+	err = rpcConnect.LeaveRoom(leave)
+	return
+}
+
+// rpc call logic layer
+func (o *DefaultOperator) Delivered(delivered *proto.DeliveredRequest) (err error) {
+	rpcConnect := new(RpcConnect)
+	err = rpcConnect.Delivered(delivered)
+	return
+}
+
+// rpc call logic layer
+func (o *DefaultOperator) MarkRoomRead(read *proto.MarkRoomReadRequest) (userId int, err error) {
+	rpcConnect := new(RpcConnect)
+	userId, err = rpcConnect.MarkRoomRead(read)
+	return
+}
@@ -0,0 +1,131 @@
+package connect
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"time"
+)
+
+// 已建连的连接进房间、离开房间、换房间，ws 和 tcp 共用
+// 结果用 RoomOpReply 回给客户端；只有会话过期返回错误，调用方要断开连接
+func (s *Server) RoomOp(ch *Channel, serverId string, op int, roomId int, authToken string) error {
+	switch op {
+	case config.OpJoinRoom, config.OpSwitchRoom:
+		if roomId <= 0 {
+			writeRoomOpReply(ch, op, roomId, tools.CodeRoomNotFound, nil)
+			return nil
+		}
+		room, err := s.joinRoom(ch, serverId, roomId, authToken)
+		if err == ErrSessionExpired {
+			return err
+		}
+		if err != nil {
+			writeRoomOpReply(ch, op, roomId, roomOpCode(err), nil)
+			return nil
+		}
+		// 换房间：新房间进去了再退出其他房间，进不去就还留在原来的房间
+		if op == config.OpSwitchRoom {
+			for _, oldRoomId := range ch.RoomIds() {
+				if oldRoomId != roomId {
+					s.leaveRoom(ch, oldRoomId)
+				}
+			}
+		}
+		writeRoomOpReply(ch, op, roomId, tools.CodeSuccess, &room)
+	case config.OpLeaveRoom:
+		s.leaveRoom(ch, roomId)
+		writeRoomOpReply(ch, op, roomId, tools.CodeSuccess, nil)
+	default:
+		logrus.Warnf("connect unknown room op:%d", op)
+	}
+	return nil
+}
+
+// 已建连的连接标记房间已读，结果和进出房间一样用 RoomOpReply 回
+func (s *Server) ReadRoom(ch *Channel, roomId int, messageId int64, authToken string) {
+	if authToken == "" {
+		authToken = ch.authToken
+	}
+	code := tools.CodeSuccess
+	userId, err := s.operator.MarkRoomRead(&proto.MarkRoomReadRequest{
+		AuthToken: authToken,
+		RoomId:    roomId,
+		MessageId: messageId,
+	})
+	if err != nil {
+		code = tools.CodeFail
+	} else if userId != ch.userId {
+		// 和进房间一样，一个连接只属于一个用户；拿别人的令牌标的是别人的已读，走 api 也一样能标，这里只报错
+		logrus.Errorf("connect read room %d with other user token,userId:%d,channel userId:%d", roomId, userId, ch.userId)
+		code = tools.CodeForbidden
+	}
+	writeRoomOpReply(ch, config.OpReadRoom, roomId, code, nil)
+}
+
+func (s *Server) joinRoom(ch *Channel, serverId string, roomId int, authToken string) (room proto.RoomState, err error) {
+	if authToken == "" {
+		authToken = ch.authToken
+	}
+	userId, room, err := s.operator.JoinRoom(&proto.JoinRoomRequest{
+		AuthToken: authToken,
+		RoomId:    roomId,
+		ServerId:  serverId,
+	})
+	if err != nil {
+		logrus.Infof("connect join room %d fail:%s", roomId, err.Error())
+		return
+	}
+	// 换了别人的令牌也不行，一个连接只属于一个用户
+	if userId != ch.userId {
+		logrus.Errorf("connect join room %d with other user token,userId:%d,channel userId:%d", roomId, userId, ch.userId)
+		err = ErrPermissionDenied
+		return
+	}
+	ch.setRoomSeat(roomId, room.RoomSeat, time.Now())
+	err = s.Bucket(ch.userId).JoinRoom(roomId, ch)
+	return
+}
+
+func (s *Server) leaveRoom(ch *Channel, roomId int) {
+	if !ch.InRoom(roomId) {
+		return
+	}
+	s.Bucket(ch.userId).LeaveRoom(roomId, ch)
+	s.clearTyping(ch, roomId)
+	if err := s.operator.LeaveRoom(&proto.DisConnectRequest{RoomId: roomId, UserId: ch.userId}); err != nil {
+		logrus.Warnf("connect leave room %d err:%s", roomId, err.Error())
+	}
+}
+
+func roomOpCode(err error) int {
+	switch err {
+	case ErrPermissionDenied:
+		return tools.CodeForbidden
+	case ErrRoomNotFound:
+		return tools.CodeRoomNotFound
+	case ErrRoomFull:
+		return tools.CodeRoomFull
+	}
+	return tools.CodeFail
+}
+
+// 进出房间的结果走广播通道，由写协程发出去，不和别的消息抢连接
+func writeRoomOpReply(ch *Channel, op int, roomId int, code int, room *proto.RoomState) {
+	body, _ := json.Marshal(proto.RoomOpReply{
+		Op:      op,
+		RoomId:  roomId,
+		Code:    code,
+		Msg:     tools.MsgCodeMap[code],
+		RoomIds: ch.RoomIds(),
+		Room:    room,
+	})
+	_ = ch.Push(&proto.Msg{
+		Ver:       config.MsgVersion,
+		Operation: op,
+		SeqId:     tools.GetSnowflakeIdString(),
+		Body:      body,
+	})
+}
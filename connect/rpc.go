@@ -62,7 +62,7 @@ func (rpc *RpcConnectPush) PushSingleMsg(ctx context.Context, pushMsgReq *proto2
 		bucket  *Bucket
 		channel *Channel
 	)
-	logrus.Info("rpc PushMsg :%v ", pushMsgReq)
+	logrus.Infof("rpc PushMsg :%v ", pushMsgReq)
 	if pushMsgReq == nil {
 		logrus.Errorf("rpc PushSingleMsg() args:(%v)", pushMsgReq)
 		return
@@ -80,6 +80,29 @@ func (rpc *RpcConnectPush) PushSingleMsg(ctx context.Context, pushMsgReq *proto2
 	return
 }
 
+// 踢出房间：连接退订这个房间，再把通知推给被踢的用户，连接不断
+func (rpc *RpcConnectPush) KickUser(ctx context.Context, kickReq *proto2.KickUserRequest, successReply *proto2.SuccessReply) (err error) {
+	logrus.Infof("rpc KickUser :%+v", kickReq)
+	if kickReq == nil {
+		logrus.Errorf("rpc KickUser() args:(%v)", kickReq)
+		return
+	}
+	// 桶按用户分，这个用户的连接都在同一个桶里；bucket.chs 只记最新连接，所以从房间里按用户找全
+	bucket := DefaultServer.Bucket(kickReq.UserId)
+	if room := bucket.Room(kickReq.RoomId); room != nil {
+		for _, channel := range room.UserChannels(kickReq.UserId) {
+			bucket.LeaveRoom(kickReq.RoomId, channel)
+			DefaultServer.clearTyping(channel, kickReq.RoomId)
+			if err = channel.Push(&kickReq.Msg); err != nil {
+				logrus.Warnf("KickUser push notice err:%s", err.Error())
+			}
+		}
+	}
+	successReply.Code = config.SuccessReplyCode
+	successReply.Msg = config.SuccessReplyMsg
+	return
+}
+
 // 群聊消息推送
 func (rpc *RpcConnectPush) PushRoomMsg(ctx context.Context, pushRoomMsgReq *proto2.PushRoomMsgRequest, successReply *proto2.SuccessReply) (err error) {
 	successReply.Code = config.SuccessReplyCode
@@ -8,7 +8,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/smallnest/rpcx/client"
 	"gochat/config"
+	"gochat/internal/pkg/authtoken"
 	"gochat/internal/proto"
+	"gochat/internal/tools"
 	"time"
 )
 
@@ -60,24 +62,113 @@ type RpcConnect struct {
 }
 
 // 加入房间（rpc调用logic层connect方法，logic初始化时已注册进etcd）
-func (rpc *RpcConnect) Connect(connReq *proto.ConnectRequest) (uid int, err error) {
+func (rpc *RpcConnect) Connect(connReq *proto.ConnectRequest) (uid int, seat proto.RoomSeat, err error) {
 	reply := &proto.ConnectReply{}
 
+	// 签名 token 模式先本地验签，无效的 token 不用再走一趟 logic
+	if config.Conf.Api.ApiAuth.IsTokenMode() {
+		if _, err = tools.VerifyAccessToken(connReq.AuthToken); err == authtoken.ErrTokenExpired {
+			return 0, seat, ErrSessionExpired
+		} else if err != nil {
+			logrus.Infof("connect verify access token fail:%s", err.Error())
+			return 0, seat, nil
+		}
+	}
+
 	// 调用logic层的Connect方法，其实就是加入房间
 	err = logicRpcClient.Call(context.Background(), "Connect", connReq, reply)
 	if err != nil {
-		logrus.Fatalf("failed to call: %v", err)
+		logrus.Errorf("connect call logic fail: %v", err)
+		return 0, seat, err
+	}
+	if reply.Code == config.SessionExpiredCode {
+		return 0, seat, ErrSessionExpired
+	}
+	if reply.Code == config.PermissionDeniedCode {
+		return 0, seat, ErrPermissionDenied
+	}
+	if reply.Code == config.RoomNotFoundCode {
+		return 0, seat, ErrRoomNotFound
+	}
+	if reply.Code == config.RoomFullCode {
+		return 0, seat, ErrRoomFull
 	}
 	uid = reply.UserId
+	seat = reply.Seat
 	logrus.Infof("connect logic userId :%d", reply.UserId)
 	return
 }
 
+// 连接入桶以后取走离线消息
+func (rpc *RpcConnect) TakeOffline(userId int) (offline []proto.OfflineMsg, err error) {
+	reply := &proto.TakeOfflineReply{}
+	if err = logicRpcClient.Call(context.Background(), "TakeOffline", &proto.TakeOfflineRequest{UserId: userId}, reply); err != nil {
+		logrus.Errorf("connect call logic TakeOffline fail: %v", err)
+		return
+	}
+	offline = reply.Offline
+	return
+}
+
 // 离开房间（rpc调用logic层disconnect方法，logic初始化时已注册进etcd）
 func (rpc *RpcConnect) DisConnect(disConnReq *proto.DisConnectRequest) (err error) {
 	reply := &proto.DisConnectReply{}
 	if err = logicRpcClient.Call(context.Background(), "DisConnect", disConnReq, reply); err != nil {
-		logrus.Fatalf("failed to call: %v", err)
+		logrus.Errorf("failed to call: %v", err)
+	}
+	return
+}
+
+// 已建连的连接再进一个房间，码的处理和 Connect 一样
+func (rpc *RpcConnect) JoinRoom(joinReq *proto.JoinRoomRequest) (userId int, room proto.RoomState, err error) {
+	reply := &proto.JoinRoomReply{}
+	if err = logicRpcClient.Call(context.Background(), "JoinRoom", joinReq, reply); err != nil {
+		logrus.Errorf("connect call logic JoinRoom fail: %v", err)
+		return
+	}
+	switch reply.Code {
+	case config.SessionExpiredCode:
+		err = ErrSessionExpired
+	case config.PermissionDeniedCode:
+		err = ErrPermissionDenied
+	case config.RoomNotFoundCode:
+		err = ErrRoomNotFound
+	case config.RoomFullCode:
+		err = ErrRoomFull
+	case config.SuccessReplyCode:
+		userId = reply.UserId
+		room = reply.Room
+	default:
+		err = errors.New("join room fail")
+	}
+	return
+}
+
+// 离开一个房间
+func (rpc *RpcConnect) LeaveRoom(leaveReq *proto.DisConnectRequest) (err error) {
+	reply := &proto.SuccessReply{}
+	if err = logicRpcClient.Call(context.Background(), "LeaveRoom", leaveReq, reply); err != nil {
+		logrus.Errorf("connect call logic LeaveRoom fail: %v", err)
+	}
+	return
+}
+
+// 私信送达，logic 记下送达时间并给发信人推回执
+func (rpc *RpcConnect) Delivered(deliveredReq *proto.DeliveredRequest) (err error) {
+	reply := &proto.SuccessReply{}
+	if err = logicRpcClient.Call(context.Background(), "Delivered", deliveredReq, reply); err != nil {
+		logrus.Errorf("connect call logic Delivered fail: %v", err)
+	}
+	return
+}
+
+// 标记房间已读，返回令牌对应的用户
+func (rpc *RpcConnect) MarkRoomRead(readReq *proto.MarkRoomReadRequest) (userId int, err error) {
+	reply := &proto.MarkRoomReadReply{}
+	if err = logicRpcClient.Call(context.Background(), "MarkRoomRead", readReq, reply); err != nil {
+		logrus.Infof("connect call logic MarkRoomRead fail: %v", err)
+		return
 	}
+	userId = reply.UserId
 	return
 }
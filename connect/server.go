@@ -32,6 +32,10 @@ type ServerOptions struct {
 	ReadBufferSize  int           // 读缓冲
 	WriteBufferSize int           // 写缓冲
 	BroadcastSize   int           // 广播队列大小？？
+	AckTimeout      time.Duration // 开了 ack 的连接，消息多久没确认就重发
+	AckMaxRetry     int           // 最多重发几次
+	TypingInterval  time.Duration // 同一个连接在同一个房间，「正在输入」最多这么久转发一次
+	TypingTtl       time.Duration // 「正在输入」多久没刷新就当停了
 }
 
 // 用筒子数量 rpc操作符 服务器设置 来初始化服务器
@@ -14,6 +14,7 @@ import (
 	"gochat/config"
 	"gochat/internal/pkg/stickpackage"
 	"gochat/internal/proto"
+	"gochat/internal/tools"
 	"net"
 	"strings"
 	"time"
@@ -21,10 +22,6 @@ import (
 
 const maxInt = 1<<31 - 1
 
-func init() {
-	rpc.InitLogicRpcClient()
-}
-
 func (c *Connect) InitTcpServer() error {
 	// 解析绑定多个地址
 	aTcpAddr := strings.Split(config.Conf.Connect.ConnectTcp.Bind, ",")
@@ -110,23 +107,15 @@ func (c *Connect) readDataFromTcp(s *Server, ch *Channel) {
 	defer func() {
 		// 连接断开时的清理逻辑
 		logrus.Infof("start exec disConnect ...")
-		if ch.Room == nil || ch.userId == 0 {
-			logrus.Infof("roomId and userId eq 0")
+		if ch.userId == 0 {
+			logrus.Infof("userId eq 0")
 			_ = ch.connTcp.Close()
 			return
 		}
 		logrus.Infof("exec disConnect ...")
-		disConnectRequest := new(proto.DisConnectRequest)
-		disConnectRequest.RoomId = ch.Room.Id
-		disConnectRequest.UserId = ch.userId
-
-		// 筒子中删掉这个ch
-		s.Bucket(ch.userId).DeleteChannel(ch)
 
-		// rpc代理处理离开房间
-		if err := s.operator.DisConnect(disConnectRequest); err != nil {
-			logrus.Warnf("DisConnect rpc err :%s", err.Error())
-		}
+		// 筒子中删掉这个ch，rpc代理处理离开房间，订阅的每个房间都要离开
+		s.disConnect(ch, c.ServerId)
 		if err := ch.connTcp.Close(); err != nil {
 			logrus.Warnf("DisConnect close tcp conn err :%s", err.Error())
 		}
@@ -187,6 +176,13 @@ func (c *Connect) readDataFromTcp(s *Server, ch *Channel) {
 				break
 			}
 			logrus.Infof("json unmarshal,raw tcp msg is:%+v", rawTcpMsg)
+			// 确认收到一条消息，不用带 authToken 和 roomId
+			if rawTcpMsg.Op == config.OpAck {
+				if ch.userId != 0 {
+					s.ack(ch, rawTcpMsg.SeqId)
+				}
+				continue
+			}
 			if rawTcpMsg.AuthToken == "" {
 				logrus.Errorf("tcp s.operator.Connect no authToken")
 				return
@@ -204,8 +200,28 @@ func (c *Connect) readDataFromTcp(s *Server, ch *Channel) {
 				connReq.ServerId = c.ServerId
 
 				// 加入房间，其实就是rpc调用logic注册的服务
-				userId, err := s.operator.Connect(&connReq)
+				userId, seat, err := s.operator.Connect(&connReq)
 				logrus.Infof("tcp s.operator.Connect userId is :%d", userId)
+				if err == ErrSessionExpired {
+					logrus.Infof("tcp session expired")
+					c.writeTcpCode(ch, tools.CodeSessionExpired)
+					return
+				}
+				if err == ErrPermissionDenied {
+					logrus.Infof("tcp join room %d permission denied", connReq.RoomId)
+					c.writeTcpCode(ch, tools.CodeForbidden)
+					return
+				}
+				if err == ErrRoomNotFound {
+					logrus.Infof("tcp join room %d not found", connReq.RoomId)
+					c.writeTcpCode(ch, tools.CodeRoomNotFound)
+					return
+				}
+				if err == ErrRoomFull {
+					logrus.Infof("tcp join room %d full", connReq.RoomId)
+					c.writeTcpCode(ch, tools.CodeRoomFull)
+					return
+				}
 				if err != nil {
 					logrus.Errorf("tcp s.operator.Connect error %s", err.Error())
 					return
@@ -215,6 +231,9 @@ func (c *Connect) readDataFromTcp(s *Server, ch *Channel) {
 					return
 				}
 
+				// 入桶之前打开，之后推来的消息都能记下
+				ch.enableAck(rawTcpMsg.Ack)
+				ch.setRoomSeat(connReq.RoomId, seat, time.Now())
 				// 这是入桶吗？
 				b := s.Bucket(userId)
 				//insert into a bucket
@@ -224,19 +243,56 @@ func (c *Connect) readDataFromTcp(s *Server, ch *Channel) {
 					_ = ch.connTcp.Close()
 					return
 				}
+				s.flushOffline(ch)
+			case config.OpTyping:
+				if ch.userId == 0 {
+					logrus.Errorf("tcp typing before build conn")
+					return
+				}
+				s.Typing(ch, rawTcpMsg.RoomId, rawTcpMsg.Typing)
+			case config.OpReadRoom:
+				if ch.userId == 0 {
+					logrus.Errorf("tcp read room before build conn")
+					return
+				}
+				s.ReadRoom(ch, rawTcpMsg.RoomId, rawTcpMsg.MessageId, rawTcpMsg.AuthToken)
+			case config.OpJoinRoom, config.OpLeaveRoom, config.OpSwitchRoom:
+				// 建连以后进出房间、换房间，不用重连
+				if ch.userId == 0 {
+					logrus.Errorf("tcp room op before build conn")
+					return
+				}
+				if err := s.RoomOp(ch, c.ServerId, rawTcpMsg.Op, rawTcpMsg.RoomId, rawTcpMsg.AuthToken); err == ErrSessionExpired {
+					logrus.Infof("tcp session expired")
+					c.writeTcpCode(ch, tools.CodeSessionExpired)
+					return
+				}
 			case config.OpRoomSend:
+				// 发送者以建连时认证出来的用户为准，不信任包里带的 fromUserId
+				if ch.userId == 0 {
+					logrus.Errorf("tcp room send before build conn")
+					return
+				}
 				//send tcp msg to room
 				req := &proto.Send{
 					Msg:          rawTcpMsg.Msg,
-					FromUserId:   rawTcpMsg.FromUserId,
+					FromUserId:   ch.userId,
 					FromUserName: rawTcpMsg.FromUserName,
 					RoomId:       rawTcpMsg.RoomId,
 					Op:           config.OpRoomSend,
 				}
 
 				// 这个rpc为什么是api层中的rpc实例？调用的还是logic在etcd中注册的服务
-				code, msg := rpc.RpcLogicObj.PushRoom(req)
+				code, retryAfter, msg := rpc.RpcLogicObj.PushRoom(req)
 				logrus.Infof("tcp conn push msg to room,err code is:%d,err msg is:%s", code, msg)
+				if code == config.RateLimitedCode {
+					body, _ := json.Marshal(proto.PushRoomReply{
+						Code:       tools.CodeTooManyRequests,
+						Msg:        msg,
+						RetryAfter: retryAfter,
+					})
+					c.writeTcpBody(ch, body)
+				}
 			}
 		}
 		// 读到了一个空包EOF
@@ -251,9 +307,12 @@ func (c *Connect) writeDataToTcp(s *Server, ch *Channel) {
 	//ping time default 54s
 	// 心跳间隔创建了一个计时器？
 	ticker := time.NewTicker(DefaultServer.Options.PingPeriod)
+	// 没确认的消息按这个间隔检查要不要重发
+	ackTicker := time.NewTicker(s.Options.AckTimeout)
 	defer func() {
 		// 计时器停止，然后关闭套接字
 		ticker.Stop()
+		ackTicker.Stop()
 		_ = ch.connTcp.Close()
 		return
 	}()
@@ -269,7 +328,7 @@ func (c *Connect) writeDataToTcp(s *Server, ch *Channel) {
 				_ = ch.connTcp.Close()
 				return
 			}
-			pack.Msg = message.Body
+			pack.Msg = ch.frame(message)
 			pack.Length = pack.GetPackageLength()
 			//send msg
 			logrus.Infof("send tcp msg to conn:%s", pack.String())
@@ -281,6 +340,8 @@ func (c *Connect) writeDataToTcp(s *Server, ch *Channel) {
 				logrus.Errorf("connTcp.write message err:%s", err.Error())
 				return
 			}
+		case <-ackTicker.C:
+			ch.redeliver(s.Options.AckTimeout, s.Options.AckMaxRetry)
 		case <-ticker.C: // 这是心跳保活，发ping msg，但是是发给谁的呢？
 			// 也许是发给与服务器建立连接的客户端的，确认客户端是否存活吗？那么就还差 pong
 			logrus.Infof("connTcp.ping message,send")
@@ -294,3 +355,28 @@ func (c *Connect) writeDataToTcp(s *Server, ch *Channel) {
 		}
 	}
 }
+
+// 会话过期、房间不存在等状态码通知
+func (c *Connect) writeTcpCode(ch *Channel, code int) {
+	body, _ := json.Marshal(proto.SuccessReply{
+		Code: code,
+		Msg:  tools.MsgCodeMap[code],
+	})
+	c.writeTcpBody(ch, body)
+}
+
+// 整包写进一个 buffer 再一次性写出去，避免和写协程的心跳包交错
+func (c *Connect) writeTcpBody(ch *Channel, body []byte) {
+	pack := stickpackage.StickPackage{
+		Version: stickpackage.VersionContent,
+		Msg:     body,
+	}
+	pack.Length = pack.GetPackageLength()
+	buf := new(bytes.Buffer)
+	if err := pack.Pack(buf); err != nil {
+		return
+	}
+	if _, err := ch.connTcp.Write(buf.Bytes()); err != nil {
+		logrus.Warnf("tcp write reply err:%s", err.Error())
+	}
+}
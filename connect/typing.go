@@ -0,0 +1,163 @@
+package connect
+
+import (
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"time"
+)
+
+// 正在输入：客户端发 config.OpTyping，connect 发布到 redis 的 config.TypingChannel，
+// 每个 connect 都订阅这个频道，收到后用 Bucket.BroadcastRoom 推给本机房间里的其他连接；
+// 不过 logic、不进 kafka、不存历史，量大，丢了也无所谓；redis 不可用时退回只推本机
+// 同一个连接在同一个房间 TypingInterval 内最多转发一次「正在输入」，停止输入马上转发；
+// 通知带上 ttl，客户端过了 ttl 没再收到就当停了；离开房间、断开连接时还在输入的补发一条停止
+
+// 进房间时记下座位：观众、被禁言的不能发言，也不转发他们的「正在输入」；
+// 进房间以后才被禁言的，要等重新进房间才拦得住
+func (ch *Channel) setRoomSeat(roomId int, seat proto.RoomSeat, now time.Time) {
+	ch.typingLock.Lock()
+	defer ch.typingLock.Unlock()
+	delete(ch.spectating, roomId)
+	delete(ch.mutedUntil, roomId)
+	if seat.Spectator {
+		ch.spectating[roomId] = true
+	}
+	if seat.MutedFor > 0 {
+		ch.mutedUntil[roomId] = now.Add(time.Duration(seat.MutedFor) * time.Second)
+	}
+}
+
+// 观众不能输入，禁言到期以后可以
+func (ch *Channel) canType(roomId int, now time.Time) bool {
+	ch.typingLock.Lock()
+	defer ch.typingLock.Unlock()
+	if ch.spectating[roomId] {
+		return false
+	}
+	if until, ok := ch.mutedUntil[roomId]; ok {
+		if now.Before(until) {
+			return false
+		}
+		delete(ch.mutedUntil, roomId)
+	}
+	return true
+}
+
+// 记下开始输入，还在节流时间内返回 false
+func (ch *Channel) startTyping(roomId int, now time.Time, interval time.Duration) bool {
+	ch.typingLock.Lock()
+	defer ch.typingLock.Unlock()
+	if last, ok := ch.typing[roomId]; ok && now.Sub(last) < interval {
+		return false
+	}
+	ch.typing[roomId] = now
+	return true
+}
+
+// 停止输入，之前的「正在输入」还没过期才需要通知别人
+func (ch *Channel) stopTyping(roomId int, now time.Time, ttl time.Duration) bool {
+	ch.typingLock.Lock()
+	defer ch.typingLock.Unlock()
+	last, ok := ch.typing[roomId]
+	delete(ch.typing, roomId)
+	return ok && now.Sub(last) < ttl
+}
+
+// 客户端开始或停止输入
+func (s *Server) Typing(ch *Channel, roomId int, typing bool) {
+	if !ch.InRoom(roomId) {
+		return
+	}
+	now := time.Now()
+	if typing {
+		if !ch.canType(roomId, now) || !ch.startTyping(roomId, now, s.Options.TypingInterval) {
+			return
+		}
+	} else if !ch.stopTyping(roomId, now, s.Options.TypingTtl) {
+		return
+	}
+	s.broadcastTyping(ch.userId, roomId, typing)
+}
+
+// 离开房间时还在输入的，告诉别人停了
+func (s *Server) clearTyping(ch *Channel, roomId int) {
+	if ch.stopTyping(roomId, time.Now(), s.Options.TypingTtl) {
+		s.broadcastTyping(ch.userId, roomId, false)
+	}
+}
+
+// 房间里的连接按用户分在不同的桶里，每个桶都要推；不推给输入的人自己
+func (s *Server) broadcastTyping(userId int, roomId int, typing bool) {
+	body, err := json.Marshal(proto.TypingNotice{
+		Op:     config.OpTyping,
+		RoomId: roomId,
+		UserId: userId,
+		Typing: typing,
+		Ttl:    int(s.Options.TypingTtl / time.Second),
+	})
+	if err != nil {
+		logrus.Warnf("marshal typing notice err:%s", err.Error())
+		return
+	}
+	pushRoomMsgReq := &proto.PushRoomMsgRequest{
+		RoomId:       roomId,
+		ExceptUserId: userId,
+		Msg: proto.Msg{
+			Ver:       config.MsgVersion,
+			Operation: config.OpTyping,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      body,
+		},
+	}
+	if typingRedisClient != nil {
+		payload, err := json.Marshal(pushRoomMsgReq)
+		if err == nil {
+			err = typingRedisClient.Publish(config.TypingChannel, payload).Err()
+		}
+		if err == nil {
+			return
+		}
+		logrus.Warnf("publish typing notice err:%s", err.Error())
+	}
+	s.broadcastRoomLocal(pushRoomMsgReq)
+}
+
+func (s *Server) broadcastRoomLocal(pushRoomMsgReq *proto.PushRoomMsgRequest) {
+	for _, bucket := range s.Buckets {
+		bucket.BroadcastRoom(pushRoomMsgReq)
+	}
+}
+
+var typingRedisClient *redis.Client
+
+// 连上 redis 并订阅正在输入频道，别的 connect 发的通知也从这里进来
+func (c *Connect) InitTypingRedisClient() (err error) {
+	redisOpt := tools.RedisOption{
+		Address:  config.Conf.Common.CommonRedis.RedisAddress,
+		Password: config.Conf.Common.CommonRedis.RedisPassword,
+		Db:       config.Conf.Common.CommonRedis.Db,
+	}
+	client := tools.GetRedisInstance(redisOpt)
+	pubSub := client.Subscribe(config.TypingChannel)
+	// 等订阅确认，redis 连不上就不用它
+	if _, err = pubSub.Receive(); err != nil {
+		pubSub.Close()
+		return
+	}
+	typingRedisClient = client
+	go func() {
+		for msg := range pubSub.Channel() {
+			pushRoomMsgReq := &proto.PushRoomMsgRequest{}
+			if err := json.Unmarshal([]byte(msg.Payload), pushRoomMsgReq); err != nil {
+				logrus.Warnf("unmarshal typing notice err:%s", err.Error())
+				continue
+			}
+			DefaultServer.broadcastRoomLocal(pushRoomMsgReq)
+		}
+	}()
+	return
+}
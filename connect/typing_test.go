@@ -0,0 +1,76 @@
+package connect
+
+import (
+	"gochat/internal/proto"
+	"testing"
+	"time"
+)
+
+func Test_StartStopTyping(t *testing.T) {
+	ch := NewChannel(1)
+	base := time.Unix(1000, 0)
+	interval, ttl := 3*time.Second, 6*time.Second
+	// 按顺序在同一个连接上跑，at 是距离 base 的时间
+	cases := []struct {
+		name   string
+		start  bool
+		roomId int
+		at     time.Duration
+		want   bool
+	}{
+		{"start", true, 1, 0, true},
+		{"throttled", true, 1, time.Second, false},
+		{"other room not throttled", true, 2, time.Second, true},
+		{"after interval", true, 1, 3 * time.Second, true},
+		{"stop", false, 1, 4 * time.Second, true},
+		{"stop again", false, 1, 4 * time.Second, false},
+		{"start after stop", true, 1, 5 * time.Second, true},
+		{"stop after ttl", false, 1, 11 * time.Second, false},
+		{"stop never started", false, 3, 11 * time.Second, false},
+		{"stop other room within ttl", false, 2, 6 * time.Second, true},
+	}
+	for _, c := range cases {
+		var got bool
+		if c.start {
+			got = ch.startTyping(c.roomId, base.Add(c.at), interval)
+		} else {
+			got = ch.stopTyping(c.roomId, base.Add(c.at), ttl)
+		}
+		if got != c.want {
+			t.Fatalf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func Test_CanType(t *testing.T) {
+	base := time.Unix(1000, 0)
+	cases := []struct {
+		name string
+		seat proto.RoomSeat
+		at   time.Duration
+		want bool
+	}{
+		{"normal seat", proto.RoomSeat{}, 0, true},
+		{"spectator", proto.RoomSeat{Spectator: true}, 0, false},
+		{"spectator later", proto.RoomSeat{Spectator: true}, time.Hour, false},
+		{"muted", proto.RoomSeat{MutedFor: 60}, 59 * time.Second, false},
+		{"mute expired", proto.RoomSeat{MutedFor: 60}, 60 * time.Second, true},
+	}
+	for _, c := range cases {
+		ch := NewChannel(1)
+		ch.setRoomSeat(1, c.seat, base)
+		if got := ch.canType(1, base.Add(c.at)); got != c.want {
+			t.Fatalf("%s: got %v want %v", c.name, got, c.want)
+		}
+		if !ch.canType(2, base) {
+			t.Fatalf("%s: other room should not be limited", c.name)
+		}
+	}
+	// 重新进房间按新的座位算
+	ch := NewChannel(1)
+	ch.setRoomSeat(1, proto.RoomSeat{Spectator: true}, base)
+	ch.setRoomSeat(1, proto.RoomSeat{}, base)
+	if !ch.canType(1, base) {
+		t.Fatal("rejoin with a seat should clear spectator")
+	}
+}
@@ -11,10 +11,19 @@ import (
 	"github.com/sirupsen/logrus"
 	"gochat/config"
 	"gochat/internal/proto"
+	"gochat/internal/tools"
 	"net/http"
 	"time"
 )
 
+// 4000-4999 是留给应用自己用的关闭码
+const (
+	wsCloseSessionExpired = 4001
+	wsCloseForbidden      = 4003
+	wsCloseRoomNotFound   = 4004
+	wsCloseRoomFull       = 4009
+)
+
 func (c *Connect) InitWebsocket() error {
 	// 注册ws路由
 	// 这个默认Server是connect.go 里面的，初始化的时候把他初始化了，connect是个铁废物，只知道依靠别人
@@ -72,8 +81,11 @@ func (c *Connect) serveWs(server *Server, w http.ResponseWriter, r *http.Request
 func (s *Server) writePump(ch *Channel, c *Connect) {
 	//PingPeriod default eq 54s
 	ticker := time.NewTicker(s.Options.PingPeriod)
+	// 没确认的消息按这个间隔检查要不要重发
+	ackTicker := time.NewTicker(s.Options.AckTimeout)
 	defer func() {
 		ticker.Stop()
+		ackTicker.Stop()
 		ch.conn.Close()
 	}()
 	// 1.变化：没有打包发送？
@@ -91,14 +103,16 @@ func (s *Server) writePump(ch *Channel, c *Connect) {
 			// 消息分帧？
 			w, err := ch.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
-				logrus.Warn(" ch.conn.NextWriter err :%s  ", err.Error())
+				logrus.Warnf(" ch.conn.NextWriter err :%s  ", err.Error())
 				return
 			}
 			logrus.Infof("message write body:%s", message.Body)
-			w.Write(message.Body)
+			w.Write(ch.frame(message))
 			if err := w.Close(); err != nil {
 				return
 			}
+		case <-ackTicker.C:
+			ch.redeliver(s.Options.AckTimeout, s.Options.AckMaxRetry)
 		case <-ticker.C:
 			//heartbeat，if ping error will exit and close current websocket conn
 			ch.conn.SetWriteDeadline(time.Now().Add(s.Options.WriteWait))
@@ -122,19 +136,14 @@ func (s *Server) writePump(ch *Channel, c *Connect) {
 func (s *Server) readPump(ch *Channel, c *Connect) {
 	defer func() {
 		logrus.Infof("start exec disConnect ...")
-		if ch.Room == nil || ch.userId == 0 {
-			logrus.Infof("roomId and userId eq 0")
+		if ch.userId == 0 {
+			logrus.Infof("userId eq 0")
 			ch.conn.Close()
 			return
 		}
 		logrus.Infof("exec disConnect ...")
-		disConnectRequest := new(proto.DisConnectRequest)
-		disConnectRequest.RoomId = ch.Room.Id
-		disConnectRequest.UserId = ch.userId
-		s.Bucket(ch.userId).DeleteChannel(ch)
-		if err := s.operator.DisConnect(disConnectRequest); err != nil {
-			logrus.Warnf("DisConnect err :%s", err.Error())
-		}
+		// 订阅的每个房间都要离开
+		s.disConnect(ch, c.ServerId)
 		ch.conn.Close()
 	}()
 
@@ -164,12 +173,75 @@ func (s *Server) readPump(ch *Channel, c *Connect) {
 		if err := json.Unmarshal([]byte(message), &connReq); err != nil {
 			logrus.Errorf("message struct %+v", connReq)
 		}
-		if connReq == nil || connReq.AuthToken == "" {
+		if connReq == nil {
+			logrus.Errorf("s.operator.Connect empty message")
+			return
+		}
+		// 确认收到一条消息
+		if connReq.Op == config.OpAck {
+			if ch.userId != 0 {
+				s.ack(ch, connReq.SeqId)
+			}
+			continue
+		}
+		// 正在输入，只在本机推，量大不走 logic
+		if connReq.Op == config.OpTyping {
+			if ch.userId != 0 {
+				s.Typing(ch, connReq.RoomId, connReq.Typing)
+			}
+			continue
+		}
+		// 标记房间已读
+		if connReq.Op == config.OpReadRoom {
+			if ch.userId != 0 {
+				s.ReadRoom(ch, connReq.RoomId, connReq.MessageId, connReq.AuthToken)
+			}
+			continue
+		}
+		// 已经建过连接的，后面的消息是进出房间；老客户端会重复发建连消息，当成进房间处理
+		if ch.userId != 0 {
+			op := connReq.Op
+			if op == 0 {
+				op = config.OpJoinRoom
+			}
+			if err := s.RoomOp(ch, c.ServerId, op, connReq.RoomId, connReq.AuthToken); err == ErrSessionExpired {
+				closeMsg := websocket.FormatCloseMessage(wsCloseSessionExpired, tools.MsgCodeMap[tools.CodeSessionExpired])
+				_ = ch.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.Options.WriteWait))
+				return
+			}
+			continue
+		}
+		if connReq.AuthToken == "" {
 			logrus.Errorf("s.operator.Connect no authToken")
 			return
 		}
 		connReq.ServerId = c.ServerId //config.Conf.Connect.ConnectWebsocket.ServerId
-		userId, err := s.operator.Connect(connReq)
+		userId, seat, err := s.operator.Connect(connReq)
+		if err == ErrSessionExpired {
+			// WriteControl 可以和写协程并发调用，直接发关闭帧带上过期码
+			logrus.Infof("websocket session expired")
+			closeMsg := websocket.FormatCloseMessage(wsCloseSessionExpired, tools.MsgCodeMap[tools.CodeSessionExpired])
+			_ = ch.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.Options.WriteWait))
+			return
+		}
+		if err == ErrPermissionDenied {
+			logrus.Infof("websocket join room %d permission denied", connReq.RoomId)
+			closeMsg := websocket.FormatCloseMessage(wsCloseForbidden, tools.MsgCodeMap[tools.CodeForbidden])
+			_ = ch.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.Options.WriteWait))
+			return
+		}
+		if err == ErrRoomNotFound {
+			logrus.Infof("websocket join room %d not found", connReq.RoomId)
+			closeMsg := websocket.FormatCloseMessage(wsCloseRoomNotFound, tools.MsgCodeMap[tools.CodeRoomNotFound])
+			_ = ch.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.Options.WriteWait))
+			return
+		}
+		if err == ErrRoomFull {
+			logrus.Infof("websocket join room %d full", connReq.RoomId)
+			closeMsg := websocket.FormatCloseMessage(wsCloseRoomFull, tools.MsgCodeMap[tools.CodeRoomFull])
+			_ = ch.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.Options.WriteWait))
+			return
+		}
 		if err != nil {
 			logrus.Errorf("s.operator.Connect error %s", err.Error())
 			return
@@ -179,6 +251,10 @@ func (s *Server) readPump(ch *Channel, c *Connect) {
 			return
 		}
 		logrus.Infof("websocket rpc call return userId:%d,RoomId:%d", userId, connReq.RoomId)
+		ch.authToken = connReq.AuthToken
+		// 入桶之前打开，之后推来的消息都能记下
+		ch.enableAck(connReq.Ack)
+		ch.setRoomSeat(connReq.RoomId, seat, time.Now())
 		// 我们取一个Server管理的筒子，然后把连接放进去
 		b := s.Bucket(userId)
 		//insert into a bucket
@@ -186,6 +262,8 @@ func (s *Server) readPump(ch *Channel, c *Connect) {
 		if err != nil {
 			logrus.Errorf("conn close err: %s", err.Error())
 			ch.conn.Close()
+			continue
 		}
+		s.flushOffline(ch)
 	}
 }
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/websocket"
-	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -15,15 +14,25 @@ import (
 	"time"
 )
 
+// 和服务端 config.OpJoinRoom / config.OpLeaveRoom / config.OpSwitchRoom / config.OpRoomKick / config.OpRoomMetaSend 对应
+const (
+	opJoinRoom     = 7
+	opLeaveRoom    = 8
+	opSwitchRoom   = 9
+	opRoomKick     = 10
+	opRoomMetaSend = 11
+)
+
 const (
 	apiHost = "http://localhost:7070"  // 后端API地址
 	wsHost  = "ws://localhost:7000/ws" // WebSocket地址
 )
 
 var (
-	authToken   = "" // 认证令牌
-	roomID      = 1  // 默认房间ID
-	currentUser = "" // 当前登录用户名（用于自我高亮）
+	authToken   = ""       // 认证令牌
+	roomID      = 1        // 当前房间ID，发消息、拉历史用这个
+	joinedRooms = []int{1} // 这个连接订阅的所有房间，以服务端回的为准
+	currentUser = ""       // 当前登录用户名（用于自我高亮）
 	wsConn      *websocket.Conn
 )
 
@@ -205,6 +214,8 @@ func enterChatRoom() {
 		return
 	}
 
+	joinedRooms = []int{roomID}
+
 	header(roomID)
 	loadHistory(50) // <<< 新增：初始拉取 50 条历史
 
@@ -225,12 +236,38 @@ func enterChatRoom() {
 		case cmd == "/users":
 			triggerRoomInfo()
 		case strings.HasPrefix(cmd, "/room "):
-			id := stringsTrim(strings.TrimPrefix(cmd, "/room "))
-			if id == "" {
+			// 只切换当前发言的房间，要先 /join
+			id, err := strconv.Atoi(stringsTrim(strings.TrimPrefix(cmd, "/room ")))
+			if err != nil || id <= 0 {
 				printWarn("用法: /room <房间ID>")
+			} else if !inRoom(id) {
+				printWarn("还没加入房间 #%d，先 /join %d", id, id)
 			} else {
-				printWarn("当前示例客户端只在启动时加入房间。要切换房间，请重进。")
+				roomID = id
+				printOk("当前房间切换到 #%d", roomID)
+			}
+		case strings.HasPrefix(cmd, "/join "), strings.HasPrefix(cmd, "/leave "), strings.HasPrefix(cmd, "/switch "):
+			fields := strings.Fields(cmd)
+			id := 0
+			if len(fields) >= 2 {
+				id, _ = strconv.Atoi(fields[1])
 			}
+			if id <= 0 {
+				printWarn("用法: /join <房间ID>、/leave <房间ID> 或 /switch <房间ID>")
+				break
+			}
+			op := opJoinRoom
+			switch fields[0] {
+			case "/leave":
+				op = opLeaveRoom
+			case "/switch":
+				op = opSwitchRoom
+			}
+			if err := conn.WriteJSON(map[string]interface{}{"op": op, "roomId": id}); err != nil {
+				printErr("发送失败: %v", err)
+			}
+		case cmd == "/rooms":
+			printSystem("已加入房间：%v，当前房间 #%d", joinedRooms, roomID)
 		case strings.HasPrefix(cmd, "/history"):
 			// /history 或 /history 100
 			fields := strings.Fields(cmd)
@@ -256,6 +293,11 @@ func enterChatRoom() {
 			fmt.Println()
 			fmt.Println("可用命令：")
 			fmt.Println("  /users            查看在线用户（由服务端通过 WS 推送）")
+			fmt.Println("  /join <ID>        同一个连接再加入一个房间")
+			fmt.Println("  /leave <ID>       离开一个房间")
+			fmt.Println("  /switch <ID>      换到另一个房间，同时离开其他房间")
+			fmt.Println("  /room <ID>        切换当前发言的房间（需已加入）")
+			fmt.Println("  /rooms            查看已加入的房间")
 			fmt.Println("  /history [N]      拉取最近 N 条历史（默认 50，最大 500）")
 			fmt.Println("  /sum [N]          让 AI 总结最近 N 条历史（默认 120，最大 500）")
 			fmt.Println("  /exit             退出聊天室")
@@ -336,6 +378,97 @@ func receiveMessages(conn *websocket.Conn, done chan struct{}) {
 			} else {
 				printSystem("用户列表已更新")
 			}
+		case opJoinRoom, opLeaveRoom, opSwitchRoom: // 进出房间的结果
+			var reply struct {
+				RoomId  int    `json:"roomId"`
+				Code    int    `json:"code"`
+				Msg     string `json:"msg"`
+				RoomIds []int  `json:"roomIds"`
+				Room    *struct {
+					Name        string `json:"name"`
+					OnlineCount int    `json:"onlineCount"`
+					Spectator   bool   `json:"spectator"`
+					RoomMeta
+				} `json:"room"`
+			}
+			if err := json.Unmarshal(payload, &reply); err != nil {
+				printErr("消息解析错误: %v", err)
+				break
+			}
+			if reply.Code != 0 {
+				printErr("房间 #%d 操作失败：%s", reply.RoomId, reply.Msg)
+				break
+			}
+			joinedRooms = reply.RoomIds
+			switch op {
+			case opJoinRoom:
+				printOk("已加入房间 #%d，/room %d 切换过去发言", reply.RoomId, reply.RoomId)
+				if reply.Room != nil {
+					printSystem("房间 #%d %s，在线 %d 人", reply.RoomId, reply.Room.Name, reply.Room.OnlineCount)
+					printRoomMeta(reply.RoomId, reply.Room.RoomMeta)
+					if reply.Room.Spectator {
+						printSystem("房间 #%d 已满，你以观众身份进入，只能看不能发言", reply.RoomId)
+					}
+				}
+			case opSwitchRoom:
+				roomID = reply.RoomId
+				header(roomID)
+				if reply.Room != nil {
+					printSystem("房间 #%d %s，在线 %d 人", reply.RoomId, reply.Room.Name, reply.Room.OnlineCount)
+					printRoomMeta(reply.RoomId, reply.Room.RoomMeta)
+					if reply.Room.Spectator {
+						printSystem("房间 #%d 已满，你以观众身份进入，只能看不能发言", reply.RoomId)
+					}
+				}
+				loadHistory(50)
+			default:
+				printOk("已离开房间 #%d", reply.RoomId)
+				if reply.RoomId == roomID && len(joinedRooms) > 0 {
+					roomID = joinedRooms[0]
+					printSystem("当前房间切换到 #%d", roomID)
+				}
+			}
+		case opRoomMetaSend: // 话题、公告、置顶变了
+			var meta struct {
+				RoomId int `json:"roomId"`
+				RoomMeta
+			}
+			if err := json.Unmarshal(payload, &meta); err != nil {
+				printErr("消息解析错误: %v", err)
+				break
+			}
+			printSystem("房间 #%d 的话题、公告或置顶有更新", meta.RoomId)
+			printRoomMeta(meta.RoomId, meta.RoomMeta)
+		case opRoomKick: // 被踢出或封禁
+			var notice struct {
+				RoomId int    `json:"roomId"`
+				Reason string `json:"reason"`
+				Banned bool   `json:"banned"`
+			}
+			if err := json.Unmarshal(payload, &notice); err != nil {
+				printErr("消息解析错误: %v", err)
+				break
+			}
+			action := "踢出"
+			if notice.Banned {
+				action = "封禁"
+			}
+			if notice.Reason != "" {
+				printWarn("你被%s房间 #%d：%s", action, notice.RoomId, notice.Reason)
+			} else {
+				printWarn("你被%s房间 #%d", action, notice.RoomId)
+			}
+			left := make([]int, 0, len(joinedRooms))
+			for _, id := range joinedRooms {
+				if id != notice.RoomId {
+					left = append(left, id)
+				}
+			}
+			joinedRooms = left
+			if notice.RoomId == roomID && len(joinedRooms) > 0 {
+				roomID = joinedRooms[0]
+				printSystem("当前房间切换到 #%d", roomID)
+			}
 		default:
 			printSystem("事件 op=%d：%s", op, string(payload))
 		}
@@ -356,7 +489,19 @@ func sendRoomMessage(text string) {
 		return
 	}
 	defer resp.Body.Close()
-	io.Copy(io.Discard, resp.Body)
+	var result struct {
+		Code int `json:"code"`
+		Data struct {
+			RetryAfter int `json:"retryAfter"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return
+	}
+	// 慢速模式或者发得太快
+	if result.Code == 42900 {
+		printWarn("发言太快了，%d 秒后再试", result.Data.RetryAfter)
+	}
 }
 
 // 触发下发房间信息（数据走 WS）
@@ -539,7 +684,44 @@ func printChat(im *InnerMsg) {
 	} else {
 		nameTag = fmt.Sprintf("%s%s%s", fgYellow, name, reset)
 	}
-	fmt.Printf("\r%s %s │ %s\n", timeTag, nameTag, im.Msg)
+	// 不是当前房间的消息带上房间号
+	roomTag := ""
+	if im.RoomId != 0 && im.RoomId != roomID {
+		roomTag = fmt.Sprintf("%s#%d%s ", fgBlue, im.RoomId, reset)
+	}
+	fmt.Printf("\r%s %s%s │ %s\n", timeTag, roomTag, nameTag, im.Msg)
+}
+
+// 房间的话题、公告和置顶（对应服务端 proto.RoomMeta）
+type RoomMeta struct {
+	Topic        string `json:"topic"`
+	Announcement string `json:"announcement"`
+	Pins         []struct {
+		MessageId    int64  `json:"messageId"`
+		FromUserName string `json:"fromUserName"`
+		Content      string `json:"content"`
+	} `json:"pins"`
+}
+
+func printRoomMeta(room int, meta RoomMeta) {
+	if meta.Topic != "" {
+		fmt.Printf("\r%s[#%d 话题]%s %s\n", fgCyan, room, reset, meta.Topic)
+	}
+	if meta.Announcement != "" {
+		fmt.Printf("\r%s[#%d 公告]%s %s\n", fgYellow, room, reset, meta.Announcement)
+	}
+	for _, pin := range meta.Pins {
+		fmt.Printf("\r%s[置顶 %d]%s %s：%s\n", fgBlue, pin.MessageId, reset, pin.FromUserName, pin.Content)
+	}
+}
+
+func inRoom(id int) bool {
+	for _, joined := range joinedRooms {
+		if joined == id {
+			return true
+		}
+	}
+	return false
 }
 
 // —— 解码工具 —— //
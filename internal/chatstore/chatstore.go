@@ -14,12 +14,13 @@ import (
 
 type ChatMessage struct {
 	ID           int64     `gorm:"primaryKey;column:id"`
-	RoomID       int       `gorm:"column:room_id"`
+	RoomID       int       `gorm:"column:room_id;index:idx_chat_message_room_time,priority:1"`
 	FromUserID   int       `gorm:"column:from_user_id"`
 	FromUserName string    `gorm:"column:from_user_name"`
 	Content      string    `gorm:"column:content"`
 	Op           int       `gorm:"column:op"`
-	CreatedAt    time.Time `gorm:"column:created_at"` // 存 UTC（建议）
+	IsBot        bool      `gorm:"column:is_bot;not null;default:false"`                          // 机器人/AI 发的
+	CreatedAt    time.Time `gorm:"column:created_at;index:idx_chat_message_room_time,priority:2"` // 存 UTC（建议）
 }
 
 // =============== Store ===============
@@ -33,10 +34,15 @@ func New(db *gorm.DB) *Store {
 }
 
 func (s *Store) AutoMigrate() error {
-	if err := s.DB.AutoMigrate(&ChatMessage{}); err != nil {
-		return err
+	// 以前 idx_chat_message_room_time 建在手工建的 chat_message 表上，消息其实存在 chat_messages；
+	// sqlite 的索引名全库唯一，先删掉旧的，再跟着模型建到 chat_messages 上
+	m := s.DB.Migrator()
+	if m.HasIndex("chat_message", "idx_chat_message_room_time") {
+		if err := m.DropIndex("chat_message", "idx_chat_message_room_time"); err != nil {
+			return err
+		}
 	}
-	return s.DB.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_message_room_time ON chat_message(room_id, created_at)`).Error
+	return s.DB.AutoMigrate(&ChatMessage{}, &DirectConversation{}, &DirectMessage{}, &RoomReadMarker{})
 }
 
 // =============== 入库（房间消息） ===============
@@ -49,6 +55,7 @@ type RoomMsgPayload struct {
 	Op           int    `json:"op"`
 	CreateTime   string `json:"createTime"`  // "YYYY-MM-DD HH:MM:SS"（本地）
 	ClientMsgId  int64  `json:"clientMsgId"` // 建议由上游生成
+	IsBot        bool   `json:"isBot"`
 }
 
 // SaveRoomMsgRaw: 直接吃 Kafka/队列里的 JSON（和你现有结构对齐）
@@ -81,6 +88,7 @@ func (s *Store) SaveRoomMsg(p RoomMsgPayload) error {
 		FromUserName: p.FromUserName,
 		Content:      p.Msg,
 		Op:           p.Op,
+		IsBot:        p.IsBot,
 		CreatedAt:    ts,
 	}
 	// 幂等：主键冲突忽略
@@ -110,6 +118,7 @@ func (s *Store) SaveRoomMsgByBytes(raw []byte) error {
 		FromUserName: p.FromUserName,
 		Content:      p.Msg,
 		Op:           p.Op,
+		IsBot:        p.IsBot,
 		CreatedAt:    ts,
 	}
 	// 幂等：主键冲突就忽略
@@ -137,3 +146,29 @@ func (s *Store) ListRoomMessages(ctx context.Context, roomID, limit int) ([]Chat
 	}
 	return rows, nil
 }
+
+// 房间里 id 比 afterID 大的消息，按发送时间正序，最多 limit 条
+func (s *Store) ListRoomMessagesAfter(ctx context.Context, roomID int, afterID int64, limit int) ([]ChatMessage, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var rows []ChatMessage
+	err := s.DB.WithContext(ctx).
+		Where("room_id = ? AND id > ?", roomID, afterID).
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// 按 id 取房间里的消息，不是这个房间的不返回
+func (s *Store) GetRoomMessagesByIds(ctx context.Context, roomID int, ids []int64) ([]ChatMessage, error) {
+	var rows []ChatMessage
+	if len(ids) == 0 {
+		return rows, nil
+	}
+	err := s.DB.WithContext(ctx).
+		Where("room_id = ? AND id IN ?", roomID, ids).
+		Find(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,158 @@
+package chatstore
+
+import (
+	"context"
+	"gochat/internal/tools"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============== 模型（私信） ===============
+
+// 两个人之间的会话，一对用户只有一条，id 不会变；UserLow 总是较小的 user id
+type DirectConversation struct {
+	ID            int64     `gorm:"primaryKey;column:id"`
+	UserLow       int       `gorm:"column:user_low;not null;uniqueIndex:idx_dm_conversation_users"`
+	UserHigh      int       `gorm:"column:user_high;not null;uniqueIndex:idx_dm_conversation_users;index"`
+	LastMessageID int64     `gorm:"column:last_message_id;not null;default:0"`
+	LastMessageAt time.Time `gorm:"column:last_message_at;index"` // 存 UTC
+	CreatedAt     time.Time `gorm:"column:created_at"`
+}
+
+type DirectMessage struct {
+	ID             int64      `gorm:"primaryKey;column:id"`
+	ConversationID int64      `gorm:"column:conversation_id;not null;index:idx_dm_message_conversation"`
+	FromUserID     int        `gorm:"column:from_user_id"`
+	FromUserName   string     `gorm:"column:from_user_name"`
+	ToUserID       int        `gorm:"column:to_user_id"`
+	Content        string     `gorm:"column:content"`
+	CreatedAt      time.Time  `gorm:"column:created_at"`   // 存 UTC
+	DeliveredAt    *time.Time `gorm:"column:delivered_at"` // 收信人确认收到的时间，存 UTC
+}
+
+func conversationUsers(userA, userB int) (low, high int) {
+	if userA < userB {
+		return userA, userB
+	}
+	return userB, userA
+}
+
+// =============== 会话 ===============
+
+// 两个人的会话，没有就建一个；并发建的时候靠唯一索引兜底，再读一次
+func (s *Store) GetOrCreateConversation(ctx context.Context, userA, userB int) (DirectConversation, error) {
+	conv, err := s.FindConversation(ctx, userA, userB)
+	if err == nil {
+		return conv, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return conv, err
+	}
+	low, high := conversationUsers(userA, userB)
+	conv = DirectConversation{
+		ID:        tools.GetSnowflakeIdForInt64(),
+		UserLow:   low,
+		UserHigh:  high,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = s.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&conv).Error; err != nil {
+		return conv, err
+	}
+	return s.FindConversation(ctx, userA, userB)
+}
+
+// 两个人的会话，没有不建，返回 gorm.ErrRecordNotFound
+func (s *Store) FindConversation(ctx context.Context, userA, userB int) (DirectConversation, error) {
+	low, high := conversationUsers(userA, userB)
+	var conv DirectConversation
+	err := s.DB.WithContext(ctx).Where("user_low = ? AND user_high = ?", low, high).Take(&conv).Error
+	return conv, err
+}
+
+// 不存在返回 gorm.ErrRecordNotFound
+func (s *Store) GetConversation(ctx context.Context, id int64) (DirectConversation, error) {
+	var conv DirectConversation
+	err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&conv).Error
+	return conv, err
+}
+
+// 用户参与的会话，最近有消息的在前
+func (s *Store) ListConversations(ctx context.Context, userID, limit int) ([]DirectConversation, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var rows []DirectConversation
+	err := s.DB.WithContext(ctx).
+		Where("user_low = ? OR user_high = ?", userID, userID).
+		Order("last_message_at DESC").Order("id DESC").
+		Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// =============== 入库（私信） ===============
+
+// 存一条私信，同时更新会话的最后一条消息
+func (s *Store) SaveDirectMsg(ctx context.Context, msg *DirectMessage) error {
+	if msg.ID == 0 {
+		msg.ID = tools.GetSnowflakeIdForInt64()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&DirectConversation{}).Where("id = ?", msg.ConversationID).Updates(map[string]interface{}{
+			"last_message_id": msg.ID,
+			"last_message_at": msg.CreatedAt,
+		}).Error
+	})
+}
+
+// 收信人确认收到，只记第一次；重发以后再确认的返回 false，不用再发回执
+func (s *Store) MarkDirectDelivered(ctx context.Context, id int64, toUserID int) (DirectMessage, bool, error) {
+	var msg DirectMessage
+	now := time.Now().UTC()
+	res := s.DB.WithContext(ctx).Model(&DirectMessage{}).
+		Where("id = ? AND to_user_id = ? AND delivered_at IS NULL", id, toUserID).
+		Update("delivered_at", now)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return msg, false, res.Error
+	}
+	err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&msg).Error
+	return msg, err == nil, err
+}
+
+// =============== 查询（私信） ===============
+
+// 会话里的消息，beforeID 大于 0 时只取比它早的，返回正序
+func (s *Store) ListDirectMessages(ctx context.Context, conversationID int64, beforeID int64, limit int) ([]DirectMessage, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.DB.WithContext(ctx).Where("conversation_id = ?", conversationID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var rows []DirectMessage
+	if err := query.Order("id DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows, nil
+}
+
+func (s *Store) GetDirectMessagesByIds(ctx context.Context, ids []int64) ([]DirectMessage, error) {
+	var rows []DirectMessage
+	if len(ids) == 0 {
+		return rows, nil
+	}
+	err := s.DB.WithContext(ctx).Where("id IN ?", ids).Find(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,146 @@
+package chatstore
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============== 模型（已读） ===============
+
+// 用户在房间里读到哪一条；LastReadAt 是那条消息的发送时间，未读数按 (created_at, id) 往后数，走 idx_chat_message_room_time
+type RoomReadMarker struct {
+	UserID     int       `gorm:"primaryKey;column:user_id;autoIncrement:false"`
+	RoomID     int       `gorm:"primaryKey;column:room_id;autoIncrement:false;index"`
+	LastReadID int64     `gorm:"column:last_read_id;not null;default:0"`
+	LastReadAt time.Time `gorm:"column:last_read_at"` // 存 UTC
+	UpdatedAt  time.Time `gorm:"column:updated_at"`
+}
+
+// 和 dao 里一样，LIKE 用 ! 转义
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// msg 在 marker 之后
+func readAfter(msg ChatMessage, marker RoomReadMarker) bool {
+	if !msg.CreatedAt.Equal(marker.LastReadAt) {
+		return msg.CreatedAt.After(marker.LastReadAt)
+	}
+	return msg.ID > marker.LastReadID
+}
+
+// =============== 已读位置 ===============
+
+// 标记读到房间里的某条消息，只往后移；消息不是这个房间的返回 gorm.ErrRecordNotFound
+// 第二个返回值表示位置有没有动，没动就不用发已读回执
+func (s *Store) MarkRoomRead(ctx context.Context, userID, roomID int, messageID int64) (RoomReadMarker, bool, error) {
+	var marker RoomReadMarker
+	moved := false
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var msg ChatMessage
+		if err := tx.Where("room_id = ? AND id = ?", roomID, messageID).Take(&msg).Error; err != nil {
+			return err
+		}
+		err := tx.Where("user_id = ? AND room_id = ?", userID, roomID).Take(&marker).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err == nil && !readAfter(msg, marker) {
+			return nil
+		}
+		marker = RoomReadMarker{
+			UserID:     userID,
+			RoomID:     roomID,
+			LastReadID: msg.ID,
+			LastReadAt: msg.CreatedAt.UTC(),
+			UpdatedAt:  time.Now().UTC(),
+		}
+		moved = true
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "room_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_read_id", "last_read_at", "updated_at"}),
+		}).Create(&marker).Error
+	})
+	return marker, moved, err
+}
+
+// 用户在这些房间的已读位置，没读过的不在返回的 map 里
+func (s *Store) GetRoomReadMarkers(ctx context.Context, userID int, roomIDs []int) (map[int]RoomReadMarker, error) {
+	markers := make(map[int]RoomReadMarker, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return markers, nil
+	}
+	var rows []RoomReadMarker
+	if err := s.DB.WithContext(ctx).Where("user_id = ? AND room_id IN ?", userID, roomIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		markers[row.RoomID] = row
+	}
+	return markers, nil
+}
+
+// 房间里所有人的已读位置，读得最新的在前
+func (s *Store) ListRoomReadMarkers(ctx context.Context, roomID int) ([]RoomReadMarker, error) {
+	var rows []RoomReadMarker
+	err := s.DB.WithContext(ctx).
+		Where("room_id = ?", roomID).
+		Order("last_read_at DESC").Order("last_read_id DESC").
+		Find(&rows).Error
+	return rows, err
+}
+
+// =============== 未读数 ===============
+
+// 已读位置之后别人发的消息数，以及其中 @ 了 mention 的条数；mention 为空不算 @
+// LIKE 先粗筛出带 @mention 的消息，再在内存里按词边界确认，免得 @bobby 算成 @bob
+func (s *Store) CountRoomUnread(ctx context.Context, roomID, userID int, marker RoomReadMarker, mention string) (unread, mentions int64, err error) {
+	unreadQuery := func() *gorm.DB {
+		query := s.DB.WithContext(ctx).Model(&ChatMessage{}).
+			Where("room_id = ? AND from_user_id <> ?", roomID, userID)
+		if marker.LastReadID > 0 {
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", marker.LastReadAt, marker.LastReadAt, marker.LastReadID)
+		}
+		return query
+	}
+	if err = unreadQuery().Count(&unread).Error; err != nil || mention == "" || unread == 0 {
+		return
+	}
+	var contents []string
+	like := "%@" + likeEscaper.Replace(mention) + "%"
+	if err = unreadQuery().Where("content LIKE ? ESCAPE '!'", like).Pluck("content", &contents).Error; err != nil {
+		return
+	}
+	for _, content := range contents {
+		if hasMention(content, mention) {
+			mentions++
+		}
+	}
+	return
+}
+
+// content 里有 @name，后面跟的是空白、标点或者结尾（下划线算名字的一部分）；和 LIKE 一样不分大小写
+func hasMention(content string, name string) bool {
+	content = strings.ToLower(content)
+	target := "@" + strings.ToLower(name)
+	for {
+		i := strings.Index(content, target)
+		if i < 0 {
+			return false
+		}
+		content = content[i+len(target):]
+		r, _ := utf8.DecodeRuneInString(content)
+		if content == "" || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return true
+		}
+	}
+}
+
+// 房间删掉了，已读位置一起删
+func (s *Store) DeleteRoomReadMarkers(ctx context.Context, roomID int) error {
+	return s.DB.WithContext(ctx).Where("room_id = ?", roomID).Delete(&RoomReadMarker{}).Error
+}
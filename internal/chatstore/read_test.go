@@ -0,0 +1,53 @@
+package chatstore
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ReadAfter(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	marker := RoomReadMarker{LastReadID: 100, LastReadAt: at}
+	cases := []struct {
+		name   string
+		msg    ChatMessage
+		marker RoomReadMarker
+		want   bool
+	}{
+		{"later message", ChatMessage{ID: 50, CreatedAt: at.Add(time.Second)}, marker, true},
+		{"earlier message", ChatMessage{ID: 200, CreatedAt: at.Add(-time.Second)}, marker, false},
+		{"same time bigger id", ChatMessage{ID: 101, CreatedAt: at}, marker, true},
+		{"same time smaller id", ChatMessage{ID: 99, CreatedAt: at}, marker, false},
+		{"the read message itself", ChatMessage{ID: 100, CreatedAt: at}, marker, false},
+		{"same instant other zone", ChatMessage{ID: 101, CreatedAt: at.In(time.FixedZone("CST", 8*3600))}, marker, true},
+		{"empty marker", ChatMessage{ID: 1, CreatedAt: at}, RoomReadMarker{}, true},
+	}
+	for _, c := range cases {
+		if got := readAfter(c.msg, c.marker); got != c.want {
+			t.Fatalf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func Test_HasMention(t *testing.T) {
+	cases := []struct {
+		content string
+		want    bool
+	}{
+		{"hi @bob", true},
+		{"@bob, look", true},
+		{"@Bob!", true},
+		{"@bob\tthere", true},
+		{"hey @bobby", false},
+		{"@bob_x", false},
+		{"@bob2", false},
+		{"mail bob@x", false},
+		{"@bobby and @bob.", true},
+		{"no mention", false},
+	}
+	for _, c := range cases {
+		if got := hasMention(c.content, "bob"); got != c.want {
+			t.Fatalf("%q: got %v want %v", c.content, got, c.want)
+		}
+	}
+}
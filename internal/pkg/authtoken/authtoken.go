@@ -0,0 +1,78 @@
+package authtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// JWT 风格的 access token：header.payload.signature，HS256 签名
+// api 层和 connect 层拿同一个 secret 本地验签，不用每次都 rpc 到 logic 查 redis
+
+var (
+	ErrTokenInvalid = errors.New("token invalid")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type Claims struct {
+	UserId   int    `json:"uid"`
+	UserName string `json:"name"`
+	TokenId  string `json:"jti"` // 吊销时按 jti 进黑名单
+	IssuedAt int64  `json:"iat"`
+	ExpireAt int64  `json:"exp"`
+}
+
+func Sign(claims Claims, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("token secret empty")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + sign(signingInput, secret), nil
+}
+
+// 验签并检查过期时间，黑名单由调用方自己查
+func Parse(token string, secret []byte) (*Claims, error) {
+	if len(secret) == 0 {
+		return nil, ErrTokenInvalid
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrTokenInvalid
+	}
+	expected := sign(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	claims := new(Claims)
+	if err = json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if claims.UserId <= 0 || claims.TokenId == "" {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpireAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func sign(signingInput string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
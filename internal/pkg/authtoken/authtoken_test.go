@@ -0,0 +1,44 @@
+package authtoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("gochat-test-secret")
+
+func Test_SignAndParse(t *testing.T) {
+	now := time.Now().Unix()
+	token, err := Sign(Claims{UserId: 78, UserName: "lock", TokenId: "abc", IssuedAt: now, ExpireAt: now + 60}, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := Parse(token, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserId != 78 || claims.UserName != "lock" || claims.TokenId != "abc" {
+		t.Fatalf("claims not match: %+v", claims)
+	}
+	if _, err = Parse(token, []byte("other-secret")); err != ErrTokenInvalid {
+		t.Fatalf("wrong secret should be invalid, got %v", err)
+	}
+	parts := strings.Split(token, ".")
+	forged, _ := Sign(Claims{UserId: 1, UserName: "admin", TokenId: "abc", IssuedAt: now, ExpireAt: now + 60}, []byte("other-secret"))
+	forgedParts := strings.Split(forged, ".")
+	if _, err = Parse(parts[0]+"."+forgedParts[1]+"."+parts[2], testSecret); err != ErrTokenInvalid {
+		t.Fatalf("tampered payload should be invalid, got %v", err)
+	}
+}
+
+func Test_ParseExpired(t *testing.T) {
+	now := time.Now().Unix()
+	token, _ := Sign(Claims{UserId: 78, UserName: "lock", TokenId: "abc", IssuedAt: now - 120, ExpireAt: now - 60}, testSecret)
+	if _, err := Parse(token, testSecret); err != ErrTokenExpired {
+		t.Fatalf("expired token should be rejected, got %v", err)
+	}
+	if _, err := Parse("not.a.token", testSecret); err != ErrTokenInvalid {
+		t.Fatalf("garbage token should be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 给用户发通知（重置密码验证码之类）的出口，真正的邮件/短信以后按需实现 Notifier 接进来
+
+const (
+	DriverFile = "file" // 写到本地文件，开发环境和没有邮件服务时的替身
+)
+
+type Message struct {
+	To      string // 收件人，目前就是用户名
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// 按配置选实现，driver 为空默认写文件
+func New(driver string, filePath string) (Notifier, error) {
+	switch driver {
+	case "", DriverFile:
+		return NewFileNotifier(filePath), nil
+	default:
+		return nil, fmt.Errorf("unknown notify driver: %s", driver)
+	}
+}
+
+// 把通知追加写到文件里，一条一行
+type FileNotifier struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	if path == "" {
+		path = "gochat_notify.log"
+	}
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(msg Message) (err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if dir := filepath.Dir(n.path); dir != "." {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\tto:%s\tsubject:%s\t%s\n", time.Now().Format("2006-01-02 15:04:05"), msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,46 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量
+func Test_RfcVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for ts, want := range vectors {
+		if got := hotp(key, Step(time.Unix(ts, 0)), 8); got != want {
+			t.Fatalf("time %d: got %s want %s", ts, got, want)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := Code(secret, now.Add(-Period*time.Second))
+	if _, ok := Validate(secret, code, now, 1); !ok {
+		t.Fatal("code of previous step should pass with skew 1")
+	}
+	if _, ok := Validate(secret, code, now, 0); ok {
+		t.Fatal("code of previous step should fail with skew 0")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Fatal("short code should fail")
+	}
+	if uri := URI("gochat", "lock", secret); !strings.HasPrefix(uri, "otpauth://totp/gochat:lock?") {
+		t.Fatalf("bad uri: %s", uri)
+	}
+}
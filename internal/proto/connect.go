@@ -5,6 +5,8 @@
  */
 package proto
 
+import "encoding/json"
+
 type Msg struct {
 	Ver       int    `json:"ver"`  // protocol version
 	Operation int    `json:"op"`   // operation for request
@@ -12,17 +14,59 @@ type Msg struct {
 	Body      []byte `json:"body"` // binary body bytes
 }
 
+// 开了 ack 的连接上，要确认的消息套一层发出去，客户端收到以后回 config.OpAck 带上 seq
+type AckFrame struct {
+	Ver  int             `json:"ver"`
+	Op   int             `json:"op"`
+	Seq  string          `json:"seq"`
+	Body json.RawMessage `json:"body"`
+}
+
 type PushMsgRequest struct {
 	UserId int
 	Msg    Msg
 }
 
 type PushRoomMsgRequest struct {
-	RoomId int
-	Msg    Msg
+	RoomId       int
+	Msg          Msg
+	ExceptUserId int // 不推给这个用户，比如正在输入的本人
 }
 
 type PushRoomCountRequest struct {
 	RoomId int
 	Count  int
 }
+
+// 进出房间的结果，通过连接回给客户端
+type RoomOpReply struct {
+	Op      int        `json:"op"`
+	RoomId  int        `json:"roomId"`
+	Code    int        `json:"code"`
+	Msg     string     `json:"msg"`
+	RoomIds []int      `json:"roomIds"`        // 操作以后连接订阅的所有房间
+	Room    *RoomState `json:"room,omitempty"` // 进房间成功时带上房间当前状态
+}
+
+// 正在输入的通知，Ttl 秒内没再收到就当停了
+type TypingNotice struct {
+	Op     int  `json:"op"`
+	RoomId int  `json:"roomId"`
+	UserId int  `json:"userId"`
+	Typing bool `json:"typing"`
+	Ttl    int  `json:"ttl"`
+}
+
+// 被踢出/封禁的通知，通过连接推给被踢的用户
+type RoomKickNotice struct {
+	Op     int    `json:"op"`
+	RoomId int    `json:"roomId"`
+	Reason string `json:"reason"`
+	Banned bool   `json:"banned"`
+}
+
+type KickUserRequest struct {
+	UserId int
+	RoomId int
+	Msg    Msg
+}
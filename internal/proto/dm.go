@@ -0,0 +1,69 @@
+package proto
+
+// 单聊发送的结果，带上会话 id 和消息 id
+type PushReply struct {
+	Code           int
+	Msg            string
+	ConversationId int64
+	MessageId      int64
+}
+
+type ListConversationsRequest struct {
+	AuthToken string `json:"authToken"`
+	Limit     int    `json:"limit"`
+}
+type ListConversationsResponse struct {
+	Code int               `json:"code"`
+	Data []ConversationDTO `json:"data"`
+}
+
+// 会话列表里的一项，对方的资料按当前资料补
+type ConversationDTO struct {
+	ConversationId  int64             `json:"conversationId"`
+	PeerUserId      int               `json:"peerUserId"`
+	PeerUserName    string            `json:"peerUserName"`
+	PeerDisplayName string            `json:"peerDisplayName,omitempty"`
+	PeerAvatar      string            `json:"peerAvatar,omitempty"`
+	LastMessage     *DirectMessageDTO `json:"lastMessage,omitempty"`
+}
+
+// ConversationId 和 PeerUserId 二选一
+type ListDirectMessagesRequest struct {
+	AuthToken      string `json:"authToken"`
+	ConversationId int64  `json:"conversationId"`
+	PeerUserId     int    `json:"peerUserId"`
+	BeforeId       int64  `json:"beforeId"` // 翻页：只取比这条早的
+	Limit          int    `json:"limit"`
+}
+type ListDirectMessagesResponse struct {
+	Code           int                `json:"code"`
+	ConversationId int64              `json:"conversationId"`
+	Data           []DirectMessageDTO `json:"data"`
+}
+type DirectMessageDTO struct {
+	Id              int64  `json:"id"`
+	ConversationId  int64  `json:"conversationId"`
+	FromUserId      int    `json:"fromUserId"`
+	FromUserName    string `json:"fromUserName"`
+	ToUserId        int    `json:"toUserId"`
+	Content         string `json:"content"`
+	CreateTime      string `json:"createTime"`
+	FromDisplayName string `json:"fromDisplayName,omitempty"`
+	FromAvatar      string `json:"fromAvatar,omitempty"`
+	DeliveredAt     string `json:"deliveredAt,omitempty"` // 对方客户端确认收到的时间，还没送达为空
+}
+
+// 收信人的连接确认收到了一条私信
+type DeliveredRequest struct {
+	UserId    int
+	MessageId int64
+}
+
+// 推给发私信的人的送达回执
+type DeliveredReceipt struct {
+	Op             int    `json:"op"`
+	ConversationId int64  `json:"conversationId"`
+	MessageId      int64  `json:"messageId"`
+	ToUserId       int    `json:"toUserId"`
+	DeliveredAt    string `json:"deliveredAt"`
+}
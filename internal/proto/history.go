@@ -1,6 +1,7 @@
 package proto
 
 type ListMessagesRequest struct {
+	UserId int    `json:"userId"` // 谁在读，用来检查房间权限
 	RoomId int    `json:"roomId"`
 	Limit  int    `json:"limit"` // 最近 N 条
 	Since  string `json:"since"` // 可选：YYYY-MM-DD HH:MM:SS
@@ -16,4 +17,8 @@ type MessageDTO struct {
 	FromUserName string `json:"fromUserName"`
 	Content      string `json:"content"`
 	CreateTime   string `json:"createTime"`
+	// 按发送者当前资料补的展示名和头像
+	FromDisplayName string `json:"fromDisplayName,omitempty"`
+	FromAvatar      string `json:"fromAvatar,omitempty"`
+	IsBot           bool   `json:"isBot,omitempty"`
 }
@@ -6,13 +6,457 @@
 package proto
 
 type LoginRequest struct {
-	Name     string
-	Password string
+	Name       string
+	Password   string
+	DeviceName string
+	UserAgent  string
+	ClientIp   string
 }
 
 type LoginResponse struct {
+	Code         int
+	AuthToken    string
+	RefreshToken string // 仅签名 token 模式
+	ExpiresIn    int    // access token 剩余有效期(秒)，仅签名 token 模式
+	RetryAfter   int    // 登录失败太多被限制，多少秒后再试
+	// 开了两步验证的账号，密码通过以后只返回挑战 token，拿去 Login2fa 换真正的 AuthToken
+	ChallengeToken     string
+	ChallengeExpiresIn int
+}
+
+type Login2faRequest struct {
+	ChallengeToken string
+	Code           string // 6 位动态码，或者一次性恢复码
+}
+
+type TwoFactorSetupRequest struct {
+	AuthToken string
+}
+
+type TwoFactorSetupResponse struct {
+	Code   int
+	Secret string
+	Uri    string // otpauth:// 链接，前端生成二维码
+}
+
+type TwoFactorConfirmRequest struct {
+	AuthToken string
+	Code      string
+}
+
+type TwoFactorConfirmResponse struct {
+	Code          int
+	RecoveryCodes []string // 只在确认绑定时返回这一次
+}
+
+type TwoFactorDisableRequest struct {
+	AuthToken string
+	Code      string // 动态码或者恢复码
+}
+
+type UnlockLoginRequest struct {
+	AuthToken string
+	UserName  string
+	ClientIp  string
+}
+
+type ChangePasswordRequest struct {
+	AuthToken   string
+	OldPassword string
+	NewPassword string
+}
+
+type ForgotPasswordRequest struct {
+	UserName string
+}
+
+type ResetPasswordRequest struct {
+	UserName    string
+	Code        string
+	NewPassword string
+}
+
+type CreateBotRequest struct {
+	AuthToken string
+	Name      string
+}
+
+type BotInfo struct {
+	UserId     int    `json:"userId"`
+	UserName   string `json:"userName"`
+	CreateTime string `json:"createTime"`
+}
+
+type CreateBotResponse struct {
+	Code int
+	Bot  BotInfo
+}
+
+type ListBotsRequest struct {
+	AuthToken string
+}
+
+type ListBotsResponse struct {
+	Code int
+	Bots []BotInfo
+}
+
+type ApiKeyInfo struct {
+	Id           int      `json:"id"`
+	BotUserId    int      `json:"botUserId"`
+	Name         string   `json:"name"`
+	KeyPrefix    string   `json:"keyPrefix"`
+	Scopes       []string `json:"scopes"`
+	Rooms        []int    `json:"rooms"`
+	Revoked      bool     `json:"revoked"`
+	ExpireTime   string   `json:"expireTime"`
+	LastUsedTime string   `json:"lastUsedTime"`
+	CreateTime   string   `json:"createTime"`
+}
+
+type CreateApiKeyRequest struct {
+	AuthToken  string
+	BotUserId  int
+	Name       string
+	Scopes     []string
+	Rooms      []int
+	ExpireDays int // 0 表示不过期
+}
+
+type CreateApiKeyResponse struct {
+	Code   int
+	ApiKey string // 明文只返回这一次
+	Key    ApiKeyInfo
+}
+
+type ListApiKeysRequest struct {
+	AuthToken string
+	BotUserId int
+}
+
+type ListApiKeysResponse struct {
+	Code int
+	Keys []ApiKeyInfo
+}
+
+type RevokeApiKeyRequest struct {
+	AuthToken string
+	KeyId     int
+}
+
+type AuthApiKeyRequest struct {
+	ApiKey string
+}
+
+type AuthApiKeyResponse struct {
+	Code     int
+	UserId   int
+	UserName string
+	Scopes   []string
+	Rooms    []int
+}
+
+// 当前用户在某个房间能做什么，客户端按这个显示/隐藏操作
+type RoomPermissions struct {
+	RoomId         int    `json:"roomId"`
+	Role           string `json:"role"`
+	IsAdmin        bool   `json:"isAdmin"`
+	CanJoin        bool   `json:"canJoin"`
+	CanRead        bool   `json:"canRead"`
+	CanSend        bool   `json:"canSend"`
+	CanModerate    bool   `json:"canModerate"`
+	CanManageRoles bool   `json:"canManageRoles"`
+	CanManageRoom  bool   `json:"canManageRoom"` // 改名、归档、删除
+	Private        bool   `json:"private"`
+	SpaceId        int    `json:"spaceId"`             // 所属空间，0 是全局房间
+	SpaceRole      string `json:"spaceRole,omitempty"` // 在所属空间里的角色，空表示不是空间成员
+	IsMember       bool   `json:"isMember"`            // 私有房间的成员
+	Banned         bool   `json:"banned"`
+	Spectator      bool   `json:"spectator"` // 房间满了以观众身份进的，不能发言
+	MutedFor       int    `json:"mutedFor"`  // 禁言还剩多少秒，0 是没被禁言
+}
+
+type GetRoomPermissionsRequest struct {
+	AuthToken string
+	RoomId    int
+}
+
+type GetRoomPermissionsResponse struct {
+	Code        int
+	Permissions RoomPermissions
+}
+
+type SetRoomRoleRequest struct {
+	AuthToken string
+	RoomId    int
+	UserId    int
+	Role      string // 空表示恢复默认角色
+}
+
+type SetUserRoleRequest struct {
+	AuthToken string
+	UserId    int
+	Role      string // admin 或者空
+}
+
+type RoomInfo struct {
+	RoomId         int    `json:"roomId"`
+	SpaceId        int    `json:"spaceId"` // 0 是不属于任何空间的全局房间
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Topic          string `json:"topic"`
+	Announcement   string `json:"announcement"`
+	OwnerId        int    `json:"ownerId"`
+	Archived       bool   `json:"archived"`
+	Private        bool   `json:"private"`
+	SlowMode       int    `json:"slowMode"`   // 秒，0 不限
+	MaxMembers     int    `json:"maxMembers"` // 0 不限
+	MaxOnline      int    `json:"maxOnline"`  // 0 不限
+	OverflowPolicy string `json:"overflowPolicy"`
+	CreateTime     string `json:"createTime"`
+}
+
+type CreateRoomRequest struct {
+	AuthToken   string
+	SpaceId     int // 建在哪个空间里，0 是全局房间
+	Name        string
+	Description string
+	Private     bool
+}
+
+type RoomInfoResponse struct {
+	Code int
+	Room RoomInfo
+}
+
+type GetRoomRequest struct {
+	AuthToken string
+	RoomId    int
+}
+
+// 房间目录：Query 为空就是列表，不为空按名字、话题、简介搜
+type ListRoomsRequest struct {
+	AuthToken string
+	SpaceId   int // 只列这个空间里的房间，0 不限
+	Query     string
+	Sort      string // online、members、name、newest，默认 online
+	Cursor    string // 上一页返回的 NextCursor，空表示第一页
+	Limit     int
+}
+
+type RoomDirectoryEntry struct {
+	RoomInfo
+	MemberCount int `json:"memberCount"`
+	OnlineCount int `json:"onlineCount"`
+}
+
+type ListRoomsResponse struct {
+	Code       int
+	Rooms      []RoomDirectoryEntry
+	NextCursor string // 空表示没有下一页了
+}
+
+type RenameRoomRequest struct {
+	AuthToken   string
+	RoomId      int
+	Name        string
+	Description string
+}
+
+type ArchiveRoomRequest struct {
+	AuthToken string
+	RoomId    int
+	Archived  bool // false 是取消归档
+}
+
+type DeleteRoomRequest struct {
+	AuthToken string
+	RoomId    int
+}
+
+type SetRoomCapacityRequest struct {
+	AuthToken      string
+	RoomId         int
+	MaxMembers     int
+	MaxOnline      int
+	OverflowPolicy string // reject 或 spectate，空表示 reject
+}
+
+type SetRoomSlowModeRequest struct {
+	AuthToken string
+	RoomId    int
+	Seconds   int // 0 关闭
+}
+
+type SetRoomPrivateRequest struct {
+	AuthToken string
+	RoomId    int
+	Private   bool
+}
+
+type RoomMemberInfo struct {
+	UserId     int    `json:"userId"`
+	UserName   string `json:"userName"`
+	Role       string `json:"role"`
+	CreateTime string `json:"createTime"`
+}
+
+type ListRoomMembersRequest struct {
+	AuthToken string
+	RoomId    int
+}
+
+type ListRoomMembersResponse struct {
+	Code    int
+	Members []RoomMemberInfo
+}
+
+// 邀请成员、移除成员共用
+type RoomMemberRequest struct {
+	AuthToken string
+	RoomId    int
+	UserId    int
+}
+
+type SpaceInfo struct {
+	SpaceId     int    `json:"spaceId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	OwnerId     int    `json:"ownerId"`
+	Private     bool   `json:"private"`
+	Role        string `json:"role"` // 当前用户在空间里的角色，空表示不是成员
+	MemberCount int    `json:"memberCount"`
+	CreateTime  string `json:"createTime"`
+}
+
+type CreateSpaceRequest struct {
+	AuthToken   string
+	Name        string
+	Description string
+	Private     bool
+}
+
+// 查看、加入、退出、删除空间共用
+type SpaceRequest struct {
+	AuthToken string
+	SpaceId   int
+}
+
+type SpaceInfoResponse struct {
+	Code  int
+	Space SpaceInfo
+}
+
+type ListSpacesResponse struct {
+	Code   int
+	Spaces []SpaceInfo
+}
+
+// 拉人、移出、设角色共用，Role 只有设角色用
+type SpaceMemberRequest struct {
+	AuthToken string
+	SpaceId   int
+	UserId    int
+	Role      string
+}
+
+type ListSpaceMembersResponse struct {
+	Code    int
+	Members []RoomMemberInfo
+}
+
+// 禁言、踢人、封禁共用，Duration 只有禁言用（秒）
+type ModerateRoomUserRequest struct {
+	AuthToken string
+	RoomId    int
+	UserId    int
+	Duration  int
+	Reason    string
+}
+
+type RoomBanInfo struct {
+	UserId     int    `json:"userId"`
+	UserName   string `json:"userName"`
+	BannedBy   int    `json:"bannedBy"`
+	Reason     string `json:"reason"`
+	CreateTime string `json:"createTime"`
+}
+
+type ListRoomBansResponse struct {
+	Code int
+	Bans []RoomBanInfo
+}
+
+type RoomInviteInfo struct {
+	InviteId   int    `json:"inviteId"`
+	RoomId     int    `json:"roomId"`
+	RoomName   string `json:"roomName"`
+	InviterId  int    `json:"inviterId"`
+	CreateTime string `json:"createTime"`
+}
+
+type ListRoomInvitesRequest struct {
+	AuthToken string
+}
+
+type ListRoomInvitesResponse struct {
+	Code    int
+	Invites []RoomInviteInfo
+}
+
+type RespondRoomInviteRequest struct {
+	AuthToken string
+	InviteId  int
+	Accept    bool
+}
+
+type RequestJoinRoomRequest struct {
+	AuthToken string
+	RoomId    int
+	Message   string
+}
+
+type RoomJoinRequestInfo struct {
+	RequestId  int    `json:"requestId"`
+	RoomId     int    `json:"roomId"`
+	UserId     int    `json:"userId"`
+	UserName   string `json:"userName"`
+	Message    string `json:"message"`
+	CreateTime string `json:"createTime"`
+}
+
+type ListJoinRequestsRequest struct {
+	AuthToken string
+	RoomId    int
+}
+
+type ListJoinRequestsResponse struct {
+	Code     int
+	Requests []RoomJoinRequestInfo
+}
+
+type HandleJoinRequestRequest struct {
+	AuthToken string
+	RequestId int
+	Approve   bool
+}
+
+type CreateInviteLinkRequest struct {
+	AuthToken string
+	RoomId    int
+	Ttl       int // 秒，0 用默认值
+}
+
+type CreateInviteLinkResponse struct {
 	Code      int
+	Token     string
+	ExpiresIn int
+}
+
+// 用邀请链接加入、撤销邀请链接共用
+type InviteLinkRequest struct {
 	AuthToken string
+	Token     string
 }
 
 type GetUserInfoRequest struct {
@@ -20,19 +464,74 @@ type GetUserInfoRequest struct {
 }
 
 type GetUserInfoResponse struct {
-	Code     int
-	UserId   int
-	UserName string
+	Code        int
+	UserId      int
+	UserName    string
+	DisplayName string
+	AvatarUrl   string
+}
+
+type UserProfile struct {
+	UserId      int    `json:"userId"`
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName"`
+	AvatarUrl   string `json:"avatarUrl"`
+	Bio         string `json:"bio"`
+	StatusText  string `json:"statusText"`
+	Locale      string `json:"locale"`
+	TimeZone    string `json:"timeZone"`
+	// 不让房间里的其他人看到自己读到了哪
+	HideReadReceipts bool `json:"hideReadReceipts"`
+}
+
+type GetProfileRequest struct {
+	AuthToken string
+	UserId    int // 0 表示看自己的
+}
+
+type GetProfileResponse struct {
+	Code    int
+	Profile UserProfile
+}
+
+// 字段为 nil 表示不改
+type UpdateProfileRequest struct {
+	AuthToken   string
+	DisplayName *string
+	AvatarUrl   *string
+	Bio         *string
+	StatusText  *string
+	Locale      *string
+	TimeZone    *string
+	// 已读回执开关
+	HideReadReceipts *bool
 }
 
 type RegisterRequest struct {
-	Name     string
-	Password string
+	Name       string
+	Password   string
+	DeviceName string
+	UserAgent  string
+	ClientIp   string
 }
 
 type RegisterReply struct {
-	Code      int
-	AuthToken string
+	Code         int
+	AuthToken    string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string
+	AuthToken    string // 当前手上的 access token，换完一起拉黑
+}
+
+type RefreshTokenResponse struct {
+	Code         int
+	AuthToken    string
+	RefreshToken string
+	ExpiresIn    int
 }
 
 type LogoutRequest struct {
@@ -43,6 +542,34 @@ type LogoutResponse struct {
 	Code int
 }
 
+type SessionInfo struct {
+	SessionId  string `json:"sessionId"`
+	DeviceName string `json:"deviceName"`
+	UserAgent  string `json:"userAgent"`
+	Ip         string `json:"ip"`
+	CreateTime string `json:"createTime"`
+	LastSeen   string `json:"lastSeen"`
+	Current    bool   `json:"current"`
+}
+
+type ListSessionsRequest struct {
+	AuthToken string
+}
+
+type ListSessionsResponse struct {
+	Code     int
+	Sessions []SessionInfo
+}
+
+type RevokeSessionRequest struct {
+	AuthToken string
+	SessionId string
+}
+
+type RevokeOtherSessionsRequest struct {
+	AuthToken string
+}
+
 type CheckAuthRequest struct {
 	AuthToken string
 }
@@ -57,15 +584,111 @@ type ConnectRequest struct {
 	AuthToken string `json:"authToken"`
 	RoomId    int    `json:"roomId"`
 	ServerId  string `json:"serverId"`
+	Op        int    `json:"op,omitempty"`        // ws 上发来的操作，0 是建连，config.OpJoinRoom/OpLeaveRoom/OpSwitchRoom 是进出房间
+	Ack       bool   `json:"ack,omitempty"`       // 建连时带上，这个连接上的聊天消息要客户端确认，没确认的会重发
+	SeqId     string `json:"seq,omitempty"`       // config.OpAck 确认的消息
+	MessageId int64  `json:"messageId,omitempty"` // config.OpReadRoom 读到的消息
+	Typing    bool   `json:"typing,omitempty"`    // config.OpTyping 开始还是停止输入
 }
 
 type ConnectReply struct {
+	UserId   int
+	UserName string
+	Code     int      // config.SessionExpiredCode 表示会话过期
+	Seat     RoomSeat // 进房间拿到的座位，connect 按这个拦观众和被禁言的「正在输入」
+}
+
+// connect 把连接放进桶以后再来取离线消息，取走就删
+type TakeOfflineRequest struct {
 	UserId int
 }
 
-type DisConnectRequest struct {
-	RoomId int
+type TakeOfflineReply struct {
+	Code    int
+	Offline []OfflineMsg // 不在线期间攒下的消息，按顺序补发
+}
+
+// 离线收件箱里的一条消息，Body 和在线时推给客户端的一样
+type OfflineMsg struct {
+	Op   int    `json:"op"`
+	Body []byte `json:"body"`
+}
+
+// 进房间拿到的座位：满了并且房间允许的话以观众身份进，只能看不能发言
+type RoomSeat struct {
+	Spectator bool `json:"spectator"`
+	MaxOnline int  `json:"maxOnline,omitempty"` // 房间的在线上限，0 不限
+	MutedFor  int  `json:"mutedFor,omitempty"`  // 进房间时还要禁言多少秒，0 表示没被禁言
+}
+
+type JoinRoomRequest struct {
+	AuthToken string
+	RoomId    int
+	ServerId  string
+}
+
+// 进房间以后房间的当前状态
+type RoomState struct {
+	RoomId       int               `json:"roomId"`
+	Name         string            `json:"name"`
+	OnlineCount  int               `json:"onlineCount"`
+	RoomUserInfo map[string]string `json:"roomUserInfo"`
+	RoomMeta
+	RoomSeat
+}
+
+// 置顶的消息，带上消息内容方便客户端直接显示
+type RoomPinInfo struct {
+	MessageId    int64  `json:"messageId"`
+	FromUserId   int    `json:"fromUserId"`
+	FromUserName string `json:"fromUserName"`
+	Content      string `json:"content"`
+	CreateTime   string `json:"createTime"`
+	PinnedBy     int    `json:"pinnedBy"`
+	PinTime      string `json:"pinTime"`
+}
+
+// 房间的话题、公告和置顶，进房间、名单变化、修改时都推给客户端
+type RoomMeta struct {
+	Topic        string        `json:"topic"`
+	Announcement string        `json:"announcement"`
+	Pins         []RoomPinInfo `json:"pins"`
+}
+
+type SetRoomTopicRequest struct {
+	AuthToken string
+	RoomId    int
+	Topic     string // 空表示清掉
+}
+
+type SetRoomAnnouncementRequest struct {
+	AuthToken    string
+	RoomId       int
+	Announcement string // 空表示清掉
+}
+
+type RoomPinRequest struct {
+	AuthToken string
+	RoomId    int
+	MessageId int64
+}
+
+type RoomMetaResponse struct {
+	Code int
+	Meta RoomMeta
+}
+
+type JoinRoomReply struct {
+	Code   int // 和 ConnectReply 一样，会话过期、没权限、房间不存在有各自的码
 	UserId int
+	Room   RoomState
+}
+
+type DisConnectRequest struct {
+	RoomId   int
+	UserId   int
+	ServerId string
+	Offline  bool // 用户在这台 connect 上已经没有连接了，logic 清掉用户所在服务器的记录
 }
 
 type DisConnectReply struct {
@@ -82,8 +705,14 @@ type Send struct {
 	RoomId       int    `json:"roomId"`
 	Op           int    `json:"op"`
 	CreateTime   string `json:"createTime"`
+	// 发送者资料，logic 层按 FromUserId 补上
+	FromDisplayName string `json:"fromDisplayName,omitempty"`
+	FromAvatar      string `json:"fromAvatar,omitempty"`
+	IsBot           bool   `json:"isBot,omitempty"` // 机器人发的消息
 	// 新增历史落库ID
 	ClientMsgId int64 `json:"clientMsgId"`
+	// 单聊的会话 id，群聊为 0
+	ConversationId int64 `json:"conversationId,omitempty"`
 }
 
 type SendTcp struct {
@@ -96,5 +725,9 @@ type SendTcp struct {
 	RoomId       int    `json:"roomId"`
 	Op           int    `json:"op"`
 	CreateTime   string `json:"createTime"`
-	AuthToken    string `json:"authToken"` //仅tcp时使用，发送msg时带上
+	AuthToken    string `json:"authToken"`           //仅tcp时使用，发送msg时带上
+	Ack          bool   `json:"ack,omitempty"`       // 同 ConnectRequest.Ack
+	SeqId        string `json:"seq,omitempty"`       // 同 ConnectRequest.SeqId
+	MessageId    int64  `json:"messageId,omitempty"` // 同 ConnectRequest.MessageId
+	Typing       bool   `json:"typing,omitempty"`    // 同 ConnectRequest.Typing
 }
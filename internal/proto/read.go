@@ -0,0 +1,48 @@
+package proto
+
+// 标记读到房间里的某条消息，api 和 connect 都走这个
+type MarkRoomReadRequest struct {
+	AuthToken string
+	RoomId    int
+	MessageId int64
+}
+
+type MarkRoomReadReply struct {
+	Code       int
+	UserId     int   // 令牌对应的用户，connect 拿来核对是不是这个连接的用户
+	LastReadId int64 // 标记以后的已读位置，读过更新的消息就不会往回退
+}
+
+type ListRoomUnreadRequest struct {
+	AuthToken string
+}
+
+type ListRoomUnreadResponse struct {
+	Code int
+	Data []RoomUnread
+}
+
+// 一个房间的未读数，Mentions 是其中 @ 了自己的
+type RoomUnread struct {
+	RoomId     int    `json:"roomId"`
+	RoomName   string `json:"roomName"`
+	LastReadId int64  `json:"lastReadId"`
+	Unread     int64  `json:"unread"`
+	Mentions   int64  `json:"mentions"`
+}
+
+type ListRoomReadsResponse struct {
+	Code int
+	Data []RoomRead
+}
+
+// 房间里一个人读到了哪条，也是推给房间里其他人的已读回执
+type RoomRead struct {
+	Op          int    `json:"op,omitempty"`
+	RoomId      int    `json:"roomId"`
+	UserId      int    `json:"userId"`
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName,omitempty"`
+	LastReadId  int64  `json:"lastReadId"`
+	ReadTime    string `json:"readTime"`
+}
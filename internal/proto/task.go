@@ -5,29 +5,54 @@
  */
 package proto
 
+// 房间名单里每个人的展示资料，key 和 RoomUserInfo 一样是 userId
+type RoomUserProfile struct {
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar,omitempty"`
+}
+
 type RedisMsg struct {
-	Op           int               `json:"op"`
-	ServerId     string            `json:"serverId,omitempty"`
-	RoomId       int               `json:"roomId,omitempty"`
-	UserId       int               `json:"userId,omitempty"`
-	Msg          []byte            `json:"msg"`
-	Count        int               `json:"count"`
-	RoomUserInfo map[string]string `json:"roomUserInfo"`
+	Op               int                        `json:"op"`
+	ServerId         string                     `json:"serverId,omitempty"`
+	RoomId           int                        `json:"roomId,omitempty"`
+	UserId           int                        `json:"userId,omitempty"`
+	Msg              []byte                     `json:"msg"`
+	Count            int                        `json:"count"`
+	RoomUserInfo     map[string]string          `json:"roomUserInfo"`
+	RoomUserProfiles map[string]RoomUserProfile `json:"roomUserProfiles,omitempty"`
+	RoomMeta         *RoomMeta                  `json:"roomMeta,omitempty"`
 }
 
 type RedisRoomInfo struct {
-	Op           int               `json:"op"`
-	RoomId       int               `json:"roomId,omitempty"`
-	Count        int               `json:"count,omitempty"`
-	RoomUserInfo map[string]string `json:"roomUserInfo"`
+	Op               int                        `json:"op"`
+	RoomId           int                        `json:"roomId,omitempty"`
+	Count            int                        `json:"count,omitempty"`
+	RoomUserInfo     map[string]string          `json:"roomUserInfo"`
+	RoomUserProfiles map[string]RoomUserProfile `json:"roomUserProfiles,omitempty"`
+	RoomMeta
+}
+
+// 话题、公告、置顶变了单独推，不带在线名单
+type RedisRoomMetaMsg struct {
+	Op     int `json:"op"`
+	RoomId int `json:"roomId"`
+	RoomMeta
 }
 
 type RedisRoomCountMsg struct {
-	Count int `json:"count,omitempty"`
-	Op    int `json:"op"`
+	Count  int `json:"count,omitempty"`
+	Op     int `json:"op"`
+	RoomId int `json:"roomId,omitempty"` // 一个连接可能订阅多个房间，带上是哪个房间
 }
 
 type SuccessReply struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
 }
+
+// 发群聊消息的结果，被限流时带上多少秒后再试
+type PushRoomReply struct {
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+}
@@ -44,9 +44,14 @@ func CreateSessionId(sessionId string) string {
 	return SessionPrefix + sessionId
 }
 
-// sess_map_78 : token （拿用户ID 去获取token，接着就能调用上面的获取元信息了）
-func GetSessionIdByUserId(userId int) string {
-	return fmt.Sprintf("sess_map_%d", userId)
+// sess_set_78 : {token1, token2} 一个用户多端登录的全部会话
+func GetSessionSetByUserId(userId int) string {
+	return fmt.Sprintf("sess_set_%d", userId)
+}
+
+// 对外展示的会话ID，不能把别的设备的token直接返回出去
+func GetSessionPublicId(token string) string {
+	return Sha1(token)[:16]
 }
 
 func GetSessionName(sessionId string) string {
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码哈希，bcrypt 每次都会生成随机盐，盐和 cost 一起编码在结果里
+func HashPassword(password string, cost int) (string, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// 库里老数据存的是明文（api层 sha1 过的串），bcrypt 结果都以 $2 开头
+func IsPasswordHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2")
+}
+
+// 校验密码，兼容还没升级的明文行
+func CheckPassword(stored string, password string) bool {
+	if stored == "" {
+		return false
+	}
+	if !IsPasswordHashed(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
+
+// 明文行，或者配置里的 cost 改了，都需要在下次登录成功时重新哈希
+func PasswordNeedsRehash(stored string, cost int) bool {
+	if !IsPasswordHashed(stored) {
+		return true
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	storedCost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		return true
+	}
+	return storedCost != cost
+}
@@ -0,0 +1,46 @@
+package tools
+
+import "testing"
+
+func Test_HashPassword(t *testing.T) {
+	pwd := Sha1("123456")
+	hashed, err := HashPassword(pwd, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed == pwd || !IsPasswordHashed(hashed) {
+		t.Fatalf("password not hashed: %s", hashed)
+	}
+	if !CheckPassword(hashed, pwd) {
+		t.Fatal("check hashed password fail")
+	}
+	if CheckPassword(hashed, Sha1("654321")) {
+		t.Fatal("wrong password pass check")
+	}
+	other, _ := HashPassword(pwd, 4)
+	if other == hashed {
+		t.Fatal("same password got same hash, salt missing")
+	}
+	if PasswordNeedsRehash(hashed, 4) {
+		t.Fatal("same cost should not rehash")
+	}
+	if !PasswordNeedsRehash(hashed, 5) {
+		t.Fatal("cost changed should rehash")
+	}
+}
+
+func Test_CheckLegacyPassword(t *testing.T) {
+	pwd := Sha1("123456")
+	if !CheckPassword(pwd, pwd) {
+		t.Fatal("legacy plaintext row check fail")
+	}
+	if CheckPassword(pwd, Sha1("654321")) {
+		t.Fatal("legacy plaintext row wrong password pass check")
+	}
+	if CheckPassword("", "") {
+		t.Fatal("empty password pass check")
+	}
+	if !PasswordNeedsRehash(pwd, 4) {
+		t.Fatal("legacy plaintext row should rehash")
+	}
+}
@@ -29,6 +29,7 @@ func GetRedisInstance(redisOpt RedisOption) *redis.Client {
 	password := redisOpt.Password
 	addr := fmt.Sprintf("%s", address)
 	syncLock.Lock()
+	defer syncLock.Unlock()
 	if redisCli, ok := RedisClientMap[addr]; ok {
 		return redisCli
 	}
@@ -39,6 +40,5 @@ func GetRedisInstance(redisOpt RedisOption) *redis.Client {
 		MaxConnAge: 20 * time.Second,
 	})
 	RedisClientMap[addr] = client
-	syncLock.Unlock()
 	return RedisClientMap[addr]
 }
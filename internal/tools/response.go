@@ -11,17 +11,29 @@ import (
 )
 
 const (
-	CodeSuccess      = 0
-	CodeFail         = 1
-	CodeUnknownError = -1
-	CodeSessionError = 40000
+	CodeSuccess         = 0
+	CodeFail            = 1
+	CodeUnknownError    = -1
+	CodeSessionError    = 40000
+	CodeSessionExpired  = 40001
+	CodeTwoFactorNeeded = 40002
+	CodeForbidden       = 40300
+	CodeRoomNotFound    = 40400
+	CodeRoomFull        = 40900
+	CodeTooManyRequests = 42900
 )
 
 var MsgCodeMap = map[int]string{
-	CodeUnknownError: "unKnow error",
-	CodeSuccess:      "success",
-	CodeFail:         "fail",
-	CodeSessionError: "Session error",
+	CodeUnknownError:    "unKnow error",
+	CodeSuccess:         "success",
+	CodeFail:            "fail",
+	CodeSessionError:    "Session error",
+	CodeSessionExpired:  "Session expired",
+	CodeTwoFactorNeeded: "Two factor required",
+	CodeForbidden:       "Permission denied",
+	CodeRoomNotFound:    "Room not found",
+	CodeRoomFull:        "Room is full",
+	CodeTooManyRequests: "Too many requests",
 }
 
 func SuccessWithMsg(c *gin.Context, msg interface{}, data interface{}) {
@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"fmt"
+	"gochat/config"
+	"gochat/internal/pkg/authtoken"
+)
+
+// gochat_token_deny_jti 被吊销的 access token，ttl 到 token 本身过期为止
+func GetTokenDenyKey(tokenId string) string {
+	return config.RedisTokenDenyPrefix + tokenId
+}
+
+// gochat_refresh_token : userData
+func GetRefreshTokenKey(refreshToken string) string {
+	return config.RedisRefreshPrefix + refreshToken
+}
+
+// gochat_refresh_set_78 : {refreshToken1, refreshToken2}
+func GetRefreshTokenSetKey(userId int) string {
+	return fmt.Sprintf("%s%d", config.RedisRefreshSetPrefix, userId)
+}
+
+// 签名 token 模式下本地验签，只多查一次黑名单，不用走 rpc
+func VerifyAccessToken(accessToken string) (claims *authtoken.Claims, err error) {
+	claims, err = authtoken.Parse(accessToken, []byte(config.Conf.Api.ApiAuth.TokenSecret))
+	if err != nil {
+		return nil, err
+	}
+	redisClient := GetRedisInstance(RedisOption{
+		Address:  config.Conf.Common.CommonRedis.RedisAddress,
+		Password: config.Conf.Common.CommonRedis.RedisPassword,
+		Db:       config.Conf.Common.CommonRedis.Db,
+	})
+	denied, err := redisClient.Exists(GetTokenDenyKey(claims.TokenId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if denied > 0 {
+		return nil, authtoken.ErrTokenRevoked
+	}
+	return claims, nil
+}
@@ -0,0 +1,251 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"gochat/logic/dao"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 机器人账号和 api key：用户建自己的机器人，给机器人发限定权限、限定房间的长期 key
+
+const (
+	apiKeyPrefix        = "gck_"
+	apiKeyShowLen       = 12               // 列表里展示明文前几位
+	apiKeyTouchInterval = 60 * time.Second // 最近使用时间最多一分钟写一次库
+)
+
+var apiKeyScopes = map[string]bool{
+	config.ApiKeyScopePushRoom:    true,
+	config.ApiKeyScopeHistoryRead: true,
+}
+
+func hashApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func splitApiKeyRooms(rooms string) (list []int) {
+	for _, item := range strings.Split(rooms, ",") {
+		if roomId, err := strconv.Atoi(item); err == nil {
+			list = append(list, roomId)
+		}
+	}
+	return
+}
+
+func splitApiKeyScopes(scopes string) (list []string) {
+	for _, item := range strings.Split(scopes, ",") {
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func toApiKeyInfo(key dao.ApiKey) proto.ApiKeyInfo {
+	return proto.ApiKeyInfo{
+		Id:           key.Id,
+		BotUserId:    key.UserId,
+		Name:         key.Name,
+		KeyPrefix:    key.KeyPrefix,
+		Scopes:       splitApiKeyScopes(key.Scopes),
+		Rooms:        splitApiKeyRooms(key.Rooms),
+		Revoked:      key.Revoked,
+		ExpireTime:   formatTimePtr(key.ExpireTime),
+		LastUsedTime: formatTimePtr(key.LastUsedTime),
+		CreateTime:   key.CreateTime.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func toBotInfo(user dao.User) proto.BotInfo {
+	return proto.BotInfo{
+		UserId:     user.Id,
+		UserName:   user.UserName,
+		CreateTime: user.CreateTime.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 当前登录用户必须是这个机器人的主人
+func checkBotOwner(authToken string, botUserId int) (bot dao.User, err error) {
+	userId, _, _, err := authUser(authToken)
+	if err != nil {
+		return
+	}
+	if userId == 0 {
+		return bot, errors.New("no this user session")
+	}
+	u := new(dao.User)
+	bot = u.GetUserById(botUserId)
+	if bot.Id == 0 || !bot.IsBot || bot.BotOwnerId != userId {
+		return bot, errors.New("no this bot")
+	}
+	return
+}
+
+func (rpc *RpcLogic) CreateBot(ctx context.Context, args *proto.CreateBotRequest, reply *proto.CreateBotResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	u := new(dao.User)
+	if u.GetUserById(userId).IsBot {
+		return errors.New("bot can not create bot")
+	}
+	u.UserName = strings.TrimSpace(args.Name)
+	botId, err := u.AddBot(userId)
+	if err != nil {
+		logrus.Infof("create bot err:%s", err.Error())
+		return err
+	}
+	reply.Bot = toBotInfo(u.GetUserById(botId))
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) ListBots(ctx context.Context, args *proto.ListBotsRequest, reply *proto.ListBotsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	u := new(dao.User)
+	bots := u.ListBotsByOwner(userId)
+	reply.Bots = make([]proto.BotInfo, 0, len(bots))
+	for _, bot := range bots {
+		reply.Bots = append(reply.Bots, toBotInfo(bot))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 给机器人发 key，必须指定权限和房间
+func (rpc *RpcLogic) CreateApiKey(ctx context.Context, args *proto.CreateApiKeyRequest, reply *proto.CreateApiKeyResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	bot, err := checkBotOwner(args.AuthToken, args.BotUserId)
+	if err != nil {
+		return err
+	}
+	if len(args.Scopes) == 0 || len(args.Rooms) == 0 {
+		return errors.New("api key scopes and rooms required")
+	}
+	for _, scope := range args.Scopes {
+		if !apiKeyScopes[scope] {
+			return errors.Errorf("unknown api key scope: %s", scope)
+		}
+	}
+	rooms := make([]string, 0, len(args.Rooms))
+	for _, roomId := range args.Rooms {
+		if roomId <= 0 {
+			return errors.New("api key room invalid")
+		}
+		rooms = append(rooms, strconv.Itoa(roomId))
+	}
+	apiKey := apiKeyPrefix + tools.GetRandomToken(32)
+	key := &dao.ApiKey{
+		UserId:    bot.Id,
+		Name:      strings.TrimSpace(args.Name),
+		KeyPrefix: apiKey[:apiKeyShowLen],
+		KeyHash:   hashApiKey(apiKey),
+		Scopes:    strings.Join(args.Scopes, ","),
+		Rooms:     strings.Join(rooms, ","),
+	}
+	if args.ExpireDays > 0 {
+		expireTime := time.Now().AddDate(0, 0, args.ExpireDays)
+		key.ExpireTime = &expireTime
+	}
+	if _, err = key.Add(); err != nil {
+		logrus.Errorf("create api key err:%s", err.Error())
+		return err
+	}
+	reply.ApiKey = apiKey
+	reply.Key = toApiKeyInfo(*key)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) ListApiKeys(ctx context.Context, args *proto.ListApiKeysRequest, reply *proto.ListApiKeysResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	bot, err := checkBotOwner(args.AuthToken, args.BotUserId)
+	if err != nil {
+		return err
+	}
+	k := new(dao.ApiKey)
+	keys := k.ListByUserId(bot.Id)
+	reply.Keys = make([]proto.ApiKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		reply.Keys = append(reply.Keys, toApiKeyInfo(key))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) RevokeApiKey(ctx context.Context, args *proto.RevokeApiKeyRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	k := new(dao.ApiKey)
+	key := k.GetById(args.KeyId)
+	if key.Id == 0 {
+		return errors.New("no this api key")
+	}
+	if _, err = checkBotOwner(args.AuthToken, key.UserId); err != nil {
+		return err
+	}
+	if err = k.Revoke(key.Id); err != nil {
+		logrus.Errorf("revoke api key err:%s", err.Error())
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// api 层拿 X-Api-Key 来换机器人身份、权限和房间
+func (rpc *RpcLogic) AuthApiKey(ctx context.Context, args *proto.AuthApiKeyRequest, reply *proto.AuthApiKeyResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	if !strings.HasPrefix(args.ApiKey, apiKeyPrefix) {
+		return errors.New("api key invalid")
+	}
+	k := new(dao.ApiKey)
+	key := k.GetByHash(hashApiKey(args.ApiKey))
+	now := time.Now()
+	if key.Id == 0 || key.Revoked || (key.ExpireTime != nil && now.After(*key.ExpireTime)) {
+		return errors.New("api key invalid")
+	}
+	u := new(dao.User)
+	bot := u.GetUserById(key.UserId)
+	if bot.Id == 0 || !bot.IsBot {
+		return errors.New("api key invalid")
+	}
+	if key.LastUsedTime == nil || now.Sub(*key.LastUsedTime) > apiKeyTouchInterval {
+		if err := k.Touch(key.Id, now); err != nil {
+			logrus.Warnf("touch api key err:%s", err.Error())
+		}
+	}
+	reply.UserId = bot.Id
+	reply.UserName = bot.UserName
+	reply.Scopes = splitApiKeyScopes(key.Scopes)
+	reply.Rooms = splitApiKeyRooms(key.Rooms)
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ApiKey 表，机器人账号的长期密钥，只存 sha256，明文只在创建时给一次
+type ApiKey struct {
+	Id           int    `gorm:"primary_key"`
+	UserId       int    `gorm:"index;not null"` // 机器人账号
+	Name         string `gorm:"type:varchar(64);not null;default:''"`
+	KeyPrefix    string `gorm:"type:varchar(16);not null;default:''"` // 明文前几位，列表里给人认
+	KeyHash      string `gorm:"type:char(64);uniqueIndex;not null"`
+	Scopes       string `gorm:"type:varchar(255);not null;default:''"`  // 逗号分隔，见 config.ApiKeyScope*
+	Rooms        string `gorm:"type:varchar(1024);not null;default:''"` // 逗号分隔的房间号，只能在这些房间用
+	Revoked      bool   `gorm:"not null;default:false"`
+	ExpireTime   *time.Time
+	LastUsedTime *time.Time
+	CreateTime   time.Time
+	db.DbGoChat
+}
+
+func (k *ApiKey) TableName() string {
+	return "api_key"
+}
+
+func (k *ApiKey) Add() (keyId int, err error) {
+	if k.UserId <= 0 || k.KeyHash == "" {
+		return 0, errors.New("api key userId or hash empty!")
+	}
+	k.CreateTime = time.Now()
+	if err = dbIns.Table(k.TableName()).Create(k).Error; err != nil {
+		return 0, err
+	}
+	return k.Id, nil
+}
+
+func (k *ApiKey) GetByHash(keyHash string) (data ApiKey) {
+	dbIns.Table(k.TableName()).Where("key_hash=?", keyHash).Take(&data)
+	return
+}
+
+func (k *ApiKey) GetById(keyId int) (data ApiKey) {
+	dbIns.Table(k.TableName()).Where("id=?", keyId).Take(&data)
+	return
+}
+
+func (k *ApiKey) ListByUserId(userId int) (list []ApiKey) {
+	dbIns.Table(k.TableName()).Where("user_id=?", userId).Order("id").Find(&list)
+	return
+}
+
+func (k *ApiKey) Revoke(keyId int) (err error) {
+	return dbIns.Table(k.TableName()).Where("id=?", keyId).Update("revoked", true).Error
+}
+
+func (k *ApiKey) Touch(keyId int, usedTime time.Time) (err error) {
+	return dbIns.Table(k.TableName()).Where("id=?", keyId).Update("last_used_time", usedTime).Error
+}
@@ -0,0 +1,256 @@
+package dao
+
+import (
+	"gochat/config"
+	"gochat/db"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// 默认大厅，老客户端都进 1 号房间
+const DefaultRoomId = 1
+
+// LIKE 里的通配符按普通字符搜，转义符用 ! 省得 mysql 和 sqlite 对反斜杠理解不一样
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Room 表，房间的名字、房主和状态；归档的房间进不去也不能发言
+type Room struct {
+	Id             int    `gorm:"primary_key"`
+	Name           string `gorm:"type:varchar(64);not null;default:''"`
+	Description    string `gorm:"type:varchar(512);not null;default:''"`
+	Topic          string `gorm:"type:varchar(256);not null;default:''"`  // 当前话题，房间目录里展示
+	Announcement   string `gorm:"type:varchar(1024);not null;default:''"` // 公告，进房间时显示在顶上
+	SpaceId        int    `gorm:"not null;default:0;index"`               // 所属空间，0 是不属于任何空间的全局房间
+	OwnerId        int    `gorm:"not null;default:0;index"`               // 0 是系统建的房间
+	Archived       bool   `gorm:"not null;default:false"`
+	Private        bool   `gorm:"not null;default:false"`                     // 私有房间只有成员能进、能看、能发言
+	SlowMode       int    `gorm:"not null;default:0"`                         // 慢速模式，每个用户多少秒能发一条，0 不限
+	MaxMembers     int    `gorm:"not null;default:0"`                         // 成员上限，0 不限
+	MaxOnline      int    `gorm:"not null;default:0"`                         // 同时在线上限，0 不限
+	OverflowPolicy string `gorm:"type:varchar(16);not null;default:'reject'"` // 满了以后：reject 拒绝，spectate 以观众身份进
+	CreateTime     time.Time
+	UpdateTime     time.Time
+	db.DbGoChat
+}
+
+func (r *Room) TableName() string {
+	return "room"
+}
+
+// 没有默认大厅就补一个，老数据里的消息都在 1 号房间
+func (r *Room) SeedDefault() (err error) {
+	var count int64
+	if err = dbIns.Table(r.TableName()).Where("id=?", DefaultRoomId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	now := time.Now()
+	data := Room{Id: DefaultRoomId, Name: "lobby", CreateTime: now, UpdateTime: now}
+	return dbIns.Table(r.TableName()).Create(&data).Error
+}
+
+func (r *Room) Add() (roomId int, err error) {
+	if r.Name == "" {
+		return 0, errors.New("room name empty!")
+	}
+	r.CreateTime = time.Now()
+	r.UpdateTime = r.CreateTime
+	if err = dbIns.Table(r.TableName()).Create(r).Error; err != nil {
+		return 0, err
+	}
+	return r.Id, nil
+}
+
+// 建房间顺带把建的人设成房主，并且加进成员名单
+func (r *Room) AddWithOwner() (roomId int, err error) {
+	if r.Name == "" || r.OwnerId <= 0 {
+		return 0, errors.New("room name or owner empty!")
+	}
+	now := time.Now()
+	r.CreateTime = now
+	r.UpdateTime = now
+	err = dbIns.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(r.TableName()).Create(r).Error; err != nil {
+			return err
+		}
+		role := RoomRole{RoomId: r.Id, UserId: r.OwnerId, Role: config.RoomRoleOwner, CreateTime: now}
+		if err := tx.Table(role.TableName()).Create(&role).Error; err != nil {
+			return err
+		}
+		member := RoomMember{RoomId: r.Id, UserId: r.OwnerId, CreateTime: now}
+		return tx.Table(member.TableName()).Create(&member).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return r.Id, nil
+}
+
+func (r *Room) GetById(roomId int) (data Room) {
+	dbIns.Table(r.TableName()).Where("id=?", roomId).Take(&data)
+	return
+}
+
+// 房间目录的排序，在线人数在 redis 里，SQL 排不了
+const (
+	RoomOrderMembers = "members"
+	RoomOrderName    = "name"
+	RoomOrderNewest  = "newest"
+)
+
+// 房间目录的查询条件；AllVisible 是全局管理员，什么房间都能看
+type RoomDirectoryQuery struct {
+	UserId         int
+	AllVisible     bool
+	MemberSpaceIds []int  // 用户是成员的空间
+	ManageSpaceIds []int  // 用户是 owner/admin 的空间，里面的私有房间也能看
+	SpaceId        int    // 只列这个空间里的房间，0 不限
+	Query          string // 按名字、话题、简介模糊搜
+	Order          string // RoomOrderXXX，空的按 id 排
+	HasAfter       bool   // 从上一页最后一个房间之后开始
+	AfterNum       int
+	AfterName      string
+	AfterId        int
+	Limit          int // 0 不限
+}
+
+// 房间目录的一行，带上成员数和排序用的小写名字
+type RoomDirectoryRow struct {
+	Room
+	MemberCount int
+	SortName    string
+}
+
+// 没归档、用户看得到的房间，可见性、排序和翻页都在 SQL 里做
+func (r *Room) ListDirectory(q RoomDirectoryQuery) (list []RoomDirectoryRow) {
+	m := new(RoomMember)
+	tx := dbIns.Table(r.TableName()).
+		Select("room.*, COALESCE(mc.member_count, 0) AS member_count, LOWER(room.name) AS sort_name").
+		Joins("LEFT JOIN (SELECT room_id, COUNT(*) AS member_count FROM "+m.TableName()+" GROUP BY room_id) mc ON mc.room_id = room.id").
+		Where("room.archived = ?", false)
+	if q.SpaceId > 0 {
+		tx = tx.Where("room.space_id = ?", q.SpaceId)
+	}
+	if q.Query != "" {
+		like := "%" + likeEscaper.Replace(q.Query) + "%"
+		tx = tx.Where("(room.name LIKE ? ESCAPE '!' OR room.topic LIKE ? ESCAPE '!' OR room.description LIKE ? ESCAPE '!')", like, like, like)
+	}
+	if !q.AllVisible {
+		// 空间里的房间只给空间成员看；私有房间只给房间成员和空间的 owner/admin 看
+		if len(q.MemberSpaceIds) > 0 {
+			tx = tx.Where("(room.space_id = 0 OR room.space_id IN ?)", q.MemberSpaceIds)
+		} else {
+			tx = tx.Where("room.space_id = 0")
+		}
+		memberRooms := dbIns.Table(m.TableName()).Select("room_id").Where("user_id = ?", q.UserId)
+		if len(q.ManageSpaceIds) > 0 {
+			tx = tx.Where("(room.private = ? OR room.id IN (?) OR room.space_id IN ?)", false, memberRooms, q.ManageSpaceIds)
+		} else {
+			tx = tx.Where("(room.private = ? OR room.id IN (?))", false, memberRooms)
+		}
+	}
+	switch q.Order {
+	case RoomOrderMembers:
+		if q.HasAfter {
+			tx = tx.Where("(COALESCE(mc.member_count, 0) < ? OR (COALESCE(mc.member_count, 0) = ? AND room.id > ?))", q.AfterNum, q.AfterNum, q.AfterId)
+		}
+		tx = tx.Order("member_count DESC, room.id")
+	case RoomOrderName:
+		if q.HasAfter {
+			tx = tx.Where("(LOWER(room.name) > ? OR (LOWER(room.name) = ? AND room.id > ?))", q.AfterName, q.AfterName, q.AfterId)
+		}
+		tx = tx.Order("sort_name, room.id")
+	case RoomOrderNewest:
+		if q.HasAfter {
+			tx = tx.Where("room.id < ?", q.AfterId)
+		}
+		tx = tx.Order("room.id DESC")
+	default:
+		tx = tx.Order("room.id")
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	tx.Find(&list)
+	return
+}
+
+// 空间里的房间，包括归档的
+func (r *Room) ListBySpaceId(spaceId int) (list []Room) {
+	dbIns.Table(r.TableName()).Where("space_id=?", spaceId).Order("id").Find(&list)
+	return
+}
+
+func (r *Room) CountBySpaceId(spaceId int) (count int64) {
+	dbIns.Table(r.TableName()).Where("space_id=?", spaceId).Count(&count)
+	return
+}
+
+func (r *Room) UpdateName(roomId int, name string, description string) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"update_time": time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdatePrivate(roomId int, private bool) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"private":     private,
+		"update_time": time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdateTopic(roomId int, topic string) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"topic":       topic,
+		"update_time": time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdateAnnouncement(roomId int, announcement string) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"announcement": announcement,
+		"update_time":  time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdateCapacity(roomId int, maxMembers int, maxOnline int, overflowPolicy string) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"max_members":     maxMembers,
+		"max_online":      maxOnline,
+		"overflow_policy": overflowPolicy,
+		"update_time":     time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdateSlowMode(roomId int, seconds int) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"slow_mode":   seconds,
+		"update_time": time.Now(),
+	}).Error
+}
+
+func (r *Room) UpdateArchived(roomId int, archived bool) (err error) {
+	return dbIns.Table(r.TableName()).Where("id=?", roomId).Updates(map[string]interface{}{
+		"archived":    archived,
+		"update_time": time.Now(),
+	}).Error
+}
+
+// 删房间连同房间里的角色、成员、邀请、申请、封禁和置顶一起删，消息记录留着
+func (r *Room) Delete(roomId int) (err error) {
+	return dbIns.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&RoomRole{}, &RoomMember{}, &RoomInvite{}, &RoomJoinRequest{}, &RoomBan{}, &RoomPin{}} {
+			if err := tx.Where("room_id=?", roomId).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Table(r.TableName()).Where("id=?", roomId).Delete(&Room{}).Error
+	})
+}
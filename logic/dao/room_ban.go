@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// RoomBan 表，被封禁的用户进不了房间、看不了也发不了，直到解封
+type RoomBan struct {
+	Id         int    `gorm:"primary_key"`
+	RoomId     int    `gorm:"not null;uniqueIndex:idx_room_ban_room_user"`
+	UserId     int    `gorm:"not null;uniqueIndex:idx_room_ban_room_user;index"`
+	BannedBy   int    `gorm:"not null;default:0"`
+	Reason     string `gorm:"type:varchar(200);not null;default:''"`
+	CreateTime time.Time
+	db.DbGoChat
+}
+
+func (b *RoomBan) TableName() string {
+	return "room_ban"
+}
+
+func (b *RoomBan) IsBanned(roomId int, userId int) bool {
+	var count int64
+	dbIns.Table(b.TableName()).Where("room_id=? and user_id=?", roomId, userId).Count(&count)
+	return count > 0
+}
+
+// 封禁，已经封过就更新原因和操作人
+func (b *RoomBan) Ban(roomId int, userId int, bannedBy int, reason string) (err error) {
+	if roomId <= 0 || userId <= 0 {
+		return errors.New("roomId or userId empty!")
+	}
+	data := RoomBan{RoomId: roomId, UserId: userId, BannedBy: bannedBy, Reason: reason, CreateTime: time.Now()}
+	return dbIns.Table(b.TableName()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"banned_by", "reason"}),
+	}).Create(&data).Error
+}
+
+func (b *RoomBan) Unban(roomId int, userId int) (err error) {
+	return dbIns.Table(b.TableName()).Where("room_id=? and user_id=?", roomId, userId).Delete(&RoomBan{}).Error
+}
+
+func (b *RoomBan) ListByRoomId(roomId int) (list []RoomBan) {
+	dbIns.Table(b.TableName()).Where("room_id=?", roomId).Order("id").Find(&list)
+	return
+}
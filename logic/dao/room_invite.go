@@ -0,0 +1,158 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// 邀请和入群申请的状态
+const (
+	RoomRequestPending  = "pending"
+	RoomRequestAccepted = "accepted"
+	RoomRequestRejected = "rejected"
+)
+
+// RoomInvite 表，房间管理员邀请某个用户，对方接受以后成为成员
+type RoomInvite struct {
+	Id         int    `gorm:"primary_key"`
+	RoomId     int    `gorm:"not null;index"`
+	UserId     int    `gorm:"not null;index"` // 被邀请的人
+	InviterId  int    `gorm:"not null;default:0"`
+	Status     string `gorm:"type:varchar(16);not null;default:'pending'"`
+	CreateTime time.Time
+	UpdateTime time.Time
+	db.DbGoChat
+}
+
+func (i *RoomInvite) TableName() string {
+	return "room_invite"
+}
+
+func (i *RoomInvite) GetById(inviteId int) (data RoomInvite) {
+	dbIns.Table(i.TableName()).Where("id=?", inviteId).Take(&data)
+	return
+}
+
+// 同一个房间同一个人只留一条待处理的邀请
+func (i *RoomInvite) GetPending(roomId int, userId int) (data RoomInvite) {
+	dbIns.Table(i.TableName()).Where("room_id=? and user_id=? and status=?", roomId, userId, RoomRequestPending).Take(&data)
+	return
+}
+
+func (i *RoomInvite) Add() (inviteId int, err error) {
+	if i.RoomId <= 0 || i.UserId <= 0 {
+		return 0, errors.New("invite roomId or userId empty!")
+	}
+	i.Status = RoomRequestPending
+	i.CreateTime = time.Now()
+	i.UpdateTime = i.CreateTime
+	if err = dbIns.Table(i.TableName()).Create(i).Error; err != nil {
+		return 0, err
+	}
+	return i.Id, nil
+}
+
+func (i *RoomInvite) ListPendingByUserId(userId int) (list []RoomInvite) {
+	dbIns.Table(i.TableName()).Where("user_id=? and status=?", userId, RoomRequestPending).Order("id desc").Find(&list)
+	return
+}
+
+// 处理邀请，只有待处理的能改；接受时顺带加成员
+func (i *RoomInvite) Resolve(inviteId int, accept bool) (ok bool, err error) {
+	status := RoomRequestRejected
+	if accept {
+		status = RoomRequestAccepted
+	}
+	err = dbIns.Transaction(func(tx *gorm.DB) error {
+		var data RoomInvite
+		if err := tx.Table(i.TableName()).Where("id=?", inviteId).Take(&data).Error; err != nil {
+			return err
+		}
+		res := tx.Table(i.TableName()).Where("id=? and status=?", inviteId, RoomRequestPending).
+			Updates(map[string]interface{}{"status": status, "update_time": time.Now()})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		ok = true
+		if !accept {
+			return nil
+		}
+		member := RoomMember{RoomId: data.RoomId, UserId: data.UserId, CreateTime: time.Now()}
+		return tx.Table(member.TableName()).Where("room_id=? and user_id=?", data.RoomId, data.UserId).FirstOrCreate(&member).Error
+	})
+	return
+}
+
+// RoomJoinRequest 表，用户申请加入私有房间，房间管理员审批
+type RoomJoinRequest struct {
+	Id         int    `gorm:"primary_key"`
+	RoomId     int    `gorm:"not null;index"`
+	UserId     int    `gorm:"not null;index"`
+	Message    string `gorm:"type:varchar(200);not null;default:''"`
+	Status     string `gorm:"type:varchar(16);not null;default:'pending'"`
+	HandledBy  int    `gorm:"not null;default:0"`
+	CreateTime time.Time
+	UpdateTime time.Time
+	db.DbGoChat
+}
+
+func (r *RoomJoinRequest) TableName() string {
+	return "room_join_request"
+}
+
+func (r *RoomJoinRequest) GetById(requestId int) (data RoomJoinRequest) {
+	dbIns.Table(r.TableName()).Where("id=?", requestId).Take(&data)
+	return
+}
+
+func (r *RoomJoinRequest) GetPending(roomId int, userId int) (data RoomJoinRequest) {
+	dbIns.Table(r.TableName()).Where("room_id=? and user_id=? and status=?", roomId, userId, RoomRequestPending).Take(&data)
+	return
+}
+
+func (r *RoomJoinRequest) Add() (requestId int, err error) {
+	if r.RoomId <= 0 || r.UserId <= 0 {
+		return 0, errors.New("join request roomId or userId empty!")
+	}
+	r.Status = RoomRequestPending
+	r.CreateTime = time.Now()
+	r.UpdateTime = r.CreateTime
+	if err = dbIns.Table(r.TableName()).Create(r).Error; err != nil {
+		return 0, err
+	}
+	return r.Id, nil
+}
+
+func (r *RoomJoinRequest) ListPendingByRoomId(roomId int) (list []RoomJoinRequest) {
+	dbIns.Table(r.TableName()).Where("room_id=? and status=?", roomId, RoomRequestPending).Order("id").Find(&list)
+	return
+}
+
+// 审批申请，只有待处理的能改；通过时顺带加成员
+func (r *RoomJoinRequest) Resolve(requestId int, approve bool, handledBy int) (ok bool, err error) {
+	status := RoomRequestRejected
+	if approve {
+		status = RoomRequestAccepted
+	}
+	err = dbIns.Transaction(func(tx *gorm.DB) error {
+		var data RoomJoinRequest
+		if err := tx.Table(r.TableName()).Where("id=?", requestId).Take(&data).Error; err != nil {
+			return err
+		}
+		res := tx.Table(r.TableName()).Where("id=? and status=?", requestId, RoomRequestPending).
+			Updates(map[string]interface{}{"status": status, "handled_by": handledBy, "update_time": time.Now()})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		ok = true
+		if !approve {
+			return nil
+		}
+		member := RoomMember{RoomId: data.RoomId, UserId: data.UserId, CreateTime: time.Now()}
+		return tx.Table(member.TableName()).Where("room_id=? and user_id=?", data.RoomId, data.UserId).FirstOrCreate(&member).Error
+	})
+	return
+}
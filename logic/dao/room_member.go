@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// RoomMember 表，房间的成员名单；私有房间只有成员能进，公开房间进过就记成员，用来算成员数
+type RoomMember struct {
+	Id         int `gorm:"primary_key"`
+	RoomId     int `gorm:"not null;uniqueIndex:idx_room_member_room_user"`
+	UserId     int `gorm:"not null;uniqueIndex:idx_room_member_room_user;index"`
+	CreateTime time.Time
+	db.DbGoChat
+}
+
+func (m *RoomMember) TableName() string {
+	return "room_member"
+}
+
+func (m *RoomMember) IsMember(roomId int, userId int) bool {
+	var count int64
+	dbIns.Table(m.TableName()).Where("room_id=? and user_id=?", roomId, userId).Count(&count)
+	return count > 0
+}
+
+// 加成员，已经是成员不报错
+func (m *RoomMember) AddMember(roomId int, userId int) (err error) {
+	if roomId <= 0 || userId <= 0 {
+		return errors.New("roomId or userId empty!")
+	}
+	data := RoomMember{RoomId: roomId, UserId: userId, CreateTime: time.Now()}
+	return dbIns.Table(m.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(&data).Error
+}
+
+func (m *RoomMember) RemoveMember(roomId int, userId int) (err error) {
+	return dbIns.Table(m.TableName()).Where("room_id=? and user_id=?", roomId, userId).Delete(&RoomMember{}).Error
+}
+
+func (m *RoomMember) ListByRoomId(roomId int) (list []RoomMember) {
+	dbIns.Table(m.TableName()).Where("room_id=?", roomId).Order("id").Find(&list)
+	return
+}
+
+// 用户加入的房间 id
+func (m *RoomMember) ListRoomIdsByUserId(userId int) (roomIds []int) {
+	dbIns.Table(m.TableName()).Where("user_id=?", userId).Pluck("room_id", &roomIds)
+	return
+}
+
+// 一批房间各自的成员数
+func (m *RoomMember) CountByRoomIds(roomIds []int) (counts map[int]int) {
+	counts = make(map[int]int, len(roomIds))
+	if len(roomIds) == 0 {
+		return
+	}
+	var rows []struct {
+		RoomId int
+		Total  int
+	}
+	dbIns.Table(m.TableName()).Select("room_id, count(*) as total").
+		Where("room_id IN ?", roomIds).Group("room_id").Scan(&rows)
+	for _, row := range rows {
+		counts[row.RoomId] = row.Total
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// RoomPin 表，房间里置顶的消息，MessageId 是 chat_message.id
+type RoomPin struct {
+	Id         int   `gorm:"primary_key"`
+	RoomId     int   `gorm:"not null;uniqueIndex:idx_room_pin_room_message"`
+	MessageId  int64 `gorm:"not null;uniqueIndex:idx_room_pin_room_message"`
+	PinnedBy   int   `gorm:"not null;default:0"`
+	CreateTime time.Time
+	db.DbGoChat
+}
+
+func (p *RoomPin) TableName() string {
+	return "room_pin"
+}
+
+// 置顶，已经置顶的不报错
+func (p *RoomPin) Pin(roomId int, messageId int64, pinnedBy int) (err error) {
+	if roomId <= 0 || messageId <= 0 {
+		return errors.New("roomId or messageId empty!")
+	}
+	data := RoomPin{RoomId: roomId, MessageId: messageId, PinnedBy: pinnedBy, CreateTime: time.Now()}
+	return dbIns.Table(p.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(&data).Error
+}
+
+// 取消置顶，返回有没有删掉
+func (p *RoomPin) Unpin(roomId int, messageId int64) (removed bool, err error) {
+	result := dbIns.Table(p.TableName()).Where("room_id=? and message_id=?", roomId, messageId).Delete(&RoomPin{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (p *RoomPin) CountByRoomId(roomId int) (count int64) {
+	dbIns.Table(p.TableName()).Where("room_id=?", roomId).Count(&count)
+	return
+}
+
+// 最新置顶的在前
+func (p *RoomPin) ListByRoomId(roomId int) (list []RoomPin) {
+	dbIns.Table(p.TableName()).Where("room_id=?", roomId).Order("id desc").Find(&list)
+	return
+}
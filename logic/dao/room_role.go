@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// RoomRole 表，用户在某个房间里的角色；没有记录的按默认角色算
+type RoomRole struct {
+	Id         int    `gorm:"primary_key"`
+	RoomId     int    `gorm:"not null;uniqueIndex:idx_room_role_room_user"`
+	UserId     int    `gorm:"not null;uniqueIndex:idx_room_role_room_user;index"`
+	Role       string `gorm:"type:varchar(16);not null;default:''"`
+	CreateTime time.Time
+	db.DbGoChat
+}
+
+func (r *RoomRole) TableName() string {
+	return "room_role"
+}
+
+func (r *RoomRole) GetRole(roomId int, userId int) (role string) {
+	var data RoomRole
+	dbIns.Table(r.TableName()).Where("room_id=? and user_id=?", roomId, userId).Take(&data)
+	return data.Role
+}
+
+// 设置角色，已有就覆盖
+func (r *RoomRole) SetRole(roomId int, userId int, role string) (err error) {
+	if roomId <= 0 || userId <= 0 || role == "" {
+		return errors.New("roomId or userId or role empty!")
+	}
+	data := RoomRole{RoomId: roomId, UserId: userId, Role: role, CreateTime: time.Now()}
+	return dbIns.Table(r.TableName()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&data).Error
+}
+
+// 删掉记录，回到默认角色
+func (r *RoomRole) DeleteRole(roomId int, userId int) (err error) {
+	return dbIns.Table(r.TableName()).Where("room_id=? and user_id=?", roomId, userId).Delete(&RoomRole{}).Error
+}
+
+func (r *RoomRole) ListByRoomId(roomId int) (list []RoomRole) {
+	dbIns.Table(r.TableName()).Where("room_id=?", roomId).Order("id").Find(&list)
+	return
+}
@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"gochat/config"
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Space 表，一组房间和它们共同的成员；不是空间成员进不了空间里的房间
+type Space struct {
+	Id          int    `gorm:"primary_key"`
+	Name        string `gorm:"type:varchar(64);not null;default:''"`
+	Description string `gorm:"type:varchar(512);not null;default:''"`
+	OwnerId     int    `gorm:"not null;default:0;index"`
+	Private     bool   `gorm:"not null;default:false"` // 私有空间只能由空间管理员拉人，不能自己加入
+	CreateTime  time.Time
+	UpdateTime  time.Time
+	db.DbGoChat
+}
+
+func (s *Space) TableName() string {
+	return "space"
+}
+
+// 建空间顺带把建的人设成 owner
+func (s *Space) AddWithOwner() (spaceId int, err error) {
+	if s.Name == "" || s.OwnerId <= 0 {
+		return 0, errors.New("space name or owner empty!")
+	}
+	now := time.Now()
+	s.CreateTime = now
+	s.UpdateTime = now
+	err = dbIns.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(s.TableName()).Create(s).Error; err != nil {
+			return err
+		}
+		member := SpaceMember{SpaceId: s.Id, UserId: s.OwnerId, Role: config.SpaceRoleOwner, CreateTime: now}
+		return tx.Table(member.TableName()).Create(&member).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return s.Id, nil
+}
+
+func (s *Space) GetById(spaceId int) (data Space) {
+	dbIns.Table(s.TableName()).Where("id=?", spaceId).Take(&data)
+	return
+}
+
+// 公开空间加上 spaceIds 里的空间，按 id 排
+func (s *Space) ListVisible(spaceIds []int) (list []Space) {
+	query := dbIns.Table(s.TableName()).Where("private=?", false)
+	if len(spaceIds) > 0 {
+		query = dbIns.Table(s.TableName()).Where("private=? OR id IN ?", false, spaceIds)
+	}
+	query.Order("id").Find(&list)
+	return
+}
+
+func (s *Space) UpdateName(spaceId int, name string, description string) (err error) {
+	return dbIns.Table(s.TableName()).Where("id=?", spaceId).Updates(map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"update_time": time.Now(),
+	}).Error
+}
+
+// 删空间连同成员一起删；空间里还有房间的不能删，由调用方检查
+func (s *Space) Delete(spaceId int) (err error) {
+	return dbIns.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("space_id=?", spaceId).Delete(&SpaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(s.TableName()).Where("id=?", spaceId).Delete(&Space{}).Error
+	})
+}
+
+// SpaceMember 表，空间的成员和他们在空间里的角色
+type SpaceMember struct {
+	Id         int    `gorm:"primary_key"`
+	SpaceId    int    `gorm:"not null;uniqueIndex:idx_space_member_space_user"`
+	UserId     int    `gorm:"not null;uniqueIndex:idx_space_member_space_user;index"`
+	Role       string `gorm:"type:varchar(16);not null;default:''"`
+	CreateTime time.Time
+	db.DbGoChat
+}
+
+func (m *SpaceMember) TableName() string {
+	return "space_member"
+}
+
+// 不是成员返回空字符串
+func (m *SpaceMember) GetRole(spaceId int, userId int) (role string) {
+	var data SpaceMember
+	dbIns.Table(m.TableName()).Where("space_id=? and user_id=?", spaceId, userId).Take(&data)
+	return data.Role
+}
+
+// 加成员，已经是成员不报错，角色也不变
+func (m *SpaceMember) AddMember(spaceId int, userId int) (err error) {
+	if spaceId <= 0 || userId <= 0 {
+		return errors.New("spaceId or userId empty!")
+	}
+	data := SpaceMember{SpaceId: spaceId, UserId: userId, Role: config.SpaceRoleMember, CreateTime: time.Now()}
+	return dbIns.Table(m.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(&data).Error
+}
+
+func (m *SpaceMember) SetRole(spaceId int, userId int, role string) (err error) {
+	return dbIns.Table(m.TableName()).Where("space_id=? and user_id=?", spaceId, userId).Update("role", role).Error
+}
+
+func (m *SpaceMember) RemoveMember(spaceId int, userId int) (err error) {
+	return dbIns.Table(m.TableName()).Where("space_id=? and user_id=?", spaceId, userId).Delete(&SpaceMember{}).Error
+}
+
+func (m *SpaceMember) ListBySpaceId(spaceId int) (list []SpaceMember) {
+	dbIns.Table(m.TableName()).Where("space_id=?", spaceId).Order("id").Find(&list)
+	return
+}
+
+// 用户加入的空间 id
+func (m *SpaceMember) ListSpaceIdsByUserId(userId int) (spaceIds []int) {
+	dbIns.Table(m.TableName()).Where("user_id=?", userId).Pluck("space_id", &spaceIds)
+	return
+}
+
+// 用户加入的空间和在里面的角色，spaceId -> role
+func (m *SpaceMember) ListRolesByUserId(userId int) (roles map[int]string) {
+	var list []SpaceMember
+	dbIns.Table(m.TableName()).Where("user_id=?", userId).Find(&list)
+	roles = make(map[int]string, len(list))
+	for _, member := range list {
+		roles[member.SpaceId] = member.Role
+	}
+	return
+}
+
+// 一批空间各自的成员数
+func (m *SpaceMember) CountBySpaceIds(spaceIds []int) (counts map[int]int) {
+	counts = make(map[int]int, len(spaceIds))
+	if len(spaceIds) == 0 {
+		return
+	}
+	var rows []struct {
+		SpaceId int
+		Total   int
+	}
+	dbIns.Table(m.TableName()).Select("space_id, count(*) as total").
+		Where("space_id IN ?", spaceIds).Group("space_id").Scan(&rows)
+	for _, row := range rows {
+		counts[row.SpaceId] = row.Total
+	}
+	return
+}
@@ -6,7 +6,9 @@
 package dao
 
 import (
+	"gochat/config"
 	"gochat/db"
+	"gochat/internal/tools"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,13 +18,40 @@ var dbIns = db.GetDb("gochat")
 
 // User 表
 type User struct {
-	Id         int `gorm:"primary_key"`
-	UserName   string
-	Password   string
-	CreateTime time.Time
+	Id           int `gorm:"primary_key"`
+	UserName     string
+	Password     string
+	CreateTime   time.Time
+	TotpSecret   string `gorm:"type:varchar(64);not null;default:''"`   // 两步验证密钥(base32)
+	TotpEnabled  bool   `gorm:"not null;default:false"`                 // 确认绑定以后才生效
+	TotpRecovery string `gorm:"type:varchar(1024);not null;default:''"` // 恢复码的 sha256，逗号分隔，用一个删一个
+	IsBot        bool   `gorm:"not null;default:false"`                 // 机器人账号，不能密码登录，只能用 api key
+	BotOwnerId   int    `gorm:"not null;default:0"`                     // 谁建的机器人，只有他能管理 api key
+	Role         string `gorm:"type:varchar(16);not null;default:''"`   // 全局角色，admin 是管理员，空是普通用户
 	db.DbGoChat
 }
 
+// 老库里的 user 表是手工建的，只补缺的列，不让 gorm 去改已有列；新加的表直接建
+func AutoMigrate() (err error) {
+	if err = dbIns.AutoMigrate(&UserProfile{}, &ApiKey{}, &RoomRole{}, &Room{}, &RoomMember{}, &RoomInvite{}, &RoomJoinRequest{}, &RoomBan{}, &RoomPin{}, &Space{}, &SpaceMember{}); err != nil {
+		return err
+	}
+	if err = new(Room).SeedDefault(); err != nil {
+		return err
+	}
+	u := new(User)
+	migrator := dbIns.Table(u.TableName()).Migrator()
+	for _, column := range []string{"TotpSecret", "TotpEnabled", "TotpRecovery", "IsBot", "BotOwnerId", "Role"} {
+		if migrator.HasColumn(u, column) {
+			continue
+		}
+		if err = migrator.AddColumn(u, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (u *User) TableName() string {
 	return "user"
 }
@@ -35,6 +64,30 @@ func (u *User) Add() (userId int, err error) {
 	if oUser.Id > 0 {
 		return oUser.Id, nil
 	}
+	// 密码只存哈希，不落明文
+	if u.Password, err = tools.HashPassword(u.Password, config.Conf.Logic.LogicAuth.PasswordCost); err != nil {
+		return 0, err
+	}
+	u.CreateTime = time.Now()
+	if err = dbIns.Table(u.TableName()).Create(&u).Error; err != nil {
+		return 0, err
+	}
+	return u.Id, nil
+}
+
+// 建机器人账号，密码随机生成不对外，机器人只能用 api key
+func (u *User) AddBot(ownerId int) (userId int, err error) {
+	if u.UserName == "" || ownerId <= 0 {
+		return 0, errors.New("bot name or owner empty!")
+	}
+	if oUser := u.CheckHaveUserName(u.UserName); oUser.Id > 0 {
+		return 0, errors.New("this user name already have")
+	}
+	if u.Password, err = tools.HashPassword(tools.GetRandomToken(32), config.Conf.Logic.LogicAuth.PasswordCost); err != nil {
+		return 0, err
+	}
+	u.IsBot = true
+	u.BotOwnerId = ownerId
 	u.CreateTime = time.Now()
 	if err = dbIns.Table(u.TableName()).Create(&u).Error; err != nil {
 		return 0, err
@@ -42,11 +95,21 @@ func (u *User) Add() (userId int, err error) {
 	return u.Id, nil
 }
 
+func (u *User) ListBotsByOwner(ownerId int) (list []User) {
+	dbIns.Table(u.TableName()).Where("is_bot=? and bot_owner_id=?", true, ownerId).Order("id").Find(&list)
+	return
+}
+
 func (u *User) CheckHaveUserName(userName string) (data User) {
 	dbIns.Table(u.TableName()).Where("user_name=?", userName).Take(&data)
 	return
 }
 
+func (u *User) GetUserById(userId int) (data User) {
+	dbIns.Table(u.TableName()).Where("id=?", userId).Take(&data)
+	return
+}
+
 func (u *User) GetUserNameByUserId(userId int) (userName string) {
 	var data User
 	dbIns.Table(u.TableName()).Where("id=?", userId).Take(&data)
@@ -58,3 +121,45 @@ func (u *User) GetUserIdByUserName(userName string) (userId int) {
 	dbIns.Table(u.TableName()).Where("user_name=?", userName).Take(&data)
 	return data.Id
 }
+
+func (u *User) UpdatePassword(userId int, password string) (err error) {
+	if userId <= 0 || password == "" {
+		return errors.New("userId or password empty!")
+	}
+	return dbIns.Table(u.TableName()).Where("id=?", userId).Update("password", password).Error
+}
+
+// 确认绑定两步验证，密钥和恢复码一起写进去
+func (u *User) EnableTotp(userId int, secret string, recovery string) (err error) {
+	if userId <= 0 || secret == "" {
+		return errors.New("userId or totp secret empty!")
+	}
+	return dbIns.Table(u.TableName()).Where("id=?", userId).Updates(map[string]interface{}{
+		"totp_secret":   secret,
+		"totp_enabled":  true,
+		"totp_recovery": recovery,
+	}).Error
+}
+
+func (u *User) DisableTotp(userId int) (err error) {
+	return dbIns.Table(u.TableName()).Where("id=?", userId).Updates(map[string]interface{}{
+		"totp_secret":   "",
+		"totp_enabled":  false,
+		"totp_recovery": "",
+	}).Error
+}
+
+// 恢复码用掉一个；带上旧值做条件，两个请求同时用同一个码只有一个能成功
+func (u *User) UpdateTotpRecovery(userId int, oldRecovery string, recovery string) (ok bool, err error) {
+	res := dbIns.Table(u.TableName()).Where("id=? and totp_recovery=?", userId, oldRecovery).Update("totp_recovery", recovery)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (u *User) UpdateRole(userId int, role string) (err error) {
+	return dbIns.Table(u.TableName()).Where("id=?", userId).Update("role", role).Error
+}
+
+func (u *User) UpdateRoleByUserName(userName string, role string) (rows int64, err error) {
+	res := dbIns.Table(u.TableName()).Where("user_name=?", userName).Update("role", role)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"gochat/db"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// UserProfile 表，一个用户一行，没填过就没有这一行
+type UserProfile struct {
+	UserId      int    `gorm:"primary_key;autoIncrement:false"`
+	DisplayName string `gorm:"type:varchar(64);not null;default:''"`
+	AvatarUrl   string `gorm:"type:varchar(512);not null;default:''"`
+	Bio         string `gorm:"type:varchar(512);not null;default:''"`
+	StatusText  string `gorm:"type:varchar(128);not null;default:''"`
+	Locale      string `gorm:"type:varchar(16);not null;default:''"`
+	TimeZone    string `gorm:"type:varchar(64);not null;default:''"`
+	// 关掉以后房间里的其他人看不到自己的已读位置
+	HideReadReceipts bool `gorm:"not null;default:false"`
+	UpdateTime       time.Time
+	db.DbGoChat
+}
+
+func (p *UserProfile) TableName() string {
+	return "user_profile"
+}
+
+func (p *UserProfile) GetByUserId(userId int) (data UserProfile) {
+	dbIns.Table(p.TableName()).Where("user_id=?", userId).Take(&data)
+	return
+}
+
+// 房间名单之类批量取，没有资料的用户不在返回的 map 里
+func (p *UserProfile) GetByUserIds(userIds []int) (data map[int]UserProfile) {
+	data = make(map[int]UserProfile, len(userIds))
+	if len(userIds) == 0 {
+		return
+	}
+	var list []UserProfile
+	dbIns.Table(p.TableName()).Where("user_id in ?", userIds).Find(&list)
+	for _, item := range list {
+		data[item.UserId] = item
+	}
+	return
+}
+
+// 整行覆盖写，没有就插入
+func (p *UserProfile) Save() (err error) {
+	if p.UserId <= 0 {
+		return errors.New("profile userId empty!")
+	}
+	p.UpdateTime = time.Now()
+	return dbIns.Table(p.TableName()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		UpdateAll: true,
+	}).Create(p).Error
+}
@@ -0,0 +1,205 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 私信：两个人之间一个会话，id 不变；每条私信都落库，会话记着最后一条消息
+
+// 存一条私信，回填会话 id、消息 id 和发送时间
+func saveDirectMessage(ctx context.Context, send *proto.Send) error {
+	store := chatstore.New(db.GetDb("gochat"))
+	conv, err := store.GetOrCreateConversation(ctx, send.FromUserId, send.ToUserId)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	msg := &chatstore.DirectMessage{
+		ConversationID: conv.ID,
+		FromUserID:     send.FromUserId,
+		FromUserName:   send.FromUserName,
+		ToUserID:       send.ToUserId,
+		Content:        send.Msg,
+		CreatedAt:      now.UTC(),
+	}
+	if err = store.SaveDirectMsg(ctx, msg); err != nil {
+		return err
+	}
+	send.ConversationId = conv.ID
+	send.ClientMsgId = msg.ID
+	send.CreateTime = now.Format("2006-01-02 15:04:05")
+	return nil
+}
+
+func toDirectMessageDTO(row chatstore.DirectMessage, profile dao.UserProfile) proto.DirectMessageDTO {
+	dto := proto.DirectMessageDTO{
+		Id:              row.ID,
+		ConversationId:  row.ConversationID,
+		FromUserId:      row.FromUserID,
+		FromUserName:    row.FromUserName,
+		ToUserId:        row.ToUserID,
+		Content:         row.Content,
+		CreateTime:      row.CreatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+		FromDisplayName: displayNameOf(row.FromUserName, profile),
+		FromAvatar:      profile.AvatarUrl,
+	}
+	if row.DeliveredAt != nil {
+		dto.DeliveredAt = row.DeliveredAt.In(time.Local).Format("2006-01-02 15:04:05")
+	}
+	return dto
+}
+
+// 会话列表，最近有消息的在前，带最后一条消息
+func (rpc *RpcLogic) ListConversations(ctx context.Context, args *proto.ListConversationsRequest, reply *proto.ListConversationsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	convs, err := store.ListConversations(ctx, userId, args.Limit)
+	if err != nil {
+		return err
+	}
+	messageIds := make([]int64, 0, len(convs))
+	userIds := make([]int, 0, len(convs)+1)
+	userIds = append(userIds, userId)
+	for _, conv := range convs {
+		messageIds = append(messageIds, conv.LastMessageID)
+		userIds = append(userIds, conv.UserLow+conv.UserHigh-userId)
+	}
+	rows, err := store.GetDirectMessagesByIds(ctx, messageIds)
+	if err != nil {
+		return err
+	}
+	messages := make(map[int64]chatstore.DirectMessage, len(rows))
+	for _, row := range rows {
+		messages[row.ID] = row
+	}
+	p := new(dao.UserProfile)
+	profiles := p.GetByUserIds(userIds)
+	u := new(dao.User)
+	reply.Data = make([]proto.ConversationDTO, 0, len(convs))
+	for _, conv := range convs {
+		message, ok := messages[conv.LastMessageID]
+		if !ok {
+			// 建了会话但消息没存成功的，当作没有
+			continue
+		}
+		peerId := conv.UserLow + conv.UserHigh - userId
+		peerName := u.GetUserNameByUserId(peerId)
+		last := toDirectMessageDTO(message, profiles[message.FromUserID])
+		reply.Data = append(reply.Data, proto.ConversationDTO{
+			ConversationId:  conv.ID,
+			PeerUserId:      peerId,
+			PeerUserName:    peerName,
+			PeerDisplayName: displayNameOf(peerName, profiles[peerId]),
+			PeerAvatar:      profiles[peerId].AvatarUrl,
+			LastMessage:     &last,
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 会话里的消息，按会话 id 或者对方的 user id 找；只有会话的两个人能看
+func (rpc *RpcLogic) ListDirectMessages(ctx context.Context, args *proto.ListDirectMessagesRequest, reply *proto.ListDirectMessagesResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	var conv chatstore.DirectConversation
+	switch {
+	case args.ConversationId > 0:
+		conv, err = store.GetConversation(ctx, args.ConversationId)
+		if err == nil && conv.UserLow != userId && conv.UserHigh != userId {
+			err = gorm.ErrRecordNotFound
+		}
+		if err == gorm.ErrRecordNotFound {
+			return errors.New("conversation not found")
+		}
+	case args.PeerUserId > 0:
+		conv, err = store.FindConversation(ctx, userId, args.PeerUserId)
+		if err == gorm.ErrRecordNotFound {
+			// 还没聊过，没有消息
+			reply.Data = make([]proto.DirectMessageDTO, 0)
+			reply.Code = config.SuccessReplyCode
+			return nil
+		}
+	default:
+		return errors.New("conversationId or peerUserId required")
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := store.ListDirectMessages(ctx, conv.ID, args.BeforeId, args.Limit)
+	if err != nil {
+		return err
+	}
+	p := new(dao.UserProfile)
+	profiles := p.GetByUserIds([]int{conv.UserLow, conv.UserHigh})
+	reply.ConversationId = conv.ID
+	reply.Data = make([]proto.DirectMessageDTO, 0, len(rows))
+	for _, row := range rows {
+		reply.Data = append(reply.Data, toDirectMessageDTO(row, profiles[row.FromUserID]))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 收信人的连接确认收到一条私信，记下送达时间，给发信人推送达回执；发信人不在线就进他的离线收件箱
+func (rpc *RpcLogic) Delivered(ctx context.Context, args *proto.DeliveredRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.UserId <= 0 || args.MessageId <= 0 {
+		return errors.New("userId or messageId empty")
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	msg, first, err := store.MarkDirectDelivered(ctx, args.MessageId, args.UserId)
+	if err != nil {
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	if !first {
+		// 不是发给他的，或者已经回执过了
+		return nil
+	}
+	body, err := json.Marshal(proto.DeliveredReceipt{
+		Op:             config.OpDeliveredReceipt,
+		ConversationId: msg.ConversationID,
+		MessageId:      msg.ID,
+		ToUserId:       msg.ToUserID,
+		DeliveredAt:    msg.DeliveredAt.In(time.Local).Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return err
+	}
+	logic := new(Logic)
+	serverId := RedisSessClient.Get(logic.getUserKey(fmt.Sprintf("%d", msg.FromUserID))).Val()
+	if serverId == "" {
+		pushOffline([]int{msg.FromUserID}, config.OpDeliveredReceipt, body)
+		return nil
+	}
+	if err = logic.KafkaPublishReceipt(serverId, msg.FromUserID, body); err != nil {
+		logrus.Errorf("logic,Delivered publish receipt err:%s", err.Error())
+	}
+	return nil
+}
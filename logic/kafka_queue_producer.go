@@ -82,6 +82,65 @@ func (logic *Logic) KafkaPublishChannel(serverId string, toUserId int, msg []byt
 	})
 }
 
+// 踢人，定投到用户所在 connect 对应的 topic
+func (logic *Logic) KafkaPublishRoomKick(serverId string, userId int, roomId int, msg []byte) error {
+	redisMsg := proto.RedisMsg{
+		Op:       config.OpRoomKick,
+		ServerId: serverId,
+		UserId:   userId,
+		RoomId:   roomId,
+		Msg:      msg,
+	}
+	payload, err := json.Marshal(redisMsg)
+	if err != nil {
+		return err
+	}
+
+	topic := topicForServer(serverId)
+	w := getWriter(topic)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(fmt.Sprintf("user:%d", userId)),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "op", Value: []byte(strconv.Itoa(config.OpRoomKick))},
+		},
+		Time: time.Now(),
+	})
+}
+
+// 私信送达回执，定投到发信人所在 connect 对应的 topic
+func (logic *Logic) KafkaPublishReceipt(serverId string, userId int, msg []byte) error {
+	redisMsg := proto.RedisMsg{
+		Op:       config.OpDeliveredReceipt,
+		ServerId: serverId,
+		UserId:   userId,
+		Msg:      msg,
+	}
+	payload, err := json.Marshal(redisMsg)
+	if err != nil {
+		return err
+	}
+
+	topic := topicForServer(serverId)
+	w := getWriter(topic)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(fmt.Sprintf("user:%d", userId)),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "op", Value: []byte(strconv.Itoa(config.OpDeliveredReceipt))},
+		},
+		Time: time.Now(),
+	})
+}
+
 // 群聊
 func (logic *Logic) KafkaPublishRoomInfo(roomId int, count int, roomUserInfo map[string]string, msg []byte) error {
 	redisMsg := &proto.RedisMsg{
@@ -143,11 +202,15 @@ func (logic *Logic) KafkaPushRoomCount(roomId int, count int) error {
 
 func (logic *Logic) KafkaPushRoomInfo(roomId int, count int, roomUserInfo map[string]string) error {
 	redisMsg := &proto.RedisMsg{
-		Op:           config.OpRoomInfoSend,
-		RoomId:       roomId,
-		Count:        count,
-		RoomUserInfo: roomUserInfo,
+		Op:               config.OpRoomInfoSend,
+		RoomId:           roomId,
+		Count:            count,
+		RoomUserInfo:     roomUserInfo,
+		RoomUserProfiles: roomUserProfiles(roomUserInfo),
 	}
+	// 名单推下去的时候顺带房间的话题、公告和置顶
+	meta := roomMeta(roomId)
+	redisMsg.RoomMeta = &meta
 	payload, err := json.Marshal(redisMsg)
 	if err != nil {
 		return err
@@ -168,3 +231,59 @@ func (logic *Logic) KafkaPushRoomInfo(roomId int, count int, roomUserInfo map[st
 		Time: time.Now(),
 	})
 }
+
+// 房间话题、公告、置顶变了
+func (logic *Logic) KafkaPushRoomMeta(roomId int, meta proto.RoomMeta) error {
+	redisMsg := &proto.RedisMsg{
+		Op:       config.OpRoomMetaSend,
+		RoomId:   roomId,
+		RoomMeta: &meta,
+	}
+	payload, err := json.Marshal(redisMsg)
+	if err != nil {
+		return err
+	}
+
+	topic := topicForServer(config.Conf.Logic.LogicBase.ServerId)
+	w := getWriter(topic)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(fmt.Sprintf("room-meta:%d", roomId)),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "op", Value: []byte(strconv.Itoa(config.OpRoomMetaSend))},
+		},
+		Time: time.Now(),
+	})
+}
+
+// 已读回执，和话题、公告一样不落历史
+func (logic *Logic) KafkaPushRoomRead(roomId int, msg []byte) error {
+	redisMsg := &proto.RedisMsg{
+		Op:     config.OpRoomReadSend,
+		RoomId: roomId,
+		Msg:    msg,
+	}
+	payload, err := json.Marshal(redisMsg)
+	if err != nil {
+		return err
+	}
+
+	topic := topicForServer(config.Conf.Logic.LogicBase.ServerId)
+	w := getWriter(topic)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(fmt.Sprintf("room-read:%d", roomId)),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "op", Value: []byte(strconv.Itoa(config.OpRoomReadSend))},
+		},
+		Time: time.Now(),
+	})
+}
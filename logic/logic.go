@@ -10,6 +10,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/logic/dao"
 	"runtime"
 )
 
@@ -35,6 +38,20 @@ func (logic *Logic) Run() {
 		logrus.Panicf("logic init publishRedisClient fail,err:%s", err.Error())
 	}
 
+	// 用户表补上新加的列
+	if err := dao.AutoMigrate(); err != nil {
+		logrus.Panicf("logic migrate db fail,err:%s", err.Error())
+	}
+	// 私信由 logic 直接落库，表不能等 task 来建
+	if err := chatstore.New(db.GetDb("gochat")).AutoMigrate(); err != nil {
+		logrus.Panicf("logic migrate chat store fail,err:%s", err.Error())
+	}
+	bootstrapAdmin()
+
+	if err := logic.InitNotifier(); err != nil {
+		logrus.Panicf("logic init notifier fail,err:%s", err.Error())
+	}
+
 	if err := logic.InitAIKafkaProducer(); err != nil {
 		logrus.Panicf("logic init AIKafkaProducer fail,err:%s", err.Error())
 	}
@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"time"
+)
+
+// 登录防爆破：账号和IP各自计数，账号失败后指数退避，超过次数临时锁定
+
+const (
+	loginGuardUser = "user"
+	loginGuardIp   = "ip"
+)
+
+func loginGuardConf() (window time.Duration, maxFailures int64, ipMaxFailures int64, lock time.Duration, backoffBase time.Duration) {
+	authConf := config.Conf.Logic.LogicAuth
+	window, maxFailures, ipMaxFailures = 900*time.Second, 5, 50
+	lock, backoffBase = 900*time.Second, time.Second
+	if authConf.LoginFailWindow > 0 {
+		window = time.Duration(authConf.LoginFailWindow) * time.Second
+	}
+	if authConf.LoginMaxFailures > 0 {
+		maxFailures = int64(authConf.LoginMaxFailures)
+	}
+	if authConf.LoginIpMaxFailures > 0 {
+		ipMaxFailures = int64(authConf.LoginIpMaxFailures)
+	}
+	if authConf.LoginLockSeconds > 0 {
+		lock = time.Duration(authConf.LoginLockSeconds) * time.Second
+	}
+	if authConf.LoginBackoffBase > 0 {
+		backoffBase = time.Duration(authConf.LoginBackoffBase) * time.Second
+	}
+	return
+}
+
+// 还要等多久才能再试，0 表示可以登录
+func loginRetryAfter(userName string, clientIp string) (retryAfter time.Duration) {
+	logic := new(Logic)
+	keys := []string{
+		logic.getLoginLockKey(loginGuardUser, userName),
+		logic.getLoginWaitKey(userName),
+	}
+	if clientIp != "" {
+		keys = append(keys, logic.getLoginLockKey(loginGuardIp, clientIp))
+	}
+	for _, key := range keys {
+		ttl, err := RedisSessClient.TTL(key).Result()
+		if err != nil {
+			logrus.Warnf("login guard ttl err:%s", err.Error())
+			continue
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	return
+}
+
+// 记一次失败；账号到次数直接锁，没到次数按失败次数指数退避
+func recordLoginFailure(userName string, clientIp string) {
+	window, maxFailures, ipMaxFailures, lock, backoffBase := loginGuardConf()
+	logic := new(Logic)
+	failKey := logic.getLoginFailKey(loginGuardUser, userName)
+	failures, err := incrWithWindow(failKey, window)
+	if err != nil {
+		logrus.Warnf("login guard incr user fail err:%s", err.Error())
+	}
+	if failures >= maxFailures {
+		RedisSessClient.Set(logic.getLoginLockKey(loginGuardUser, userName), failures, lock)
+		logrus.Warnf("login locked,userName:%s,failures:%d", userName, failures)
+	} else if failures > 0 {
+		wait := backoffBase << uint(failures-1)
+		if wait > lock {
+			wait = lock
+		}
+		RedisSessClient.Set(logic.getLoginWaitKey(userName), failures, wait)
+	}
+	if clientIp == "" {
+		return
+	}
+	ipFailures, err := incrWithWindow(logic.getLoginFailKey(loginGuardIp, clientIp), window)
+	if err != nil {
+		logrus.Warnf("login guard incr ip fail err:%s", err.Error())
+	}
+	if ipFailures >= ipMaxFailures {
+		RedisSessClient.Set(logic.getLoginLockKey(loginGuardIp, clientIp), ipFailures, lock)
+		logrus.Warnf("login locked,ip:%s,failures:%d", clientIp, ipFailures)
+	}
+}
+
+// 登录成功清掉账号的失败记录；IP 计数不清，防止拿自己的账号去洗掉IP计数
+func resetLoginFailure(userName string) {
+	logic := new(Logic)
+	RedisSessClient.Del(logic.getLoginFailKey(loginGuardUser, userName), logic.getLoginWaitKey(userName))
+}
+
+// 第一次失败时开始计时，窗口内累加
+func incrWithWindow(key string, window time.Duration) (count int64, err error) {
+	count, err = RedisSessClient.Incr(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		err = RedisSessClient.Expire(key, window).Err()
+	}
+	return
+}
+
+// 管理员解锁账号（以及可选的IP），清掉所有失败计数
+func (rpc *RpcLogic) UnlockLogin(ctx context.Context, args *proto.UnlockLoginRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	if new(dao.User).GetUserById(userId).Role != config.RoleAdmin {
+		return errors.New("admin only")
+	}
+	if args.UserName == "" && args.ClientIp == "" {
+		return errors.New("userName or clientIp required")
+	}
+	logic := new(Logic)
+	var keys []string
+	if args.UserName != "" {
+		keys = append(keys,
+			logic.getLoginFailKey(loginGuardUser, args.UserName),
+			logic.getLoginLockKey(loginGuardUser, args.UserName),
+			logic.getLoginWaitKey(args.UserName),
+		)
+	}
+	if args.ClientIp != "" {
+		keys = append(keys,
+			logic.getLoginFailKey(loginGuardIp, args.ClientIp),
+			logic.getLoginLockKey(loginGuardIp, args.ClientIp),
+		)
+	}
+	if err = RedisSessClient.Del(keys...).Err(); err != nil {
+		logrus.Errorf("unlock login err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("unlock login,userName:%s,ip:%s,by:%d", args.UserName, args.ClientIp, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -0,0 +1,196 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"gochat/logic/dao"
+	"strconv"
+	"time"
+)
+
+// 离线收件箱：用户不在线时收到的单聊消息（和回执）存在 redis list 里，条数和保留时间有上限；
+// 房间消息不进收件箱，下线时记下每个房间看到哪条，上线时从 chatstore 把之后的消息捞出来；
+// connect 把连接放进桶以后调 TakeOffline 一次取走，按顺序补发
+
+// 只有记录的还是这台 connect 才删，免得把刚在别处连上的记录删掉
+var clearUserServerScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// 用户断开了这台 connect 上的最后一个连接，之后发给他的消息进离线收件箱
+func clearUserServer(userId int, serverId string) {
+	logic := new(Logic)
+	userKey := logic.getUserKey(fmt.Sprintf("%d", userId))
+	n, err := clearUserServerScript.Run(RedisClient, []string{userKey}, serverId).Int()
+	if err != nil {
+		logrus.Warnf("clear user server err:%s", err.Error())
+		return
+	}
+	if n > 0 {
+		markRoomsSeen(userId)
+	}
+}
+
+// 下线时把加入的每个房间都记到现在，消息 id 是雪花 id，比它大的就是下线以后发的
+func markRoomsSeen(userId int) {
+	conf := config.Conf.Logic.LogicOffline
+	if conf.MaxSize <= 0 {
+		return
+	}
+	m := new(dao.RoomMember)
+	roomIds := m.ListRoomIdsByUserId(userId)
+	if len(roomIds) == 0 {
+		return
+	}
+	seenId := tools.GetSnowflakeIdForInt64()
+	seen := make(map[string]interface{}, len(roomIds))
+	for _, roomId := range roomIds {
+		seen[strconv.Itoa(roomId)] = seenId
+	}
+	logic := new(Logic)
+	key := logic.getRoomSeenKey(strconv.Itoa(userId))
+	_, err := RedisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(key)
+		pipe.HMSet(key, seen)
+		if conf.Ttl > 0 {
+			pipe.Expire(key, time.Duration(conf.Ttl)*time.Second)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("mark rooms seen err:%s", err.Error())
+	}
+}
+
+// 下线以后还在的房间里错过的消息，按房间依次补，总数不超过 limit
+func roomMissed(userId int, limit int) (msgs []proto.OfflineMsg) {
+	logic := new(Logic)
+	key := logic.getRoomSeenKey(strconv.Itoa(userId))
+	var seen *redis.StringStringMapCmd
+	_, err := RedisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		seen = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("take room seen err:%s", err.Error())
+		return
+	}
+	if len(seen.Val()) == 0 {
+		return
+	}
+	m := new(dao.RoomMember)
+	store := chatstore.New(db.GetDb("gochat"))
+	senders := make(map[int]proto.Send)
+	for _, roomId := range m.ListRoomIdsByUserId(userId) {
+		if len(msgs) >= limit {
+			break
+		}
+		seenId, err := strconv.ParseInt(seen.Val()[strconv.Itoa(roomId)], 10, 64)
+		if err != nil {
+			// 下线以后才加入的房间不补
+			continue
+		}
+		rows, err := store.ListRoomMessagesAfter(context.Background(), roomId, seenId, limit-len(msgs))
+		if err != nil {
+			logrus.Warnf("list room %d missed msg err:%s", roomId, err.Error())
+			continue
+		}
+		for _, row := range rows {
+			if row.FromUserID == userId {
+				continue
+			}
+			send := &proto.Send{
+				Msg:          row.Content,
+				FromUserId:   row.FromUserID,
+				FromUserName: row.FromUserName,
+				RoomId:       row.RoomID,
+				Op:           config.OpRoomSend,
+				CreateTime:   row.CreatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+				IsBot:        row.IsBot,
+				ClientMsgId:  row.ID,
+			}
+			// 同一个人的资料只查一次
+			if sender, ok := senders[row.FromUserID]; ok {
+				send.FromUserName, send.FromDisplayName, send.FromAvatar = sender.FromUserName, sender.FromDisplayName, sender.FromAvatar
+			} else {
+				fillSenderProfile(send)
+				senders[row.FromUserID] = *send
+			}
+			body, err := json.Marshal(send)
+			if err != nil {
+				continue
+			}
+			msgs = append(msgs, proto.OfflineMsg{Op: config.OpRoomSend, Body: body})
+		}
+	}
+	return
+}
+
+// 存进这些用户的离线收件箱，超过上限丢最早的
+func pushOffline(userIds []int, op int, body []byte) {
+	conf := config.Conf.Logic.LogicOffline
+	if conf.MaxSize <= 0 || len(userIds) == 0 {
+		return
+	}
+	item, err := json.Marshal(proto.OfflineMsg{Op: op, Body: body})
+	if err != nil {
+		logrus.Errorf("marshal offline msg err:%s", err.Error())
+		return
+	}
+	logic := new(Logic)
+	_, err = RedisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, userId := range userIds {
+			key := logic.getOfflineKey(strconv.Itoa(userId))
+			pipe.RPush(key, item)
+			pipe.LTrim(key, int64(-conf.MaxSize), -1)
+			if conf.Ttl > 0 {
+				pipe.Expire(key, time.Duration(conf.Ttl)*time.Second)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("push offline msg err:%s", err.Error())
+	}
+}
+
+// 取走用户的离线收件箱，按到达顺序
+func takeOffline(userId int) (msgs []proto.OfflineMsg) {
+	logic := new(Logic)
+	key := logic.getOfflineKey(strconv.Itoa(userId))
+	var items *redis.StringSliceCmd
+	_, err := RedisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		items = pipe.LRange(key, 0, -1)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("take offline msg err:%s", err.Error())
+		return
+	}
+	msgs = make([]proto.OfflineMsg, 0, len(items.Val()))
+	for _, item := range items.Val() {
+		var msg proto.OfflineMsg
+		if err = json.Unmarshal([]byte(item), &msg); err != nil {
+			logrus.Warnf("unmarshal offline msg err:%s", err.Error())
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if limit := config.Conf.Logic.LogicOffline.MaxSize; len(msgs) < limit {
+		msgs = append(msgs, roomMissed(userId, limit-len(msgs))...)
+	}
+	return
+}
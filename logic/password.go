@@ -0,0 +1,226 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/pkg/authtoken"
+	"gochat/internal/pkg/notify"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"gochat/logic/dao"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// 改密码和忘记密码重置；重置验证码通过 notifier 发出去，redis 里只存哈希
+
+const (
+	passwordResetAttempt  = 5                // 一个验证码最多试几次
+	passwordResetInterval = 60 * time.Second // 同一账号两次发码的最小间隔
+)
+
+var resetNotifier notify.Notifier
+
+func (logic *Logic) InitNotifier() (err error) {
+	notifyConf := config.Conf.Logic.LogicNotify
+	resetNotifier, err = notify.New(notifyConf.Driver, notifyConf.FilePath)
+	return
+}
+
+func passwordResetTtl() time.Duration {
+	if ttl := config.Conf.Logic.LogicAuth.PasswordResetTtl; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 15 * time.Minute
+}
+
+func hashResetCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// 8 位数字验证码
+func generateResetCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(100000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08d", n.Int64()), nil
+}
+
+// 除了 currentToken 对应的登录，这个用户其他地方的登录全部作废；currentToken 为空就全部作废
+func revokeOtherLogins(userId int, currentToken string) (err error) {
+	if !config.Conf.Api.ApiAuth.IsTokenMode() {
+		tokens, _ := listSessions(userId)
+		for _, token := range tokens {
+			if token == currentToken {
+				continue
+			}
+			if err = deleteSession(userId, token); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	currentTokenId := ""
+	if currentToken != "" {
+		if claims, err := authtoken.Parse(currentToken, []byte(config.Conf.Api.ApiAuth.TokenSecret)); err == nil {
+			currentTokenId = claims.TokenId
+		}
+	}
+	refreshTokens, err := RedisSessClient.SMembers(tools.GetRefreshTokenSetKey(userId)).Result()
+	if err != nil {
+		return err
+	}
+	for _, refreshToken := range refreshTokens {
+		tokenId, _ := RedisSessClient.HGet(tools.GetRefreshTokenKey(refreshToken), "accessTokenId").Result()
+		if currentTokenId != "" && tokenId == currentTokenId {
+			continue
+		}
+		if err = revokeRefreshToken(userId, refreshToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setPassword(userId int, password string) error {
+	hashed, err := tools.HashPassword(password, config.Conf.Logic.LogicAuth.PasswordCost)
+	if err != nil {
+		return err
+	}
+	u := new(dao.User)
+	return u.UpdatePassword(userId, hashed)
+}
+
+// 登录状态下改密码，要旧密码；改完其他设备全部下线，当前设备保留
+func (rpc *RpcLogic) ChangePassword(ctx context.Context, args *proto.ChangePasswordRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.NewPassword == "" {
+		return errors.New("new password empty!")
+	}
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	u := new(dao.User)
+	user := u.GetUserById(userId)
+	if user.Id == 0 || !tools.CheckPassword(user.Password, args.OldPassword) {
+		return errors.New("old password error!")
+	}
+	if err = setPassword(userId, args.NewPassword); err != nil {
+		logrus.Errorf("change password err:%s", err.Error())
+		return err
+	}
+	if err = revokeOtherLogins(userId, args.AuthToken); err != nil {
+		logrus.Errorf("change password revoke other logins err:%s", err.Error())
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 忘记密码：生成验证码发出去；账号存不存在都返回成功，不暴露用户名
+func (rpc *RpcLogic) ForgotPassword(ctx context.Context, args *proto.ForgotPasswordRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.SuccessReplyCode
+	u := new(dao.User)
+	user := u.CheckHaveUserName(args.UserName)
+	if user.Id == 0 {
+		logrus.Infof("forgot password for unknown user:%s", args.UserName)
+		return
+	}
+	logic := new(Logic)
+	resetKey := logic.getPasswordResetKey(user.UserName)
+	ttl := passwordResetTtl()
+	// 刚发过就不再发，防止被人拿来刷通知
+	if remain, _ := RedisSessClient.TTL(resetKey).Result(); remain > ttl-passwordResetInterval {
+		logrus.Infof("forgot password too frequent,userName:%s", user.UserName)
+		return
+	}
+	code, err := generateResetCode()
+	if err != nil {
+		reply.Code = config.FailReplyCode
+		return err
+	}
+	resetData := make(map[string]interface{})
+	resetData["userId"] = user.Id
+	resetData["code"] = hashResetCode(code)
+	resetData["attempts"] = 0
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(resetKey)
+		pipe.HMSet(resetKey, resetData)
+		pipe.Expire(resetKey, ttl)
+		return nil
+	})
+	if err != nil {
+		reply.Code = config.FailReplyCode
+		return err
+	}
+	err = resetNotifier.Notify(notify.Message{
+		To:      user.UserName,
+		Subject: "gochat password reset",
+		Body:    fmt.Sprintf("your password reset code is %s, valid for %d minutes", code, int(ttl/time.Minute)),
+	})
+	if err != nil {
+		logrus.Errorf("send password reset code err:%s", err.Error())
+		RedisSessClient.Del(resetKey)
+		reply.Code = config.FailReplyCode
+		return err
+	}
+	return
+}
+
+// 验证码重置密码，验证码只能用一次；重置以后所有登录全部作废
+func (rpc *RpcLogic) ResetPassword(ctx context.Context, args *proto.ResetPasswordRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.NewPassword == "" {
+		return errors.New("new password empty!")
+	}
+	logic := new(Logic)
+	resetKey := logic.getPasswordResetKey(args.UserName)
+	resetData, err := RedisSessClient.HGetAll(resetKey).Result()
+	if err != nil {
+		return err
+	}
+	if len(resetData) == 0 {
+		return errors.New("reset code invalid or expired")
+	}
+	attempts, err := RedisSessClient.HIncrBy(resetKey, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	if attempts > passwordResetAttempt {
+		RedisSessClient.Del(resetKey)
+		return errors.New("reset code invalid or expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashResetCode(args.Code)), []byte(resetData["code"])) != 1 {
+		return errors.New("reset code error!")
+	}
+	if n, err := RedisSessClient.Del(resetKey).Result(); err != nil || n == 0 {
+		return errors.New("reset code invalid or expired")
+	}
+	userId, _ := strconv.Atoi(resetData["userId"])
+	if err = setPassword(userId, args.NewPassword); err != nil {
+		logrus.Errorf("reset password err:%s", err.Error())
+		return err
+	}
+	if err = revokeOtherLogins(userId, ""); err != nil {
+		logrus.Errorf("reset password revoke logins err:%s", err.Error())
+		return err
+	}
+	resetLoginFailure(args.UserName)
+	reply.Code = config.SuccessReplyCode
+	return
+}
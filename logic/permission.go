@@ -0,0 +1,259 @@
+package logic
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+)
+
+// 角色和权限：全局管理员什么都能做；房间里 owner > moderator > member > guest，
+// 没有记录的用户按 config.DefaultRoomRole 算；私有房间还要求是成员；
+// 空间里的房间要求是空间成员，空间的 owner/admin 在空间里的房间至少按房主/moderator 算
+
+const (
+	permJoin        = "join"
+	permRead        = "read"
+	permSend        = "send"
+	permModerate    = "moderate"
+	permManageRoles = "manageRoles"
+	permManageRoom  = "manageRoom"
+)
+
+var roomRoleRank = map[string]int{
+	config.RoomRoleGuest:     1,
+	config.RoomRoleMember:    2,
+	config.RoomRoleModerator: 3,
+	config.RoomRoleOwner:     4,
+}
+
+// 空间角色带到空间里的房间的角色
+var spaceRoomRole = map[string]string{
+	config.SpaceRoleOwner: config.RoomRoleOwner,
+	config.SpaceRoleAdmin: config.RoomRoleModerator,
+}
+
+// 用户在房间里的角色，以及是不是全局管理员
+func userRoomRole(userId int, roomId int) (role string, isAdmin bool) {
+	r := new(dao.Room)
+	spaceRole := ""
+	if spaceId := r.GetById(roomId).SpaceId; spaceId > 0 {
+		spaceRole = userSpaceRole(userId, spaceId)
+	}
+	return roomRoleOf(userId, roomId, spaceRole)
+}
+
+// 已经查过空间角色的，直接按空间角色往上抬
+func roomRoleOf(userId int, roomId int, spaceRole string) (role string, isAdmin bool) {
+	u := new(dao.User)
+	isAdmin = u.GetUserById(userId).Role == config.RoleAdmin
+	r := new(dao.RoomRole)
+	role = r.GetRole(roomId, userId)
+	if roomRoleRank[role] == 0 {
+		role = config.DefaultRoomRole
+	}
+	if bumped, ok := spaceRoomRole[spaceRole]; ok && roomRoleRank[bumped] > roomRoleRank[role] {
+		role = bumped
+	}
+	return
+}
+
+// 不是空间成员的、私有房间不是成员的、被封禁的什么都做不了，被禁言的、观众不能发言，管理员除外；
+// 空间的 owner/admin 不是私有房间的成员也能进
+func roomPermissions(userId int, roomId int) proto.RoomPermissions {
+	r := new(dao.Room)
+	return roomPermissionsOf(userId, roomId, r.GetById(roomId))
+}
+
+// 已经查过房间的，不再查一遍
+func roomPermissionsOf(userId int, roomId int, room dao.Room) proto.RoomPermissions {
+	private := room.Private
+	spaceRole := ""
+	if room.SpaceId > 0 {
+		spaceRole = userSpaceRole(userId, room.SpaceId)
+	}
+	role, isAdmin := roomRoleOf(userId, roomId, spaceRole)
+	rank := roomRoleRank[role]
+	_, spaceManager := spaceRoomRole[spaceRole]
+	m := new(dao.RoomMember)
+	isMember := m.IsMember(roomId, userId)
+	b := new(dao.RoomBan)
+	banned := b.IsBanned(roomId, userId)
+	if (room.SpaceId > 0 && spaceRole == "") || (private && !isMember && !spaceManager) || banned {
+		rank = 0
+	}
+	mutedFor := roomMutedFor(userId, roomId)
+	spectator := isRoomSpectator(userId, roomId)
+	return proto.RoomPermissions{
+		RoomId:         roomId,
+		Role:           role,
+		IsAdmin:        isAdmin,
+		CanJoin:        isAdmin || rank >= roomRoleRank[config.RoomRoleGuest],
+		CanRead:        isAdmin || rank >= roomRoleRank[config.RoomRoleGuest],
+		CanSend:        isAdmin || (rank >= roomRoleRank[config.RoomRoleMember] && mutedFor == 0 && !spectator),
+		CanModerate:    isAdmin || rank >= roomRoleRank[config.RoomRoleModerator],
+		CanManageRoles: isAdmin || rank >= roomRoleRank[config.RoomRoleModerator],
+		CanManageRoom:  isAdmin || rank >= roomRoleRank[config.RoomRoleOwner],
+		Private:        private,
+		SpaceId:        room.SpaceId,
+		SpaceRole:      spaceRole,
+		IsMember:       isMember,
+		Banned:         banned,
+		MutedFor:       mutedFor,
+		Spectator:      spectator,
+	}
+}
+
+// PushRoom / ListRoomMessages / Connect 之前调用，没权限返回错误
+func checkRoomPermission(userId int, roomId int, perm string) error {
+	return checkPerms(userId, roomPermissions(userId, roomId), perm)
+}
+
+// 按已经算好的权限检查，PushRoom 算一次权限后面还要用
+func checkPerms(userId int, perms proto.RoomPermissions, perm string) error {
+	if userId <= 0 {
+		return errors.New("no this user")
+	}
+	roomId := perms.RoomId
+	allowed := false
+	switch perm {
+	case permJoin:
+		allowed = perms.CanJoin
+	case permRead:
+		allowed = perms.CanRead
+	case permSend:
+		allowed = perms.CanSend
+	case permModerate:
+		allowed = perms.CanModerate
+	case permManageRoles:
+		allowed = perms.CanManageRoles
+	case permManageRoom:
+		allowed = perms.CanManageRoom
+	}
+	if !allowed {
+		if perms.Banned {
+			return errors.Errorf("banned from room %d", roomId)
+		}
+		if perms.SpaceId > 0 && perms.SpaceRole == "" && !perms.IsAdmin {
+			return errors.Errorf("not a member of space %d", perms.SpaceId)
+		}
+		if perm == permSend && perms.MutedFor > 0 {
+			return errors.Errorf("muted in room %d, %d seconds left", roomId, perms.MutedFor)
+		}
+		if perm == permSend && perms.Spectator {
+			return errors.Errorf("spectating room %d, room is full", roomId)
+		}
+		return errors.Errorf("no permission to %s in room %d", perm, roomId)
+	}
+	return nil
+}
+
+func (rpc *RpcLogic) GetRoomPermissions(ctx context.Context, args *proto.GetRoomPermissionsRequest, reply *proto.GetRoomPermissionsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	reply.Permissions = roomPermissions(userId, args.RoomId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 设置别人在房间里的角色：管理员随意；owner 能设 owner 以下的角色；moderator 只能管 member 和 guest
+func (rpc *RpcLogic) SetRoomRole(ctx context.Context, args *proto.SetRoomRoleRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	if args.Role != "" && roomRoleRank[args.Role] == 0 {
+		return errors.Errorf("unknown room role: %s", args.Role)
+	}
+	u := new(dao.User)
+	if u.GetUserById(args.UserId).Id == 0 {
+		return errors.New("no this user")
+	}
+	actorRole, isAdmin := userRoomRole(userId, args.RoomId)
+	if !isAdmin {
+		if args.UserId == userId {
+			return errors.New("can not change your own room role")
+		}
+		targetRole, _ := userRoomRole(args.UserId, args.RoomId)
+		newRole := args.Role
+		if newRole == "" {
+			newRole = config.DefaultRoomRole
+		}
+		actorRank := roomRoleRank[actorRole]
+		if actorRank < roomRoleRank[config.RoomRoleModerator] ||
+			roomRoleRank[targetRole] >= actorRank || roomRoleRank[newRole] >= actorRank {
+			return errors.New("no permission to change this room role")
+		}
+	}
+	r := new(dao.RoomRole)
+	if args.Role == "" {
+		err = r.DeleteRole(args.RoomId, args.UserId)
+	} else {
+		err = r.SetRole(args.RoomId, args.UserId, args.Role)
+	}
+	if err != nil {
+		logrus.Errorf("set room role err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room role changed,roomId:%d,userId:%d,role:%s,by:%d", args.RoomId, args.UserId, args.Role, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 设置全局角色，只有管理员能调
+func (rpc *RpcLogic) SetUserRole(ctx context.Context, args *proto.SetUserRoleRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	if args.Role != "" && args.Role != config.RoleAdmin {
+		return errors.Errorf("unknown user role: %s", args.Role)
+	}
+	u := new(dao.User)
+	if u.GetUserById(userId).Role != config.RoleAdmin {
+		return errors.New("admin only")
+	}
+	if u.GetUserById(args.UserId).Id == 0 {
+		return errors.New("no this user")
+	}
+	if err = u.UpdateRole(args.UserId, args.Role); err != nil {
+		logrus.Errorf("set user role err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("user role changed,userId:%d,role:%s,by:%d", args.UserId, args.Role, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 启动时按配置设第一个管理员
+func bootstrapAdmin() {
+	userName := config.Conf.Logic.LogicAuth.BootstrapAdmin
+	if userName == "" {
+		return
+	}
+	u := new(dao.User)
+	rows, err := u.UpdateRoleByUserName(userName, config.RoleAdmin)
+	if err != nil {
+		logrus.Errorf("bootstrap admin err:%s", err.Error())
+		return
+	}
+	if rows == 0 {
+		logrus.Warnf("bootstrap admin %s not found", userName)
+	}
+}
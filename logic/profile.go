@@ -0,0 +1,187 @@
+package logic
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 用户资料：展示名、头像、简介、状态、语言、时区；消息和房间名单里带展示名和头像
+
+const (
+	profileDisplayNameMax = 32
+	profileAvatarUrlMax   = 512
+	profileBioMax         = 200
+	profileStatusTextMax  = 64
+	profileLocaleMax      = 16
+)
+
+func toProfileInfo(user dao.User, profile dao.UserProfile) proto.UserProfile {
+	return proto.UserProfile{
+		UserId:      user.Id,
+		UserName:    user.UserName,
+		DisplayName: displayNameOf(user.UserName, profile),
+		AvatarUrl:   profile.AvatarUrl,
+		Bio:         profile.Bio,
+		StatusText:  profile.StatusText,
+		Locale:      profile.Locale,
+		TimeZone:    profile.TimeZone,
+
+		HideReadReceipts: profile.HideReadReceipts,
+	}
+}
+
+// 没设置展示名就用登录名
+func displayNameOf(userName string, profile dao.UserProfile) string {
+	if profile.DisplayName != "" {
+		return profile.DisplayName
+	}
+	return userName
+}
+
+// 消息发出去之前补上发送者的展示名和头像，机器人的消息打上标记；登录名以库里的为准
+func fillSenderProfile(send *proto.Send) {
+	if send.FromUserId <= 0 {
+		return
+	}
+	u := new(dao.User)
+	user := u.GetUserById(send.FromUserId)
+	if user.Id > 0 {
+		send.FromUserName = user.UserName
+	}
+	send.IsBot = user.IsBot
+	p := new(dao.UserProfile)
+	profile := p.GetByUserId(send.FromUserId)
+	send.FromDisplayName = displayNameOf(send.FromUserName, profile)
+	send.FromAvatar = profile.AvatarUrl
+}
+
+// 房间名单 userId->userName 批量转成展示资料
+func roomUserProfiles(roomUserInfo map[string]string) map[string]proto.RoomUserProfile {
+	userIds := make([]int, 0, len(roomUserInfo))
+	for key := range roomUserInfo {
+		if userId, err := strconv.Atoi(key); err == nil {
+			userIds = append(userIds, userId)
+		}
+	}
+	p := new(dao.UserProfile)
+	profiles := p.GetByUserIds(userIds)
+	data := make(map[string]proto.RoomUserProfile, len(roomUserInfo))
+	for key, userName := range roomUserInfo {
+		userId, _ := strconv.Atoi(key)
+		profile := profiles[userId]
+		data[key] = proto.RoomUserProfile{
+			DisplayName: displayNameOf(userName, profile),
+			Avatar:      profile.AvatarUrl,
+		}
+	}
+	return data
+}
+
+func checkProfileText(name string, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return errors.Errorf("%s too long, max %d", name, max)
+	}
+	return nil
+}
+
+func (rpc *RpcLogic) GetProfile(ctx context.Context, args *proto.GetProfileRequest, reply *proto.GetProfileResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	if args.UserId > 0 {
+		userId = args.UserId
+	}
+	u := new(dao.User)
+	user := u.GetUserById(userId)
+	if user.Id == 0 {
+		return errors.New("no this user")
+	}
+	p := new(dao.UserProfile)
+	reply.Profile = toProfileInfo(user, p.GetByUserId(userId))
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 只改传了的字段，空字符串表示清空
+func (rpc *RpcLogic) UpdateProfile(ctx context.Context, args *proto.UpdateProfileRequest, reply *proto.GetProfileResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	p := new(dao.UserProfile)
+	profile := p.GetByUserId(userId)
+	profile.UserId = userId
+	if args.DisplayName != nil {
+		profile.DisplayName = strings.TrimSpace(*args.DisplayName)
+		if err = checkProfileText("displayName", profile.DisplayName, profileDisplayNameMax); err != nil {
+			return err
+		}
+	}
+	if args.AvatarUrl != nil {
+		profile.AvatarUrl = strings.TrimSpace(*args.AvatarUrl)
+		if err = checkProfileText("avatarUrl", profile.AvatarUrl, profileAvatarUrlMax); err != nil {
+			return err
+		}
+		if profile.AvatarUrl != "" {
+			avatar, err := url.Parse(profile.AvatarUrl)
+			if err != nil || (avatar.Scheme != "http" && avatar.Scheme != "https") || avatar.Host == "" {
+				return errors.New("avatarUrl must be a http(s) url")
+			}
+		}
+	}
+	if args.Bio != nil {
+		profile.Bio = strings.TrimSpace(*args.Bio)
+		if err = checkProfileText("bio", profile.Bio, profileBioMax); err != nil {
+			return err
+		}
+	}
+	if args.StatusText != nil {
+		profile.StatusText = strings.TrimSpace(*args.StatusText)
+		if err = checkProfileText("statusText", profile.StatusText, profileStatusTextMax); err != nil {
+			return err
+		}
+	}
+	if args.Locale != nil {
+		profile.Locale = strings.TrimSpace(*args.Locale)
+		if err = checkProfileText("locale", profile.Locale, profileLocaleMax); err != nil {
+			return err
+		}
+	}
+	if args.TimeZone != nil {
+		profile.TimeZone = strings.TrimSpace(*args.TimeZone)
+		if profile.TimeZone != "" {
+			if _, err = time.LoadLocation(profile.TimeZone); err != nil {
+				return errors.New("unknown timeZone")
+			}
+		}
+	}
+	if args.HideReadReceipts != nil {
+		profile.HideReadReceipts = *args.HideReadReceipts
+	}
+	if err = profile.Save(); err != nil {
+		logrus.Errorf("update profile err:%s", err.Error())
+		return err
+	}
+	u := new(dao.User)
+	reply.Profile = toProfileInfo(u.GetUserById(userId), profile)
+	reply.Code = config.SuccessReplyCode
+	return
+}
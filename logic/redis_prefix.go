@@ -30,3 +30,125 @@ func (logic *Logic) getUserKey(authKey string) string {
 	returnKey.WriteString(authKey)
 	return returnKey.String()
 }
+
+// gochat_login_fail_user_lock / gochat_login_fail_ip_127.0.0.1 登录失败次数
+func (logic *Logic) getLoginFailKey(kind string, authKey string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisLoginFailPrefix)
+	returnKey.WriteString(kind)
+	returnKey.WriteString("_")
+	returnKey.WriteString(authKey)
+	return returnKey.String()
+}
+
+// gochat_login_lock_user_lock / gochat_login_lock_ip_127.0.0.1 登录锁定
+func (logic *Logic) getLoginLockKey(kind string, authKey string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisLoginLockPrefix)
+	returnKey.WriteString(kind)
+	returnKey.WriteString("_")
+	returnKey.WriteString(authKey)
+	return returnKey.String()
+}
+
+// gochat_login_wait_lock 失败退避，key 还在就不允许再试
+func (logic *Logic) getLoginWaitKey(authKey string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisLoginWaitPrefix)
+	returnKey.WriteString(authKey)
+	return returnKey.String()
+}
+
+// gochat_login_2fa_token 密码已通过、等待两步验证的登录挑战
+func (logic *Logic) getLogin2faKey(challengeToken string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisLogin2faPrefix)
+	returnKey.WriteString(challengeToken)
+	return returnKey.String()
+}
+
+// gochat_totp_setup_78 绑定中还没确认的两步验证密钥
+func (logic *Logic) getTotpSetupKey(authKey string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisTotpSetupPrefix)
+	returnKey.WriteString(authKey)
+	return returnKey.String()
+}
+
+// gochat_totp_used_78_56789 用过的动态码步长，防重放
+func (logic *Logic) getTotpUsedKey(authKey string, step string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisTotpUsedPrefix)
+	returnKey.WriteString(authKey)
+	returnKey.WriteString("_")
+	returnKey.WriteString(step)
+	return returnKey.String()
+}
+
+// gochat_pwd_reset_lock 重置密码验证码
+func (logic *Logic) getPasswordResetKey(authKey string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisPwdResetPrefix)
+	returnKey.WriteString(authKey)
+	return returnKey.String()
+}
+
+// gochat_room_invite_<sha256> 邀请链接，值是房间 id
+func (logic *Logic) getRoomInviteKey(tokenHash string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisRoomInvitePrefix)
+	returnKey.WriteString(tokenHash)
+	return returnKey.String()
+}
+
+// gochat_room_mute_12_78 房间里被禁言的用户，过期自动解除
+func (logic *Logic) getRoomMuteKey(roomId string, userId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisRoomMutePrefix)
+	returnKey.WriteString(roomId)
+	returnKey.WriteString("_")
+	returnKey.WriteString(userId)
+	return returnKey.String()
+}
+
+// gochat_room_slow_12_78 慢速模式下用户下次能发言的时间，过期就能再发
+func (logic *Logic) getRoomSlowKey(roomId string, userId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisRoomSlowPrefix)
+	returnKey.WriteString(roomId)
+	returnKey.WriteString("_")
+	returnKey.WriteString(userId)
+	return returnKey.String()
+}
+
+// gochat_send_bucket_78 用户的发言令牌桶
+func (logic *Logic) getSendBucketKey(userId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisSendBucketPrefix)
+	returnKey.WriteString(userId)
+	return returnKey.String()
+}
+
+// gochat_room_spectator_12 房间满了以观众身份进来的用户，和名单一样 userId -> userName
+func (logic *Logic) getRoomSpectatorKey(roomId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisRoomSpectatorPrefix)
+	returnKey.WriteString(roomId)
+	return returnKey.String()
+}
+
+// gochat_offline_12 用户的离线收件箱，list 里按到达顺序存 proto.OfflineMsg
+func (logic *Logic) getOfflineKey(userId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisOfflinePrefix)
+	returnKey.WriteString(userId)
+	return returnKey.String()
+}
+
+// gochat_room_seen_12 用户离线时各房间看到哪条消息，roomId -> 消息 id
+func (logic *Logic) getRoomSeenKey(userId string) string {
+	var returnKey bytes.Buffer
+	returnKey.WriteString(config.RedisRoomSeenPrefix)
+	returnKey.WriteString(userId)
+	return returnKey.String()
+}
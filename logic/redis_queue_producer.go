@@ -103,10 +103,11 @@ func (logic *Logic) RedisPushRoomCount(roomId int, count int) (err error) {
 // 查询房间元信息
 func (logic *Logic) RedisPushRoomInfo(roomId int, count int, roomUserInfo map[string]string) (err error) {
 	var redisMsg = &proto.RedisMsg{
-		Op:           config.OpRoomInfoSend,
-		RoomId:       roomId,
-		Count:        count,
-		RoomUserInfo: roomUserInfo,
+		Op:               config.OpRoomInfoSend,
+		RoomId:           roomId,
+		Count:            count,
+		RoomUserInfo:     roomUserInfo,
+		RoomUserProfiles: roomUserProfiles(roomUserInfo),
 	}
 	redisMsgByte, err := json.Marshal(redisMsg)
 	if err != nil {
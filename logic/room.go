@@ -0,0 +1,295 @@
+package logic
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strings"
+	"unicode/utf8"
+)
+
+// 房间实体：名字、简介、房主、归档状态；进房间、发言、看历史之前都要求房间存在且没归档
+
+const (
+	roomNameMax        = 32
+	roomDescriptionMax = 200
+)
+
+var errRoomNotFound = errors.New("room not found or archived")
+
+func toRoomInfo(room dao.Room) proto.RoomInfo {
+	return proto.RoomInfo{
+		RoomId:         room.Id,
+		SpaceId:        room.SpaceId,
+		Name:           room.Name,
+		Description:    room.Description,
+		Topic:          room.Topic,
+		Announcement:   room.Announcement,
+		OwnerId:        room.OwnerId,
+		Archived:       room.Archived,
+		Private:        room.Private,
+		SlowMode:       room.SlowMode,
+		MaxMembers:     room.MaxMembers,
+		MaxOnline:      room.MaxOnline,
+		OverflowPolicy: room.OverflowPolicy,
+		CreateTime:     room.CreateTime.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 房间存在并且没归档才能用
+func checkRoomAvailable(roomId int) error {
+	if roomId <= 0 {
+		return errRoomNotFound
+	}
+	r := new(dao.Room)
+	room := r.GetById(roomId)
+	if room.Id == 0 || room.Archived {
+		return errRoomNotFound
+	}
+	return nil
+}
+
+// 公开房间谁都能看到，私有房间只有成员和管理员能看到；空间里的房间还要求是空间成员，
+// 空间的 owner/admin 能看到空间里所有房间
+func roomVisible(userId int, room dao.Room) bool {
+	u := new(dao.User)
+	if u.GetUserById(userId).Role == config.RoleAdmin {
+		return true
+	}
+	if room.SpaceId > 0 {
+		spaceRole := userSpaceRole(userId, room.SpaceId)
+		if spaceRole == "" {
+			return false
+		}
+		if _, ok := spaceRoomRole[spaceRole]; ok {
+			return true
+		}
+	}
+	if !room.Private {
+		return true
+	}
+	m := new(dao.RoomMember)
+	return m.IsMember(room.Id, userId)
+}
+
+func validateRoomName(name string, description string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+	if name == "" {
+		return "", "", errors.New("room name required")
+	}
+	if utf8.RuneCountInString(name) > roomNameMax {
+		return "", "", errors.Errorf("room name too long, max %d", roomNameMax)
+	}
+	if utf8.RuneCountInString(description) > roomDescriptionMax {
+		return "", "", errors.Errorf("room description too long, max %d", roomDescriptionMax)
+	}
+	return name, description, nil
+}
+
+// 管理房间（改名、归档、删除）前的检查，房间得存在，归档的也能管
+func checkManageRoom(authToken string, roomId int) (userId int, room dao.Room, err error) {
+	return checkRoomActor(authToken, roomId, permManageRoom)
+}
+
+// 验证会话、房间存在，并且操作的人在房间里有 perm 权限
+func checkRoomActor(authToken string, roomId int, perm string) (userId int, room dao.Room, err error) {
+	userId, _, _, err = authUser(authToken)
+	if err != nil {
+		return
+	}
+	if userId == 0 {
+		err = errors.New("no this user session")
+		return
+	}
+	r := new(dao.Room)
+	room = r.GetById(roomId)
+	if room.Id == 0 {
+		err = errRoomNotFound
+		return
+	}
+	err = checkRoomPermission(userId, roomId, perm)
+	return
+}
+
+func (rpc *RpcLogic) CreateRoom(ctx context.Context, args *proto.CreateRoomRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	name, description, err := validateRoomName(args.Name, args.Description)
+	if err != nil {
+		return err
+	}
+	// 空间里只有空间的 owner/admin 能建房间
+	if args.SpaceId > 0 {
+		if _, _, _, err = checkSpaceActor(args.AuthToken, args.SpaceId, config.SpaceRoleAdmin); err != nil {
+			return err
+		}
+	}
+	room := &dao.Room{SpaceId: args.SpaceId, Name: name, Description: description, OwnerId: userId, Private: args.Private}
+	if _, err = room.AddWithOwner(); err != nil {
+		logrus.Errorf("create room err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room created,roomId:%d,owner:%d", room.Id, userId)
+	reply.Room = toRoomInfo(*room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) GetRoom(ctx context.Context, args *proto.GetRoomRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	r := new(dao.Room)
+	room := r.GetById(args.RoomId)
+	// 私有房间对外当作不存在
+	if room.Id == 0 || !roomVisible(userId, room) {
+		return errRoomNotFound
+	}
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) RenameRoom(ctx context.Context, args *proto.RenameRoomRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkManageRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	name, description, err := validateRoomName(args.Name, args.Description)
+	if err != nil {
+		return err
+	}
+	if err = room.UpdateName(room.Id, name, description); err != nil {
+		logrus.Errorf("rename room err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room renamed,roomId:%d,by:%d", room.Id, userId)
+	room.Name = name
+	room.Description = description
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 归档以后房间只读都不行，取消归档恢复；默认大厅不能归档
+func (rpc *RpcLogic) ArchiveRoom(ctx context.Context, args *proto.ArchiveRoomRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkManageRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	if room.Id == dao.DefaultRoomId && args.Archived {
+		return errors.New("can not archive the default room")
+	}
+	if err = room.UpdateArchived(room.Id, args.Archived); err != nil {
+		logrus.Errorf("archive room err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room archived:%v,roomId:%d,by:%d", args.Archived, room.Id, userId)
+	if args.Archived {
+		closeRoom(room.Id, "room archived")
+	}
+	room.Archived = args.Archived
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 慢速模式，moderator 以上能设置
+func (rpc *RpcLogic) SetRoomSlowMode(ctx context.Context, args *proto.SetRoomSlowModeRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if args.Seconds < 0 {
+		return errors.New("slow mode seconds can not be negative")
+	}
+	if maxSeconds := config.Conf.Logic.LogicRoom.SlowModeMax; maxSeconds > 0 && args.Seconds > maxSeconds {
+		return errors.Errorf("slow mode too long, max %d", maxSeconds)
+	}
+	if err = room.UpdateSlowMode(room.Id, args.Seconds); err != nil {
+		logrus.Errorf("set room slow mode err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room slow mode:%d,roomId:%d,by:%d", args.Seconds, room.Id, userId)
+	room.SlowMode = args.Seconds
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 公开转私有时把操作的人和房主加进成员名单，免得把自己关在外面；默认大厅不能设成私有
+func (rpc *RpcLogic) SetRoomPrivate(ctx context.Context, args *proto.SetRoomPrivateRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkManageRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	if room.Id == dao.DefaultRoomId && args.Private {
+		return errors.New("can not make the default room private")
+	}
+	if args.Private && !room.Private {
+		m := new(dao.RoomMember)
+		for _, memberId := range []int{userId, room.OwnerId} {
+			if memberId <= 0 {
+				continue
+			}
+			if err = m.AddMember(room.Id, memberId); err != nil {
+				logrus.Errorf("add room member err:%s", err.Error())
+				return err
+			}
+		}
+	}
+	if err = room.UpdatePrivate(room.Id, args.Private); err != nil {
+		logrus.Errorf("set room private err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room private:%v,roomId:%d,by:%d", args.Private, room.Id, userId)
+	room.Private = args.Private
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 删除房间，默认大厅不能删
+func (rpc *RpcLogic) DeleteRoom(ctx context.Context, args *proto.DeleteRoomRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkManageRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	if room.Id == dao.DefaultRoomId {
+		return errors.New("can not delete the default room")
+	}
+	if err = room.Delete(room.Id); err != nil {
+		logrus.Errorf("delete room err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room deleted,roomId:%d,by:%d", room.Id, userId)
+	closeRoom(room.Id, "room deleted")
+	store := chatstore.New(db.GetDb("gochat"))
+	if err = store.DeleteRoomReadMarkers(ctx, room.Id); err != nil {
+		logrus.Warnf("delete room read markers err:%s", err.Error())
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -0,0 +1,145 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strconv"
+	"time"
+)
+
+// 房间容量：成员上限和同时在线上限，满了按房间设置拒绝或者以观众身份进；moderator 以上不受限制
+
+// 给进房间的用户找座位，满了并且房间设置的是拒绝就返回 full
+func roomSeat(userId int, room dao.Room) (seat proto.RoomSeat, full bool) {
+	if room.MaxMembers <= 0 && room.MaxOnline <= 0 {
+		return
+	}
+	if roomPermissions(userId, room.Id).CanModerate {
+		return
+	}
+	seat.MaxOnline = room.MaxOnline
+	over := false
+	m := new(dao.RoomMember)
+	if room.MaxMembers > 0 && !m.IsMember(room.Id, userId) {
+		over = m.CountByRoomIds([]int{room.Id})[room.Id] >= room.MaxMembers
+	}
+	if !over && room.MaxOnline > 0 {
+		// 已经在名单里的（比如另一个连接）不算新占一个位置
+		logic := new(Logic)
+		roomUserKey := logic.getRoomUserKey(strconv.Itoa(room.Id))
+		if RedisClient.HGet(roomUserKey, fmt.Sprintf("%d", userId)).Val() == "" {
+			count, _ := RedisSessClient.Get(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", room.Id))).Int()
+			over = count >= room.MaxOnline
+		}
+	}
+	if !over {
+		return
+	}
+	if room.OverflowPolicy == config.RoomOverflowSpectate {
+		seat.Spectator = true
+		return
+	}
+	return seat, true
+}
+
+// 邀请、审批、邀请链接加成员前检查成员上限；已经是成员的、moderator 以上的不受限制
+func checkMemberCap(room dao.Room, userId int) error {
+	if room.MaxMembers <= 0 {
+		return nil
+	}
+	m := new(dao.RoomMember)
+	if m.IsMember(room.Id, userId) || roomPermissions(userId, room.Id).CanModerate {
+		return nil
+	}
+	if m.CountByRoomIds([]int{room.Id})[room.Id] >= room.MaxMembers {
+		return errors.Errorf("room is full, max %d members", room.MaxMembers)
+	}
+	return nil
+}
+
+// 已经在名单里的（比如另一个连接）不算新占一个位置；人数没满才进名单、人数加1，返回 1 表示进了
+var seatRoomScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return 1
+end
+local max = tonumber(ARGV[3])
+if max > 0 and (tonumber(redis.call('GET', KEYS[2])) or 0) >= max then
+	return 0
+end
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 1 then
+	redis.call('INCR', KEYS[2])
+end
+return 1
+`)
+
+// 按 roomSeat 找的座位进房间；检查完到进名单之间位置可能被别人抢了，抢不到再按房间设置转观众或者返回 full
+func takeRoomSeat(userId int, userName string, roomId int, serverId string, seat proto.RoomSeat) (proto.RoomSeat, bool) {
+	if !seat.Spectator {
+		if joinRoomRoster(userId, userName, roomId, serverId, seat.MaxOnline) {
+			return seat, false
+		}
+		r := new(dao.Room)
+		if r.GetById(roomId).OverflowPolicy != config.RoomOverflowSpectate {
+			return seat, true
+		}
+		seat.Spectator = true
+	}
+	joinRoomSpectator(userId, userName, roomId, serverId)
+	return seat, false
+}
+
+// 观众不进名单、不记成员、不算在线人数，只记下来让发言检查能挡住
+func joinRoomSpectator(userId int, userName string, roomId int, serverId string) {
+	logic := new(Logic)
+	userKey := logic.getUserKey(fmt.Sprintf("%d", userId))
+	if err := RedisClient.Set(userKey, serverId, config.RedisBaseValidTime*time.Second).Err(); err != nil {
+		logrus.Warnf("logic set err:%s", err)
+	}
+	RedisClient.HSet(logic.getRoomSpectatorKey(strconv.Itoa(roomId)), fmt.Sprintf("%d", userId), userName)
+}
+
+func leaveRoomSpectator(userId int, roomId int) {
+	logic := new(Logic)
+	RedisClient.HDel(logic.getRoomSpectatorKey(strconv.Itoa(roomId)), fmt.Sprintf("%d", userId))
+}
+
+func isRoomSpectator(userId int, roomId int) bool {
+	logic := new(Logic)
+	return RedisClient.HExists(logic.getRoomSpectatorKey(strconv.Itoa(roomId)), fmt.Sprintf("%d", userId)).Val()
+}
+
+// 设置容量，房主或管理员；改小了不会把已经在的人踢出去
+func (rpc *RpcLogic) SetRoomCapacity(ctx context.Context, args *proto.SetRoomCapacityRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkManageRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	if args.MaxMembers < 0 || args.MaxOnline < 0 {
+		return errors.New("capacity can not be negative")
+	}
+	policy := args.OverflowPolicy
+	if policy == "" {
+		policy = config.RoomOverflowReject
+	}
+	if policy != config.RoomOverflowReject && policy != config.RoomOverflowSpectate {
+		return errors.Errorf("unknown overflow policy %s", policy)
+	}
+	if err = room.UpdateCapacity(room.Id, args.MaxMembers, args.MaxOnline, policy); err != nil {
+		logrus.Errorf("set room capacity err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room capacity maxMembers:%d,maxOnline:%d,policy:%s,roomId:%d,by:%d", args.MaxMembers, args.MaxOnline, policy, room.Id, userId)
+	room.MaxMembers = args.MaxMembers
+	room.MaxOnline = args.MaxOnline
+	room.OverflowPolicy = policy
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
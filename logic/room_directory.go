@@ -0,0 +1,235 @@
+package logic
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 房间目录：公开房间（加上自己是成员的私有房间，空间里的房间只给空间成员看），带成员数和在线人数，支持排序和游标翻页
+
+const (
+	roomSortOnline  = "online"
+	roomSortMembers = "members"
+	roomSortName    = "name"
+	roomSortNewest  = "newest"
+
+	roomDirectoryLimit    = 20
+	roomDirectoryMaxLimit = 100
+	roomSearchQueryMax    = 64
+)
+
+// 游标记的是上一页最后一个房间的排序值，在线人数变了也不会重复或者漏掉太多
+type roomDirectoryCursor struct {
+	Sort string `json:"s"`
+	Num  int    `json:"n,omitempty"`
+	Name string `json:"k,omitempty"`
+	Id   int    `json:"i"`
+}
+
+func encodeRoomCursor(cursor roomDirectoryCursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeRoomCursor(s string) (cursor roomDirectoryCursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if err = json.Unmarshal(b, &cursor); err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	return
+}
+
+func roomEntryCursor(sortBy string, entry proto.RoomDirectoryEntry) roomDirectoryCursor {
+	cursor := roomDirectoryCursor{Sort: sortBy, Id: entry.RoomId}
+	switch sortBy {
+	case roomSortOnline:
+		cursor.Num = entry.OnlineCount
+	case roomSortMembers:
+		cursor.Num = entry.MemberCount
+	case roomSortName:
+		cursor.Name = strings.ToLower(entry.Name)
+	}
+	return cursor
+}
+
+// a 排在 b 前面；人数从多到少，名字从 a 到 z，最新的在前，一样的按 id 从小到大
+func roomCursorLess(a roomDirectoryCursor, b roomDirectoryCursor) bool {
+	switch a.Sort {
+	case roomSortOnline, roomSortMembers:
+		if a.Num != b.Num {
+			return a.Num > b.Num
+		}
+	case roomSortName:
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+	case roomSortNewest:
+		return a.Id > b.Id
+	}
+	return a.Id < b.Id
+}
+
+// 一批房间的在线人数，一次 MGET 取完
+func roomOnlineCounts(roomIds []int) (counts map[int]int) {
+	counts = make(map[int]int, len(roomIds))
+	if len(roomIds) == 0 {
+		return
+	}
+	logic := new(Logic)
+	keys := make([]string, 0, len(roomIds))
+	for _, roomId := range roomIds {
+		keys = append(keys, logic.getRoomOnlineCountKey(strconv.Itoa(roomId)))
+	}
+	values, err := RedisSessClient.MGet(keys...).Result()
+	if err != nil {
+		logrus.Warnf("room directory mget online count err:%s", err.Error())
+		return
+	}
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			counts[roomIds[i]], _ = strconv.Atoi(s)
+		}
+	}
+	return
+}
+
+func listRoomDirectory(args *proto.ListRoomsRequest, reply *proto.ListRoomsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	sortBy := args.Sort
+	if sortBy == "" {
+		sortBy = roomSortOnline
+	}
+	switch sortBy {
+	case roomSortOnline, roomSortMembers, roomSortName, roomSortNewest:
+	default:
+		return errors.Errorf("unknown sort %s", sortBy)
+	}
+	var after *roomDirectoryCursor
+	if args.Cursor != "" {
+		cursor, err := decodeRoomCursor(args.Cursor)
+		if err != nil {
+			return err
+		}
+		if cursor.Sort != sortBy {
+			return errors.New("cursor does not match sort")
+		}
+		after = &cursor
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = roomDirectoryLimit
+	}
+	if limit > roomDirectoryMaxLimit {
+		limit = roomDirectoryMaxLimit
+	}
+
+	query := strings.TrimSpace(args.Query)
+	if len([]rune(query)) > roomSearchQueryMax {
+		return errors.Errorf("query too long, max %d", roomSearchQueryMax)
+	}
+
+	// 管理员身份和加入的空间每次请求只查一次，可见性交给 SQL 过滤
+	u := new(dao.User)
+	q := dao.RoomDirectoryQuery{
+		UserId:     userId,
+		AllVisible: u.GetUserById(userId).Role == config.RoleAdmin,
+		SpaceId:    args.SpaceId,
+		Query:      query,
+	}
+	if !q.AllVisible {
+		sm := new(dao.SpaceMember)
+		for spaceId, role := range sm.ListRolesByUserId(userId) {
+			q.MemberSpaceIds = append(q.MemberSpaceIds, spaceId)
+			if _, ok := spaceRoomRole[role]; ok {
+				q.ManageSpaceIds = append(q.ManageSpaceIds, spaceId)
+			}
+		}
+	}
+	// 在线人数在 redis 里，只能全取出来在内存里排；其他排序在 SQL 里翻页，多取一条看有没有下一页
+	if sortBy != roomSortOnline {
+		q.Order = sortBy
+		q.Limit = limit + 1
+		if after != nil {
+			q.HasAfter = true
+			q.AfterNum, q.AfterName, q.AfterId = after.Num, after.Name, after.Id
+		}
+	}
+	r := new(dao.Room)
+	rows := r.ListDirectory(q)
+	roomIds := make([]int, 0, len(rows))
+	for _, row := range rows {
+		roomIds = append(roomIds, row.Id)
+	}
+	onlineCounts := roomOnlineCounts(roomIds)
+
+	entries := make([]proto.RoomDirectoryEntry, 0, len(rows))
+	sortNames := make(map[int]string, len(rows))
+	for _, row := range rows {
+		entries = append(entries, proto.RoomDirectoryEntry{
+			RoomInfo:    toRoomInfo(row.Room),
+			MemberCount: row.MemberCount,
+			OnlineCount: onlineCounts[row.Id],
+		})
+		sortNames[row.Id] = row.SortName
+	}
+	// 名字的游标用数据库里 LOWER 出来的，和 SQL 比较的口径一致
+	entryCursor := func(entry proto.RoomDirectoryEntry) roomDirectoryCursor {
+		cursor := roomEntryCursor(sortBy, entry)
+		if sortBy == roomSortName {
+			cursor.Name = sortNames[entry.RoomId]
+		}
+		return cursor
+	}
+	if sortBy == roomSortOnline {
+		sort.Slice(entries, func(i, j int) bool {
+			return roomCursorLess(entryCursor(entries[i]), entryCursor(entries[j]))
+		})
+	}
+
+	reply.Rooms = make([]proto.RoomDirectoryEntry, 0, limit)
+	for _, entry := range entries {
+		if sortBy == roomSortOnline && after != nil && !roomCursorLess(*after, entryCursor(entry)) {
+			continue
+		}
+		if len(reply.Rooms) == limit {
+			reply.NextCursor = encodeRoomCursor(entryCursor(reply.Rooms[limit-1]))
+			break
+		}
+		reply.Rooms = append(reply.Rooms, entry)
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) ListRooms(ctx context.Context, args *proto.ListRoomsRequest, reply *proto.ListRoomsResponse) (err error) {
+	args.Query = ""
+	return listRoomDirectory(args, reply)
+}
+
+// 搜索必须带关键字，不带就是列表
+func (rpc *RpcLogic) SearchRooms(ctx context.Context, args *proto.ListRoomsRequest, reply *proto.ListRoomsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	if strings.TrimSpace(args.Query) == "" {
+		return errors.New("query empty")
+	}
+	return listRoomDirectory(args, reply)
+}
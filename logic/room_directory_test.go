@@ -0,0 +1,49 @@
+package logic
+
+import "testing"
+
+func Test_RoomCursorLess(t *testing.T) {
+	cases := []struct {
+		name string
+		a    roomDirectoryCursor
+		b    roomDirectoryCursor
+		want bool
+	}{
+		{"more online first", roomDirectoryCursor{Sort: roomSortOnline, Num: 5, Id: 9}, roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 1}, true},
+		{"less online later", roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 1}, roomDirectoryCursor{Sort: roomSortOnline, Num: 5, Id: 9}, false},
+		{"same online by id", roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 1}, roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 2}, true},
+		{"more members first", roomDirectoryCursor{Sort: roomSortMembers, Num: 10, Id: 4}, roomDirectoryCursor{Sort: roomSortMembers, Num: 2, Id: 1}, true},
+		{"name a to z", roomDirectoryCursor{Sort: roomSortName, Name: "alpha", Id: 9}, roomDirectoryCursor{Sort: roomSortName, Name: "beta", Id: 1}, true},
+		{"same name by id", roomDirectoryCursor{Sort: roomSortName, Name: "alpha", Id: 2}, roomDirectoryCursor{Sort: roomSortName, Name: "alpha", Id: 1}, false},
+		{"newest first", roomDirectoryCursor{Sort: roomSortNewest, Id: 9}, roomDirectoryCursor{Sort: roomSortNewest, Id: 1}, true},
+		{"same cursor not less", roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 1}, roomDirectoryCursor{Sort: roomSortOnline, Num: 3, Id: 1}, false},
+	}
+	for _, c := range cases {
+		if got := roomCursorLess(c.a, c.b); got != c.want {
+			t.Fatalf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func Test_RoomCursorEncode(t *testing.T) {
+	cases := []roomDirectoryCursor{
+		{Sort: roomSortOnline, Num: 3, Id: 1},
+		{Sort: roomSortMembers, Num: 0, Id: 42},
+		{Sort: roomSortName, Name: "大厅 lobby", Id: 7},
+		{Sort: roomSortNewest, Id: 100},
+	}
+	for _, want := range cases {
+		got, err := decodeRoomCursor(encodeRoomCursor(want))
+		if err != nil {
+			t.Fatalf("%+v: decode err %s", want, err.Error())
+		}
+		if got != want {
+			t.Fatalf("decode got %+v want %+v", got, want)
+		}
+	}
+	for _, bad := range []string{"!!!", "bm90IGpzb24", ""} {
+		if _, err := decodeRoomCursor(bad); err == nil {
+			t.Fatalf("cursor %q should be invalid", bad)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"gochat/logic/dao"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 私有房间的成员：管理员邀请、用户申请后审批、凭邀请链接加入三种方式进名单
+
+const joinRequestMessageMax = 200
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func inviteLinkTtl(ttl int) (time.Duration, error) {
+	conf := config.Conf.Logic.LogicRoom
+	if ttl <= 0 {
+		ttl = conf.InviteLinkTtl
+	}
+	if ttl <= 0 {
+		ttl = 86400
+	}
+	if conf.InviteLinkMaxTtl > 0 && ttl > conf.InviteLinkMaxTtl {
+		return 0, errors.Errorf("invite link ttl too long, max %d", conf.InviteLinkMaxTtl)
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// 只有私有房间需要成员名单
+func checkPrivateRoom(room dao.Room) error {
+	if !room.Private {
+		return errors.New("room is public, join it directly")
+	}
+	if room.Archived {
+		return errRoomNotFound
+	}
+	return nil
+}
+
+func (rpc *RpcLogic) ListRoomMembers(ctx context.Context, args *proto.ListRoomMembersRequest, reply *proto.ListRoomMembersResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, _, err = checkRoomActor(args.AuthToken, args.RoomId, permRead)
+	if err != nil {
+		return err
+	}
+	m := new(dao.RoomMember)
+	list := m.ListByRoomId(args.RoomId)
+	u := new(dao.User)
+	reply.Members = make([]proto.RoomMemberInfo, 0, len(list))
+	for _, item := range list {
+		role, _ := userRoomRole(item.UserId, args.RoomId)
+		reply.Members = append(reply.Members, proto.RoomMemberInfo{
+			UserId:     item.UserId,
+			UserName:   u.GetUserNameByUserId(item.UserId),
+			Role:       role,
+			CreateTime: item.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 移出成员：自己可以退出；moderator 以上能移出比自己角色低的人；移出以后踢出房间，私有房间不能再收消息
+func (rpc *RpcLogic) RemoveRoomMember(ctx context.Context, args *proto.RoomMemberRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	r := new(dao.Room)
+	if r.GetById(args.RoomId).Id == 0 {
+		return errRoomNotFound
+	}
+	if args.UserId != userId {
+		if err = checkRoomPermission(userId, args.RoomId, permModerate); err != nil {
+			return err
+		}
+		actorRole, isAdmin := userRoomRole(userId, args.RoomId)
+		targetRole, _ := userRoomRole(args.UserId, args.RoomId)
+		if !isAdmin && roomRoleRank[targetRole] >= roomRoleRank[actorRole] {
+			return errors.New("no permission to remove this member")
+		}
+	}
+	m := new(dao.RoomMember)
+	if err = m.RemoveMember(args.RoomId, args.UserId); err != nil {
+		logrus.Errorf("remove room member err:%s", err.Error())
+		return err
+	}
+	kickFromRoom(args.UserId, args.RoomId, "removed from room members", false)
+	logrus.Infof("room member removed,roomId:%d,userId:%d,by:%d", args.RoomId, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 邀请用户进私有房间，moderator 以上才能邀请
+func (rpc *RpcLogic) InviteRoomMember(ctx context.Context, args *proto.RoomMemberRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if err = checkPrivateRoom(room); err != nil {
+		return err
+	}
+	u := new(dao.User)
+	target := u.GetUserById(args.UserId)
+	if target.Id == 0 {
+		return errors.New("no this user")
+	}
+	m := new(dao.RoomMember)
+	if m.IsMember(room.Id, args.UserId) {
+		return errors.New("already a member")
+	}
+	// 机器人没法登录接受邀请，直接加进名单
+	if target.IsBot {
+		if err = checkMemberCap(room, target.Id); err != nil {
+			return err
+		}
+		if err = m.AddMember(room.Id, target.Id); err != nil {
+			logrus.Errorf("add room member err:%s", err.Error())
+			return err
+		}
+		reply.Code = config.SuccessReplyCode
+		return
+	}
+	i := new(dao.RoomInvite)
+	if i.GetPending(room.Id, args.UserId).Id > 0 {
+		reply.Code = config.SuccessReplyCode
+		return
+	}
+	invite := &dao.RoomInvite{RoomId: room.Id, UserId: args.UserId, InviterId: userId}
+	if _, err = invite.Add(); err != nil {
+		logrus.Errorf("add room invite err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room invite,roomId:%d,userId:%d,by:%d", room.Id, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 我收到的待处理邀请
+func (rpc *RpcLogic) ListRoomInvites(ctx context.Context, args *proto.ListRoomInvitesRequest, reply *proto.ListRoomInvitesResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	i := new(dao.RoomInvite)
+	list := i.ListPendingByUserId(userId)
+	r := new(dao.Room)
+	reply.Invites = make([]proto.RoomInviteInfo, 0, len(list))
+	for _, item := range list {
+		reply.Invites = append(reply.Invites, proto.RoomInviteInfo{
+			InviteId:   item.Id,
+			RoomId:     item.RoomId,
+			RoomName:   r.GetById(item.RoomId).Name,
+			InviterId:  item.InviterId,
+			CreateTime: item.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 接受或者拒绝邀请，只能处理发给自己的
+func (rpc *RpcLogic) RespondRoomInvite(ctx context.Context, args *proto.RespondRoomInviteRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	i := new(dao.RoomInvite)
+	invite := i.GetById(args.InviteId)
+	if invite.Id == 0 || invite.UserId != userId || invite.Status != dao.RoomRequestPending {
+		return errors.New("no this invite")
+	}
+	if args.Accept {
+		r := new(dao.Room)
+		room := r.GetById(invite.RoomId)
+		if room.Id == 0 || room.Archived {
+			return errRoomNotFound
+		}
+		if err = checkMemberCap(room, userId); err != nil {
+			return err
+		}
+	}
+	ok, err := i.Resolve(invite.Id, args.Accept)
+	if err != nil {
+		logrus.Errorf("resolve room invite err:%s", err.Error())
+		return err
+	}
+	if !ok {
+		return errors.New("no this invite")
+	}
+	logrus.Infof("room invite resolved,roomId:%d,userId:%d,accept:%v", invite.RoomId, userId, args.Accept)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 申请加入私有房间，等 moderator 审批
+func (rpc *RpcLogic) RequestJoinRoom(ctx context.Context, args *proto.RequestJoinRoomRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	message := strings.TrimSpace(args.Message)
+	if utf8.RuneCountInString(message) > joinRequestMessageMax {
+		return errors.Errorf("message too long, max %d", joinRequestMessageMax)
+	}
+	r := new(dao.Room)
+	room := r.GetById(args.RoomId)
+	if room.Id == 0 {
+		return errRoomNotFound
+	}
+	if err = checkPrivateRoom(room); err != nil {
+		return err
+	}
+	m := new(dao.RoomMember)
+	if m.IsMember(room.Id, userId) {
+		return errors.New("already a member")
+	}
+	j := new(dao.RoomJoinRequest)
+	if j.GetPending(room.Id, userId).Id > 0 {
+		reply.Code = config.SuccessReplyCode
+		return
+	}
+	request := &dao.RoomJoinRequest{RoomId: room.Id, UserId: userId, Message: message}
+	if _, err = request.Add(); err != nil {
+		logrus.Errorf("add room join request err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room join request,roomId:%d,userId:%d", room.Id, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 待审批的入群申请，moderator 以上能看
+func (rpc *RpcLogic) ListJoinRequests(ctx context.Context, args *proto.ListJoinRequestsRequest, reply *proto.ListJoinRequestsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, _, err = checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	j := new(dao.RoomJoinRequest)
+	list := j.ListPendingByRoomId(args.RoomId)
+	u := new(dao.User)
+	reply.Requests = make([]proto.RoomJoinRequestInfo, 0, len(list))
+	for _, item := range list {
+		reply.Requests = append(reply.Requests, proto.RoomJoinRequestInfo{
+			RequestId:  item.Id,
+			RoomId:     item.RoomId,
+			UserId:     item.UserId,
+			UserName:   u.GetUserNameByUserId(item.UserId),
+			Message:    item.Message,
+			CreateTime: item.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) HandleJoinRequest(ctx context.Context, args *proto.HandleJoinRequestRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	j := new(dao.RoomJoinRequest)
+	request := j.GetById(args.RequestId)
+	if request.Id == 0 || request.Status != dao.RoomRequestPending {
+		return errors.New("no this join request")
+	}
+	userId, room, err := checkRoomActor(args.AuthToken, request.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if args.Approve {
+		if err = checkMemberCap(room, request.UserId); err != nil {
+			return err
+		}
+	}
+	ok, err := j.Resolve(request.Id, args.Approve, userId)
+	if err != nil {
+		logrus.Errorf("resolve room join request err:%s", err.Error())
+		return err
+	}
+	if !ok {
+		return errors.New("no this join request")
+	}
+	logrus.Infof("room join request resolved,roomId:%d,userId:%d,approve:%v,by:%d", request.RoomId, request.UserId, args.Approve, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 生成邀请链接，到期自动失效；token 只返回这一次，redis 里只存哈希
+func (rpc *RpcLogic) CreateInviteLink(ctx context.Context, args *proto.CreateInviteLinkRequest, reply *proto.CreateInviteLinkResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if err = checkPrivateRoom(room); err != nil {
+		return err
+	}
+	ttl, err := inviteLinkTtl(args.Ttl)
+	if err != nil {
+		return err
+	}
+	token := tools.GetRandomToken(32)
+	logic := new(Logic)
+	if err = RedisClient.Set(logic.getRoomInviteKey(hashInviteToken(token)), room.Id, ttl).Err(); err != nil {
+		logrus.Errorf("create invite link err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room invite link created,roomId:%d,by:%d,ttl:%v", room.Id, userId, ttl)
+	reply.Token = token
+	reply.ExpiresIn = int(ttl / time.Second)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 撤销邀请链接，要求是链接所在房间的 moderator 以上
+func (rpc *RpcLogic) RevokeInviteLink(ctx context.Context, args *proto.InviteLinkRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	logic := new(Logic)
+	key := logic.getRoomInviteKey(hashInviteToken(args.Token))
+	roomId, _ := strconv.Atoi(RedisClient.Get(key).Val())
+	if roomId == 0 {
+		return errors.New("invite link invalid or expired")
+	}
+	if _, _, err = checkRoomActor(args.AuthToken, roomId, permModerate); err != nil {
+		return err
+	}
+	if err = RedisClient.Del(key).Err(); err != nil {
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 凭邀请链接加入私有房间
+func (rpc *RpcLogic) JoinByInviteLink(ctx context.Context, args *proto.InviteLinkRequest, reply *proto.RoomInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	logic := new(Logic)
+	roomId, _ := strconv.Atoi(RedisClient.Get(logic.getRoomInviteKey(hashInviteToken(args.Token))).Val())
+	if roomId == 0 {
+		return errors.New("invite link invalid or expired")
+	}
+	r := new(dao.Room)
+	room := r.GetById(roomId)
+	if room.Id == 0 {
+		return errRoomNotFound
+	}
+	// 链接生成以后房间可能已经转成公开或者归档了
+	if err = checkPrivateRoom(room); err != nil {
+		return err
+	}
+	b := new(dao.RoomBan)
+	if b.IsBanned(roomId, userId) {
+		return errors.New("banned from this room")
+	}
+	if err = checkMemberCap(room, userId); err != nil {
+		return err
+	}
+	m := new(dao.RoomMember)
+	if err = m.AddMember(roomId, userId); err != nil {
+		logrus.Errorf("add room member err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room joined by invite link,roomId:%d,userId:%d", roomId, userId)
+	reply.Room = toRoomInfo(room)
+	reply.Code = config.SuccessReplyCode
+	return
+}
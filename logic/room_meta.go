@@ -0,0 +1,190 @@
+package logic
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 房间的话题、公告和置顶消息，moderator 以上能改，改完广播给房间里的人
+
+const (
+	roomTopicMax        = 256
+	roomAnnouncementMax = 1024
+	roomPinMax          = 50
+)
+
+// 房间当前的话题、公告和置顶，置顶的消息已经被删了的跳过
+func roomMeta(roomId int) proto.RoomMeta {
+	r := new(dao.Room)
+	room := r.GetById(roomId)
+	meta := proto.RoomMeta{
+		Topic:        room.Topic,
+		Announcement: room.Announcement,
+		Pins:         make([]proto.RoomPinInfo, 0),
+	}
+	p := new(dao.RoomPin)
+	pins := p.ListByRoomId(roomId)
+	if len(pins) == 0 {
+		return meta
+	}
+	messageIds := make([]int64, 0, len(pins))
+	for _, pin := range pins {
+		messageIds = append(messageIds, pin.MessageId)
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	rows, err := store.GetRoomMessagesByIds(context.Background(), roomId, messageIds)
+	if err != nil {
+		logrus.Warnf("room meta get pinned messages err:%s", err.Error())
+		return meta
+	}
+	messages := make(map[int64]chatstore.ChatMessage, len(rows))
+	for _, row := range rows {
+		messages[row.ID] = row
+	}
+	for _, pin := range pins {
+		message, ok := messages[pin.MessageId]
+		if !ok {
+			continue
+		}
+		meta.Pins = append(meta.Pins, proto.RoomPinInfo{
+			MessageId:    message.ID,
+			FromUserId:   message.FromUserID,
+			FromUserName: message.FromUserName,
+			Content:      message.Content,
+			CreateTime:   message.CreatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+			PinnedBy:     pin.PinnedBy,
+			PinTime:      pin.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return meta
+}
+
+// 改完推给房间，推失败不影响修改本身
+func publishRoomMeta(roomId int) proto.RoomMeta {
+	meta := roomMeta(roomId)
+	logic := new(Logic)
+	if err := logic.KafkaPushRoomMeta(roomId, meta); err != nil {
+		logrus.Warnf("publish KafkaPushRoomMeta err: %s", err.Error())
+	}
+	return meta
+}
+
+func (rpc *RpcLogic) SetRoomTopic(ctx context.Context, args *proto.SetRoomTopicRequest, reply *proto.RoomMetaResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if err = checkRoomAvailable(room.Id); err != nil {
+		return err
+	}
+	topic := strings.TrimSpace(args.Topic)
+	if utf8.RuneCountInString(topic) > roomTopicMax {
+		return errors.Errorf("topic too long, max %d", roomTopicMax)
+	}
+	if err = room.UpdateTopic(room.Id, topic); err != nil {
+		logrus.Errorf("set room topic err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room topic changed,roomId:%d,by:%d", room.Id, userId)
+	reply.Meta = publishRoomMeta(room.Id)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) SetRoomAnnouncement(ctx context.Context, args *proto.SetRoomAnnouncementRequest, reply *proto.RoomMetaResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if err = checkRoomAvailable(room.Id); err != nil {
+		return err
+	}
+	announcement := strings.TrimSpace(args.Announcement)
+	if utf8.RuneCountInString(announcement) > roomAnnouncementMax {
+		return errors.Errorf("announcement too long, max %d", roomAnnouncementMax)
+	}
+	if err = room.UpdateAnnouncement(room.Id, announcement); err != nil {
+		logrus.Errorf("set room announcement err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room announcement changed,roomId:%d,by:%d", room.Id, userId)
+	reply.Meta = publishRoomMeta(room.Id)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 只能置顶这个房间里的消息
+func (rpc *RpcLogic) PinRoomMessage(ctx context.Context, args *proto.RoomPinRequest, reply *proto.RoomMetaResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	if err = checkRoomAvailable(room.Id); err != nil {
+		return err
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	rows, err := store.GetRoomMessagesByIds(ctx, room.Id, []int64{args.MessageId})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return errors.New("message not found in this room")
+	}
+	p := new(dao.RoomPin)
+	if p.CountByRoomId(room.Id) >= roomPinMax {
+		return errors.Errorf("too many pinned messages, max %d", roomPinMax)
+	}
+	if err = p.Pin(room.Id, args.MessageId, userId); err != nil {
+		logrus.Errorf("pin room message err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room message pinned,roomId:%d,messageId:%d,by:%d", room.Id, args.MessageId, userId)
+	reply.Meta = publishRoomMeta(room.Id)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) UnpinRoomMessage(ctx context.Context, args *proto.RoomPinRequest, reply *proto.RoomMetaResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	p := new(dao.RoomPin)
+	removed, err := p.Unpin(room.Id, args.MessageId)
+	if err != nil {
+		logrus.Errorf("unpin room message err:%s", err.Error())
+		return err
+	}
+	if !removed {
+		return errors.New("message not pinned")
+	}
+	logrus.Infof("room message unpinned,roomId:%d,messageId:%d,by:%d", room.Id, args.MessageId, userId)
+	reply.Meta = publishRoomMeta(room.Id)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 能看房间的都能看话题、公告和置顶
+func (rpc *RpcLogic) GetRoomMeta(ctx context.Context, args *proto.GetRoomPermissionsRequest, reply *proto.RoomMetaResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, room, err := checkRoomActor(args.AuthToken, args.RoomId, permRead)
+	if err != nil {
+		return err
+	}
+	reply.Meta = roomMeta(room.Id)
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -0,0 +1,253 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 房间管理：禁言、踢出、封禁。moderator 以上能操作比自己角色低的人
+
+const moderateReasonMax = 200
+
+// 还要禁言多少秒，0 表示没被禁言
+func roomMutedFor(userId int, roomId int) int {
+	logic := new(Logic)
+	ttl, err := RedisClient.TTL(logic.getRoomMuteKey(strconv.Itoa(roomId), strconv.Itoa(userId))).Result()
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	// 不足一秒按一秒算
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
+// 操作的人要有 moderate 权限，并且角色比目标高，管理员不受限
+func checkModerateTarget(authToken string, roomId int, targetUserId int) (userId int, err error) {
+	userId, _, err = checkRoomActor(authToken, roomId, permModerate)
+	if err != nil {
+		return
+	}
+	if targetUserId <= 0 {
+		err = errors.New("userId empty")
+		return
+	}
+	if targetUserId == userId {
+		err = errors.New("can not moderate yourself")
+		return
+	}
+	actorRole, isAdmin := userRoomRole(userId, roomId)
+	targetRole, targetIsAdmin := userRoomRole(targetUserId, roomId)
+	if !isAdmin && (targetIsAdmin || roomRoleRank[targetRole] >= roomRoleRank[actorRole]) {
+		err = errors.New("no permission to moderate this user")
+	}
+	return
+}
+
+func checkModerateReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > moderateReasonMax {
+		return "", errors.Errorf("reason too long, max %d", moderateReasonMax)
+	}
+	return reason, nil
+}
+
+// 把用户移出房间在线名单，并通知用户所在的 connect 退订这个房间
+func kickFromRoom(userId int, roomId int, reason string, banned bool) {
+	leaveRoomRoster(userId, roomId)
+	publishRoomRoster(roomId)
+	sendRoomKick(userId, roomId, reason, banned)
+}
+
+// 通知用户所在的 connect 退订这个房间，不动名单
+func sendRoomKick(userId int, roomId int, reason string, banned bool) {
+	logic := new(Logic)
+	serverId := RedisSessClient.Get(logic.getUserKey(fmt.Sprintf("%d", userId))).Val()
+	if serverId == "" {
+		// 不在线，没有连接要断
+		return
+	}
+	body, err := json.Marshal(proto.RoomKickNotice{
+		Op:     config.OpRoomKick,
+		RoomId: roomId,
+		Reason: reason,
+		Banned: banned,
+	})
+	if err != nil {
+		logrus.Errorf("marshal room kick notice err:%s", err.Error())
+		return
+	}
+	if err = logic.KafkaPublishRoomKick(serverId, userId, roomId, body); err != nil {
+		logrus.Errorf("publish room kick err:%s", err.Error())
+	}
+}
+
+// 房间归档或者删除：一次清掉名单、观众和在线人数，推一次空名单，再给每个人发踢出通知
+func closeRoom(roomId int, reason string) {
+	logic := new(Logic)
+	roomUserKey := logic.getRoomUserKey(strconv.Itoa(roomId))
+	spectatorKey := logic.getRoomSpectatorKey(strconv.Itoa(roomId))
+	userIds := make(map[int]struct{})
+	for _, key := range []string{roomUserKey, spectatorKey} {
+		users, err := RedisClient.HKeys(key).Result()
+		if err != nil {
+			logrus.Warnf("close room list users err:%s", err.Error())
+			continue
+		}
+		for _, user := range users {
+			if userId, err := strconv.Atoi(user); err == nil {
+				userIds[userId] = struct{}{}
+			}
+		}
+	}
+	if err := RedisClient.Del(roomUserKey, spectatorKey, logic.getRoomOnlineCountKey(strconv.Itoa(roomId))).Err(); err != nil {
+		logrus.Warnf("close room del keys err:%s", err.Error())
+	}
+	if len(userIds) == 0 {
+		return
+	}
+	publishRoomRoster(roomId)
+	for userId := range userIds {
+		sendRoomKick(userId, roomId, reason, false)
+	}
+}
+
+func (rpc *RpcLogic) MuteRoomUser(ctx context.Context, args *proto.ModerateRoomUserRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, err := checkModerateTarget(args.AuthToken, args.RoomId, args.UserId)
+	if err != nil {
+		return err
+	}
+	if args.Duration <= 0 {
+		return errors.New("mute duration must be positive")
+	}
+	if maxTtl := config.Conf.Logic.LogicRoom.MuteMaxTtl; maxTtl > 0 && args.Duration > maxTtl {
+		return errors.Errorf("mute duration too long, max %d", maxTtl)
+	}
+	reason, err := checkModerateReason(args.Reason)
+	if err != nil {
+		return err
+	}
+	logic := new(Logic)
+	muteKey := logic.getRoomMuteKey(strconv.Itoa(args.RoomId), strconv.Itoa(args.UserId))
+	if err = RedisClient.Set(muteKey, reason, time.Duration(args.Duration)*time.Second).Err(); err != nil {
+		logrus.Errorf("set room mute err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room user muted,roomId:%d,userId:%d,duration:%d,by:%d", args.RoomId, args.UserId, args.Duration, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) UnmuteRoomUser(ctx context.Context, args *proto.ModerateRoomUserRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, err := checkModerateTarget(args.AuthToken, args.RoomId, args.UserId)
+	if err != nil {
+		return err
+	}
+	logic := new(Logic)
+	muteKey := logic.getRoomMuteKey(strconv.Itoa(args.RoomId), strconv.Itoa(args.UserId))
+	if err = RedisClient.Del(muteKey).Err(); err != nil {
+		logrus.Errorf("del room mute err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room user unmuted,roomId:%d,userId:%d,by:%d", args.RoomId, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 踢出只是让连接退订这个房间，之后还能再进
+func (rpc *RpcLogic) KickRoomUser(ctx context.Context, args *proto.ModerateRoomUserRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, err := checkModerateTarget(args.AuthToken, args.RoomId, args.UserId)
+	if err != nil {
+		return err
+	}
+	reason, err := checkModerateReason(args.Reason)
+	if err != nil {
+		return err
+	}
+	kickFromRoom(args.UserId, args.RoomId, reason, false)
+	logrus.Infof("room user kicked,roomId:%d,userId:%d,by:%d", args.RoomId, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 封禁：记录到 room_ban，移出成员名单并踢出房间，解封前进不来
+func (rpc *RpcLogic) BanRoomUser(ctx context.Context, args *proto.ModerateRoomUserRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, err := checkModerateTarget(args.AuthToken, args.RoomId, args.UserId)
+	if err != nil {
+		return err
+	}
+	reason, err := checkModerateReason(args.Reason)
+	if err != nil {
+		return err
+	}
+	u := new(dao.User)
+	if u.GetUserNameByUserId(args.UserId) == "" {
+		return errors.New("user not exists")
+	}
+	b := new(dao.RoomBan)
+	if err = b.Ban(args.RoomId, args.UserId, userId, reason); err != nil {
+		logrus.Errorf("ban room user err:%s", err.Error())
+		return err
+	}
+	m := new(dao.RoomMember)
+	if err = m.RemoveMember(args.RoomId, args.UserId); err != nil {
+		logrus.Errorf("ban remove room member err:%s", err.Error())
+		return err
+	}
+	kickFromRoom(args.UserId, args.RoomId, reason, true)
+	logrus.Infof("room user banned,roomId:%d,userId:%d,by:%d", args.RoomId, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 解封以后私有房间还要重新邀请才能进
+func (rpc *RpcLogic) UnbanRoomUser(ctx context.Context, args *proto.ModerateRoomUserRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, err := checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	b := new(dao.RoomBan)
+	if err = b.Unban(args.RoomId, args.UserId); err != nil {
+		logrus.Errorf("unban room user err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("room user unbanned,roomId:%d,userId:%d,by:%d", args.RoomId, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+func (rpc *RpcLogic) ListRoomBans(ctx context.Context, args *proto.GetRoomPermissionsRequest, reply *proto.ListRoomBansResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, _, err = checkRoomActor(args.AuthToken, args.RoomId, permModerate)
+	if err != nil {
+		return err
+	}
+	b := new(dao.RoomBan)
+	list := b.ListByRoomId(args.RoomId)
+	u := new(dao.User)
+	reply.Bans = make([]proto.RoomBanInfo, 0, len(list))
+	for _, item := range list {
+		reply.Bans = append(reply.Bans, proto.RoomBanInfo{
+			UserId:     item.UserId,
+			UserName:   u.GetUserNameByUserId(item.UserId),
+			BannedBy:   item.BannedBy,
+			Reason:     item.Reason,
+			CreateTime: item.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
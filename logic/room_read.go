@@ -0,0 +1,152 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/db"
+	"gochat/internal/chatstore"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 已读：每个人在每个房间读到哪条消息存在 chatstore，只往后移；未读数按已读位置往后数
+// 已读位置变了推给房间里的人，资料里关了已读回执的不推也不列出来
+
+func toRoomRead(marker chatstore.RoomReadMarker, userName string, profile dao.UserProfile) proto.RoomRead {
+	return proto.RoomRead{
+		RoomId:      marker.RoomID,
+		UserId:      marker.UserID,
+		UserName:    userName,
+		DisplayName: displayNameOf(userName, profile),
+		LastReadId:  marker.LastReadID,
+		ReadTime:    marker.UpdatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 已读位置变了，推给房间里的人
+func publishRoomRead(userId int, userName string, marker chatstore.RoomReadMarker) {
+	p := new(dao.UserProfile)
+	profile := p.GetByUserId(userId)
+	if profile.HideReadReceipts {
+		return
+	}
+	read := toRoomRead(marker, userName, profile)
+	read.Op = config.OpRoomReadSend
+	body, err := json.Marshal(read)
+	if err != nil {
+		logrus.Errorf("marshal room read err:%s", err.Error())
+		return
+	}
+	logic := new(Logic)
+	if err = logic.KafkaPushRoomRead(marker.RoomID, body); err != nil {
+		logrus.Warnf("publish KafkaPushRoomRead err: %s", err.Error())
+	}
+}
+
+// 标记读到房间里的某条消息，api 和 ws/tcp 上的 config.OpReadRoom 都走这里
+func (rpc *RpcLogic) MarkRoomRead(ctx context.Context, args *proto.MarkRoomReadRequest, reply *proto.MarkRoomReadReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.MessageId <= 0 {
+		return errors.New("messageId required")
+	}
+	userId, room, err := checkRoomActor(args.AuthToken, args.RoomId, permRead)
+	if err != nil {
+		return err
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	marker, moved, err := store.MarkRoomRead(ctx, userId, room.Id, args.MessageId)
+	if err == gorm.ErrRecordNotFound {
+		return errors.New("message not found")
+	}
+	if err != nil {
+		return err
+	}
+	if moved {
+		u := new(dao.User)
+		publishRoomRead(userId, u.GetUserNameByUserId(userId), marker)
+	}
+	reply.UserId = userId
+	reply.LastReadId = marker.LastReadID
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 自己加入的每个房间的未读数和 @ 自己的条数，归档的和没权限看的不算
+func (rpc *RpcLogic) ListRoomUnread(ctx context.Context, args *proto.ListRoomUnreadRequest, reply *proto.ListRoomUnreadResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, userName, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	m := new(dao.RoomMember)
+	roomIds := m.ListRoomIdsByUserId(userId)
+	store := chatstore.New(db.GetDb("gochat"))
+	markers, err := store.GetRoomReadMarkers(ctx, userId, roomIds)
+	if err != nil {
+		return err
+	}
+	r := new(dao.Room)
+	reply.Data = make([]proto.RoomUnread, 0, len(roomIds))
+	for _, roomId := range roomIds {
+		room := r.GetById(roomId)
+		if room.Id == 0 || room.Archived {
+			continue
+		}
+		if checkRoomPermission(userId, roomId, permRead) != nil {
+			continue
+		}
+		marker := markers[roomId]
+		unread, mentions, err := store.CountRoomUnread(ctx, roomId, userId, marker, userName)
+		if err != nil {
+			return err
+		}
+		reply.Data = append(reply.Data, proto.RoomUnread{
+			RoomId:     roomId,
+			RoomName:   room.Name,
+			LastReadId: marker.LastReadID,
+			Unread:     unread,
+			Mentions:   mentions,
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 房间里每个人读到了哪，客户端拿来显示消息被谁读了
+func (rpc *RpcLogic) ListRoomReads(ctx context.Context, args *proto.GetRoomPermissionsRequest, reply *proto.ListRoomReadsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, room, err := checkRoomActor(args.AuthToken, args.RoomId, permRead)
+	if err != nil {
+		return err
+	}
+	store := chatstore.New(db.GetDb("gochat"))
+	markers, err := store.ListRoomReadMarkers(ctx, room.Id)
+	if err != nil {
+		return err
+	}
+	userIds := make([]int, 0, len(markers))
+	for _, marker := range markers {
+		userIds = append(userIds, marker.UserID)
+	}
+	p := new(dao.UserProfile)
+	profiles := p.GetByUserIds(userIds)
+	u := new(dao.User)
+	reply.Data = make([]proto.RoomRead, 0, len(markers))
+	for _, marker := range markers {
+		profile := profiles[marker.UserID]
+		if profile.HideReadReceipts {
+			continue
+		}
+		reply.Data = append(reply.Data, toRoomRead(marker, u.GetUserNameByUserId(marker.UserID), profile))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"gochat/db"
 	"gochat/internal/chatstore"
 	"gochat/internal/proto"
+	"gochat/logic/dao"
 	"time"
 )
 
@@ -15,6 +16,12 @@ func (rpc *RpcLogic) ListRoomMessages(ctx context.Context, req *proto.ListMessag
 	if req.RoomId <= 0 {
 		return errors.New("roomId required")
 	}
+	if err := checkRoomAvailable(req.RoomId); err != nil {
+		return err
+	}
+	if err := checkRoomPermission(req.UserId, req.RoomId, permRead); err != nil {
+		return err
+	}
 	if req.Limit <= 0 || req.Limit > 500 {
 		req.Limit = 100
 	}
@@ -24,15 +31,26 @@ func (rpc *RpcLogic) ListRoomMessages(ctx context.Context, req *proto.ListMessag
 	if err != nil {
 		return err
 	}
+	// 发送者资料一次查出来
+	userIds := make([]int, 0, len(rows))
+	for _, r := range rows {
+		userIds = append(userIds, r.FromUserID)
+	}
+	p := new(dao.UserProfile)
+	profiles := p.GetByUserIds(userIds)
 	out := make([]proto.MessageDTO, 0, len(rows))
 	for _, r := range rows {
+		profile := profiles[r.FromUserID]
 		out = append(out, proto.MessageDTO{
-			Id:           r.ID,
-			RoomId:       r.RoomID,
-			FromUserId:   r.FromUserID,
-			FromUserName: r.FromUserName,
-			Content:      r.Content,
-			CreateTime:   r.CreatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+			Id:              r.ID,
+			RoomId:          r.RoomID,
+			FromUserId:      r.FromUserID,
+			FromUserName:    r.FromUserName,
+			Content:         r.Content,
+			CreateTime:      r.CreatedAt.In(time.Local).Format("2006-01-02 15:04:05"),
+			FromDisplayName: displayNameOf(r.FromUserName, profile),
+			FromAvatar:      profile.AvatarUrl,
+			IsBot:           r.IsBot,
 		})
 	}
 	resp.Data = out
@@ -9,17 +9,43 @@ import (
 	"gochat/config"
 	proto2 "gochat/internal/proto"
 	"gochat/internal/tools"
+	"gochat/logic/dao"
 	"strconv"
 	"strings"
+	"time"
 )
 
 /*
 *
-single send msg 发消息队列中
+single send msg 先落库再发消息队列中，对方不在线也能在私信历史里看到
 */
-func (rpc *RpcLogic) Push(ctx context.Context, args *proto2.Send, reply *proto2.SuccessReply) (err error) {
+func (rpc *RpcLogic) Push(ctx context.Context, args *proto2.Send, reply *proto2.PushReply) (err error) {
 	reply.Code = config.FailReplyCode
 	sendData := args
+	if sendData.FromUserId <= 0 || sendData.ToUserId <= 0 {
+		return errors.New("fromUserId or toUserId empty")
+	}
+	if sendData.FromUserId == sendData.ToUserId {
+		return errors.New("can not send direct message to yourself")
+	}
+	if strings.TrimSpace(sendData.Msg) == "" {
+		return errors.New("msg empty")
+	}
+	// 收件人不存在就不落库，免得建出对不上人的会话
+	toUser := new(dao.User).GetUserById(sendData.ToUserId)
+	if toUser.Id == 0 {
+		return errors.New("no this user")
+	}
+	sendData.ToUserName = toUser.UserName
+	fillSenderProfile(sendData)
+	sendData.Op = config.OpSingleSend
+	sendData.RoomId = 0
+	if err = saveDirectMessage(ctx, sendData); err != nil {
+		logrus.Errorf("logic,push save direct message err:%s", err.Error())
+		return
+	}
+	reply.ConversationId = sendData.ConversationId
+	reply.MessageId = sendData.ClientMsgId
 	var bodyBytes []byte
 	bodyBytes, err = json.Marshal(sendData)
 	if err != nil {
@@ -31,10 +57,11 @@ func (rpc *RpcLogic) Push(ctx context.Context, args *proto2.Send, reply *proto2.
 	logic := new(Logic)
 	userSidKey := logic.getUserKey(fmt.Sprintf("%d", sendData.ToUserId))
 	serverIdStr := RedisSessClient.Get(userSidKey).Val()
-	//var serverIdInt int
-	//serverIdInt, err = strconv.Atoi(serverId)
-	if err != nil {
-		logrus.Errorf("logic,push parse int fail:%s", err.Error())
+	if serverIdStr == "" {
+		// 不在线，已经落库了，再放一份进离线收件箱，上线的时候补发
+		logrus.Infof("logic,push user %d offline,message stored", sendData.ToUserId)
+		pushOffline([]int{sendData.ToUserId}, config.OpSingleSend, bodyBytes)
+		reply.Code = config.SuccessReplyCode
 		return
 	}
 
@@ -53,8 +80,27 @@ func (rpc *RpcLogic) Push(ctx context.Context, args *proto2.Send, reply *proto2.
 *
 push msg to room 群聊消息推送 到队列中
 */
-func (rpc *RpcLogic) PushRoom(ctx context.Context, args *proto2.Send, reply *proto2.SuccessReply) (err error) {
+func (rpc *RpcLogic) PushRoom(ctx context.Context, args *proto2.Send, reply *proto2.PushRoomReply) (err error) {
 	reply.Code = config.FailReplyCode
+	r := new(dao.Room)
+	room := r.GetById(args.RoomId)
+	if room.Id == 0 || room.Archived {
+		return errRoomNotFound
+	}
+	// 没有发言权限的（比如 guest）直接拒绝，AI 指令也算发言；权限算一次，限流也要用
+	perms := roomPermissionsOf(args.FromUserId, args.RoomId, room)
+	if err = checkPerms(args.FromUserId, perms, permSend); err != nil {
+		logrus.Infof("logic,PushRoom permission denied,userId:%d,roomId:%d", args.FromUserId, args.RoomId)
+		return err
+	}
+	// 慢速模式和令牌桶限流，返回 nil 才能把 RetryAfter 带回去
+	if retryAfter := sendRetryAfter(args.FromUserId, room, perms); retryAfter > 0 {
+		logrus.Infof("logic,PushRoom rate limited,userId:%d,roomId:%d,retryAfter:%s", args.FromUserId, args.RoomId, retryAfter)
+		reply.Code = config.RateLimitedCode
+		reply.RetryAfter = int((retryAfter + time.Second - 1) / time.Second)
+		reply.Msg = fmt.Sprintf("sending too fast, retry after %d seconds", reply.RetryAfter)
+		return nil
+	}
 
 	// --- 新增：识别 /ai /summarize /translate ---
 	msg := strings.TrimSpace(args.Msg)
@@ -115,6 +161,7 @@ func (rpc *RpcLogic) PushRoom(ctx context.Context, args *proto2.Send, reply *pro
 	sendData.Msg = args.Msg
 	sendData.FromUserId = args.FromUserId
 	sendData.FromUserName = args.FromUserName
+	fillSenderProfile(sendData)
 	sendData.Op = config.OpRoomSend
 	sendData.CreateTime = tools.GetNowDateTime()
 
@@ -7,7 +7,6 @@ package logic
 
 import (
 	"context"
-	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gochat/config"
@@ -35,24 +34,28 @@ func (rpc *RpcLogic) Register(ctx context.Context, args *proto.RegisterRequest,
 	if userId == 0 {
 		return errors.New("register userId empty!")
 	}
-	//set token 生成会话令牌
-	randToken := tools.GetRandomToken(32)
-	sessionId := tools.CreateSessionId(randToken) // 拿到 sess_token
-	userData := make(map[string]interface{})
-	userData["userId"] = userId
-	userData["userName"] = args.Name
-	RedisSessClient.Do("MULTI")
-	RedisSessClient.HMSet(sessionId, userData) // sess_token : userData
-	RedisSessClient.Expire(sessionId, 86400*time.Second)
-	err = RedisSessClient.Do("EXEC").Err()
+	meta := sessionMeta{
+		DeviceName: args.DeviceName,
+		UserAgent:  args.UserAgent,
+		ClientIp:   args.ClientIp,
+	}
+	reply.AuthToken, reply.RefreshToken, reply.ExpiresIn, err = issueLogin(userId, args.Name, meta)
 	if err != nil {
-		logrus.Infof("register set redis token fail!")
+		logrus.Infof("register issue auth token fail:%s", err.Error())
 		return err
 	}
-
 	// 操作成功，返回认证令牌
 	reply.Code = config.SuccessReplyCode
-	reply.AuthToken = randToken
+	return
+}
+
+// 登录成功以后发令牌：签名 token 模式直接签 token，不建 redis 会话；
+// 会话模式多端登录各自一个会话，不再踢掉之前的设备
+func issueLogin(userId int, userName string, meta sessionMeta) (authToken string, refreshToken string, expiresIn int, err error) {
+	if config.Conf.Api.ApiAuth.IsTokenMode() {
+		return issueTokens(userId, userName, meta)
+	}
+	authToken, err = createSession(userId, userName, meta)
 	return
 }
 
@@ -65,47 +68,56 @@ func (rpc *RpcLogic) Login(ctx context.Context, args *proto.LoginRequest, reply
 	userName := args.Name
 	passWord := args.Password
 
-	// 检查用户状态
+	// 失败太多次的账号/IP 先挡掉，不去校验密码
+	if retryAfter := loginRetryAfter(userName, args.ClientIp); retryAfter > 0 {
+		logrus.Infof("login throttled,userName:%s,ip:%s,retryAfter:%s", userName, args.ClientIp, retryAfter)
+		reply.RetryAfter = int((retryAfter + time.Second - 1) / time.Second)
+		return
+	}
+
+	// 检查用户状态，用户不存在和密码错误一样计失败次数，提示也一样；机器人账号不能密码登录
 	data := u.CheckHaveUserName(userName)
-	if (data.Id == 0) || (passWord != data.Password) {
+	if (data.Id == 0) || data.IsBot || !tools.CheckPassword(data.Password, passWord) {
+		recordLoginFailure(userName, args.ClientIp)
 		return errors.New("no this user or password error!")
 	}
 
-	// 创建登录会话ID
-	loginSessionId := tools.GetSessionIdByUserId(data.Id) // sess_map_78 : token
-	//set token
-	//err = redis.HMSet(auth, userData)
-	randToken := tools.GetRandomToken(32)
-	sessionId := tools.CreateSessionId(randToken)
-	userData := make(map[string]interface{})
-	userData["userId"] = data.Id
-	userData["userName"] = data.UserName
-	//check is login，根据登录会话ID查一下是否登录
-	token, _ := RedisSessClient.Get(loginSessionId).Result()
-
-	// 如果登陆了就删掉，相当于刷新一下登录状态，删了redis中缓存再添加
-	if token != "" {
-		//logout already login user session
-		oldSession := tools.CreateSessionId(token)
-		err := RedisSessClient.Del(oldSession).Err()
+	// 老的明文密码（或者 cost 调整过）在登录成功时顺手升级成新哈希
+	passwordCost := config.Conf.Logic.LogicAuth.PasswordCost
+	if tools.PasswordNeedsRehash(data.Password, passwordCost) {
+		if hashed, err := tools.HashPassword(passWord, passwordCost); err != nil {
+			logrus.Warnf("login rehash password fail,userId:%d,err:%s", data.Id, err.Error())
+		} else if err := u.UpdatePassword(data.Id, hashed); err != nil {
+			logrus.Warnf("login update password fail,userId:%d,err:%s", data.Id, err.Error())
+		}
+	}
+
+	meta := sessionMeta{
+		DeviceName: args.DeviceName,
+		UserAgent:  args.UserAgent,
+		ClientIp:   args.ClientIp,
+	}
+	// 开了两步验证的先不发令牌，给个挑战 token 去 Login2fa 换
+	if data.TotpEnabled {
+		reply.ChallengeToken, reply.ChallengeExpiresIn, err = createLoginChallenge(data.Id, data.UserName, meta)
 		if err != nil {
-			return errors.New("logout user fail!token is:" + token)
+			logrus.Infof("login create 2fa challenge fail:%s", err.Error())
+			return err
 		}
+		reply.Code = config.SuccessReplyCode
+		return
 	}
-	RedisSessClient.Do("MULTI")
-	RedisSessClient.HMSet(sessionId, userData) // sess_token : userData
-	RedisSessClient.Expire(sessionId, 86400*time.Second)
-	RedisSessClient.Set(loginSessionId, randToken, 86400*time.Second) // sess_map_78 : token
-	err = RedisSessClient.Do("EXEC").Err()
-	//err = RedisSessClient.Set(authToken, data.Id, 86400*time.Second).Err()
+
+	reply.AuthToken, reply.RefreshToken, reply.ExpiresIn, err = issueLogin(data.Id, data.UserName, meta)
 	if err != nil {
-		logrus.Infof("register set redis token fail!")
+		logrus.Infof("login issue auth token fail:%s", err.Error())
 		return err
 	}
+	// 开了两步验证的要等 Login2fa 通过才清失败计数
+	resetLoginFailure(userName)
 
 	// 返回登录成功状态码以及token
 	reply.Code = config.SuccessReplyCode
-	reply.AuthToken = randToken
 	return
 }
 
@@ -117,6 +129,10 @@ func (rpc *RpcLogic) GetUserInfoByUserId(ctx context.Context, args *proto.GetUse
 	userName := u.GetUserNameByUserId(userId)
 	reply.UserId = userId
 	reply.UserName = userName
+	p := new(dao.UserProfile)
+	profile := p.GetByUserId(userId)
+	reply.DisplayName = displayNameOf(userName, profile)
+	reply.AvatarUrl = profile.AvatarUrl
 	reply.Code = config.SuccessReplyCode
 	return
 }
@@ -125,25 +141,24 @@ func (rpc *RpcLogic) CheckAuth(ctx context.Context, args *proto.CheckAuthRequest
 	reply.Code = config.FailReplyCode
 	authToken := args.AuthToken
 
-	// 通过登录认证令牌拿到会话名
-	sessionName := tools.GetSessionName(authToken)
-	var userDataMap = map[string]string{}
-	userDataMap, err = RedisSessClient.HGetAll(sessionName).Result()
+	// 通过登录认证令牌拿到用户元信息，redis 会话模式下顺便续期
+	userId, userName, expired, err := authUser(authToken)
 	if err != nil {
 		logrus.Infof("check auth fail!,authToken is:%s", authToken)
 		return err
 	}
-	if len(userDataMap) == 0 {
+	if expired {
+		logrus.Infof("user session expired,authToken is:%s", authToken)
+		reply.Code = config.SessionExpiredCode
+		return
+	}
+	if userId == 0 {
 		logrus.Infof("no this user session,authToken is:%s", authToken)
 		return
 	}
-
-	// 如果有会话存在就填充用户元信息，否则就像上面那样返回err
-	intUserId, _ := strconv.Atoi(userDataMap["userId"])
-	reply.UserId = intUserId
-	userName, _ := userDataMap["userName"]
-	reply.Code = config.SuccessReplyCode
+	reply.UserId = userId
 	reply.UserName = userName
+	reply.Code = config.SuccessReplyCode
 	return
 }
 
@@ -151,6 +166,14 @@ func (rpc *RpcLogic) CheckAuth(ctx context.Context, args *proto.CheckAuthRequest
 func (rpc *RpcLogic) Logout(ctx context.Context, args *proto.LogoutRequest, reply *proto.LogoutResponse) (err error) {
 	reply.Code = config.FailReplyCode
 	authToken := args.AuthToken
+	if config.Conf.Api.ApiAuth.IsTokenMode() {
+		if err = logoutAccessToken(authToken); err != nil {
+			logrus.Infof("logout token error:%s", err.Error())
+			return err
+		}
+		reply.Code = config.SuccessReplyCode
+		return
+	}
 	sessionName := tools.GetSessionName(authToken)
 
 	var userDataMap = map[string]string{}
@@ -165,29 +188,81 @@ func (rpc *RpcLogic) Logout(ctx context.Context, args *proto.LogoutRequest, repl
 	}
 
 	// 先验证会话，如果不存在那就结束了，皆大欢喜，存在的话就要一个一个删了
-	// 并非是验证
+	// 只删当前这个设备的会话，其他设备不受影响；最后一个会话退出时连同服务器映射一起删掉
 	intUserId, _ := strconv.Atoi(userDataMap["userId"])
-	sessIdMap := tools.GetSessionIdByUserId(intUserId)
-	//del sess_map like sess_map_1
-	err = RedisSessClient.Del(sessIdMap).Err()
+	err = deleteSession(intUserId, authToken)
+	if err != nil {
+		logrus.Infof("logout error:%s", err.Error())
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 列出当前用户所有登录设备
+func (rpc *RpcLogic) ListSessions(ctx context.Context, args *proto.ListSessionsRequest, reply *proto.ListSessionsResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
 	if err != nil {
-		logrus.Infof("logout del sess map error:%s", err.Error())
 		return err
 	}
-	//del serverId 为什么？
-	// 删除用户当前链接的Connect层服务器标识，因为用户已经登出了，所以这个链接就要删掉，具体的逻辑，还是到connect层再看
-	logic := new(Logic)
-	serverIdKey := logic.getUserKey(fmt.Sprintf("%d", intUserId))
-	err = RedisSessClient.Del(serverIdKey).Err()
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	tokens, sessions := listSessions(userId)
+	reply.Sessions = make([]proto.SessionInfo, 0, len(tokens))
+	for i, token := range tokens {
+		reply.Sessions = append(reply.Sessions, toSessionInfo(token, sessions[i], args.AuthToken))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 踢掉指定的一个设备
+func (rpc *RpcLogic) RevokeSession(ctx context.Context, args *proto.RevokeSessionRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
 	if err != nil {
-		logrus.Infof("logout del server id error:%s", err.Error())
 		return err
 	}
-	err = RedisSessClient.Del(sessionName).Err()
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	tokens, _ := listSessions(userId)
+	for _, token := range tokens {
+		if tools.GetSessionPublicId(token) != args.SessionId {
+			continue
+		}
+		if err = deleteSession(userId, token); err != nil {
+			logrus.Infof("revoke session error:%s", err.Error())
+			return err
+		}
+		reply.Code = config.SuccessReplyCode
+		return
+	}
+	return errors.New("no this session")
+}
+
+// 除了当前设备，其他设备全部下线
+func (rpc *RpcLogic) RevokeOtherSessions(ctx context.Context, args *proto.RevokeOtherSessionsRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
 	if err != nil {
-		logrus.Infof("logout error:%s", err.Error())
 		return err
 	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	tokens, _ := listSessions(userId)
+	for _, token := range tokens {
+		if token == args.AuthToken {
+			continue
+		}
+		if err = deleteSession(userId, token); err != nil {
+			logrus.Infof("revoke other session error:%s", err.Error())
+			return err
+		}
+	}
 	reply.Code = config.SuccessReplyCode
 	return
 }
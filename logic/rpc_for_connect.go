@@ -3,93 +3,236 @@ package logic
 import (
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gochat/config"
 	"gochat/internal/proto"
-	"gochat/internal/tools"
+	"gochat/logic/dao"
 	"strconv"
 	"time"
 )
 
-// 加入房间
-func (rpc *RpcLogic) Connect(ctx context.Context, args *proto.ConnectRequest, reply *proto.ConnectReply) (err error) {
-	if args == nil {
-		logrus.Errorf("logic,connect args empty")
+// 建连和进房间共用的检查：会话、房间是否可用、有没有进房间的权限、房间满没满
+// 会话过期、房间不存在、没权限、满了不算出错，返回对应的码让 connect 层告诉客户端
+func checkJoinRoom(authToken string, roomId int) (userId int, userName string, seat proto.RoomSeat, code int, err error) {
+	logrus.Infof("logic,authToken is:%s", authToken)
+	userId, userName, expired, err := authUser(authToken)
+	if err != nil {
+		logrus.Infof("logic connect auth err:%s", err.Error())
 		return
 	}
+	if expired {
+		return 0, "", seat, config.SessionExpiredCode, nil
+	}
+	if userId == 0 {
+		return
+	}
+	// 房间不存在或者归档了，同样给个明确的码
+	if err = checkRoomAvailable(roomId); err != nil {
+		logrus.Infof("logic connect room not available,userId:%d,roomId:%d", userId, roomId)
+		return 0, "", seat, config.RoomNotFoundCode, nil
+	}
+	if err = checkRoomPermission(userId, roomId, permJoin); err != nil {
+		logrus.Infof("logic connect permission denied,userId:%d,roomId:%d", userId, roomId)
+		return 0, "", seat, config.PermissionDeniedCode, nil
+	}
+	r := new(dao.Room)
+	seat, full := roomSeat(userId, r.GetById(roomId))
+	if full {
+		logrus.Infof("logic connect room full,userId:%d,roomId:%d", userId, roomId)
+		return 0, "", seat, config.RoomFullCode, nil
+	}
+	seat.MutedFor = roomMutedFor(userId, roomId)
+	return userId, userName, seat, config.SuccessReplyCode, nil
+}
 
-	// 验证会话
+// 房间名单加人，人数加1，人数检查和进名单一起原子地做，返回 false 表示在线人数满了；
+// 记录用户所在的 connect 服务器，记成员
+func joinRoomRoster(userId int, userName string, roomId int, serverId string, maxOnline int) bool {
 	logic := new(Logic)
-	//key := logic.getUserKey(args.AuthToken)
-	logrus.Infof("logic,authToken is:%s", args.AuthToken)
-	key := tools.GetSessionName(args.AuthToken)
-	userInfo, err := RedisClient.HGetAll(key).Result()
+	roomUserKey := logic.getRoomUserKey(strconv.Itoa(roomId))
+	onlineKey := logic.getRoomOnlineCountKey(fmt.Sprintf("%d", roomId))
+	seated, err := seatRoomScript.Run(RedisClient, []string{roomUserKey, onlineKey}, userId, userName, maxOnline).Int()
 	if err != nil {
-		logrus.Infof("RedisCli HGetAll key :%s , err:%s", key, err.Error())
-		return err
+		logrus.Warnf("seat room err:%s", err.Error())
 	}
-	if len(userInfo) == 0 {
-		reply.UserId = 0
-		return
+	if seated == 0 {
+		return false
 	}
-	reply.UserId, _ = strconv.Atoi(userInfo["userId"])
-	roomUserKey := logic.getRoomUserKey(strconv.Itoa(args.RoomId))
-	if reply.UserId != 0 {
-		userKey := logic.getUserKey(fmt.Sprintf("%d", reply.UserId))
-		logrus.Infof("logic redis set userKey:%s, serverId : %s", userKey, args.ServerId)
-		validTime := config.RedisBaseValidTime * time.Second
+	userKey := logic.getUserKey(fmt.Sprintf("%d", userId))
+	logrus.Infof("logic redis set userKey:%s, serverId : %s", userKey, serverId)
+	validTime := config.RedisBaseValidTime * time.Second
 
-		// 记录用户 - 服务器 映射
-		err = RedisClient.Set(userKey, args.ServerId, validTime).Err()
-		if err != nil {
-			logrus.Warnf("logic set err:%s", err)
-		}
+	// 记录用户 - 服务器 映射
+	if err := RedisClient.Set(userKey, serverId, validTime).Err(); err != nil {
+		logrus.Warnf("logic set err:%s", err)
+	}
 
-		// 加入房间，人数加1，房间记录新用户
-		if RedisClient.HGet(roomUserKey, fmt.Sprintf("%d", reply.UserId)).Val() == "" {
-			RedisClient.HSet(roomUserKey, fmt.Sprintf("%d", reply.UserId), userInfo["userName"])
-			// add room user count ++
-			RedisClient.Incr(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", args.RoomId)))
-		}
+	// 进过的房间记成员，房间目录的成员数按这个算；已经是成员什么都不做
+	m := new(dao.RoomMember)
+	if err := m.AddMember(roomId, userId); err != nil {
+		logrus.Warnf("add room member err:%s", err.Error())
 	}
-	logrus.Infof("logic rpc userId:%d", reply.UserId)
-	return
+
+	// 之前是观众的，现在有位置了
+	leaveRoomSpectator(userId, roomId)
+	return true
 }
 
-// 离开房间
-func (rpc *RpcLogic) DisConnect(ctx context.Context, args *proto.DisConnectRequest, reply *proto.DisConnectReply) (err error) {
+// 房间名单减人，人数减1；观众不在名单里，顺带清掉
+func leaveRoomRoster(userId int, roomId int) {
+	leaveRoomSpectator(userId, roomId)
 	logic := new(Logic)
-	roomUserKey := logic.getRoomUserKey(strconv.Itoa(args.RoomId))
-	// room user count -- 更新在线人数
-	if args.RoomId > 0 {
-		count, _ := RedisSessClient.Get(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", args.RoomId))).Int()
-		if count > 0 {
-			RedisClient.Decr(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", args.RoomId))).Result()
-		}
-	}
-	// room login user-- 将用户从map中移除
-	if args.UserId != 0 {
-		err = RedisClient.HDel(roomUserKey, fmt.Sprintf("%d", args.UserId)).Err()
+	roomUserKey := logic.getRoomUserKey(strconv.Itoa(roomId))
+	// room login user-- 将用户从map中移除，名单里本来就没有的（比如已被踢）不再减人数
+	if userId != 0 {
+		removed, err := RedisClient.HDel(roomUserKey, fmt.Sprintf("%d", userId)).Result()
 		if err != nil {
 			logrus.Warnf("HDel getRoomUserKey err : %s", err)
 		}
+		if removed == 0 {
+			return
+		}
 	}
+	// room user count -- 更新在线人数
+	if roomId > 0 {
+		count, _ := RedisSessClient.Get(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", roomId))).Int()
+		if count > 0 {
+			RedisClient.Decr(logic.getRoomOnlineCountKey(fmt.Sprintf("%d", roomId))).Result()
+		}
+	}
+}
+
+// 把最新的房间名单推给房间里的人，返回名单
+func publishRoomRoster(roomId int) (roomUserInfo map[string]string, err error) {
+	logic := new(Logic)
+	roomUserKey := logic.getRoomUserKey(strconv.Itoa(roomId))
 	//below code can optimize send a signal to queue,another process get a signal from queue,then push event to websocket
 	// 下方代码可优化为：发送信号到队列，再由另一个进程从队列获取信号并推送事件到WebSocket
 	// 但是我看来这其实就已经推送到队列中，这个logic层的逻辑从来不自己处理逻辑，都是推送到队列中
-	roomUserInfo, err := RedisClient.HGetAll(roomUserKey).Result()
+	roomUserInfo, err = RedisClient.HGetAll(roomUserKey).Result()
 	if err != nil {
 		logrus.Warnf("RedisCli HGetAll roomUserInfo key:%s, err: %s", roomUserKey, err)
 	}
 
 	// 推队列
-	//if err = logic.RedisPublishRoomInfo(args.RoomId, len(roomUserInfo), roomUserInfo, nil); err != nil {
+	//if err = logic.RedisPublishRoomInfo(roomId, len(roomUserInfo), roomUserInfo, nil); err != nil {
 	//	logrus.Warnf("publish RedisPublishRoomCount err: %s", err.Error())
 	//	return
 	//}
-	if err = logic.KafkaPublishRoomInfo(args.RoomId, len(roomUserInfo), roomUserInfo, nil); err != nil {
-		logrus.Warnf("publish RedisPublishRoomCount err: %s", err.Error())
+	if err = logic.KafkaPushRoomInfo(roomId, len(roomUserInfo), roomUserInfo); err != nil {
+		logrus.Warnf("publish KafkaPushRoomInfo err: %s", err.Error())
+		return
+	}
+	return
+}
+
+// 加入房间
+func (rpc *RpcLogic) Connect(ctx context.Context, args *proto.ConnectRequest, reply *proto.ConnectReply) (err error) {
+	if args == nil {
+		logrus.Errorf("logic,connect args empty")
+		return
+	}
+
+	// 验证会话
+	userId, userName, seat, code, err := checkJoinRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	reply.Code = code
+	reply.UserId = userId
+	reply.UserName = userName
+	if reply.UserId != 0 {
+		seat, full := takeRoomSeat(userId, userName, args.RoomId, args.ServerId, seat)
+		if full {
+			logrus.Infof("logic connect room full,userId:%d,roomId:%d", userId, args.RoomId)
+			reply.Code = config.RoomFullCode
+			reply.UserId = 0
+			reply.UserName = ""
+			return
+		}
+		reply.Seat = seat
+	}
+	logrus.Infof("logic rpc userId:%d", reply.UserId)
+	return
+}
+
+// 连接已经入桶，之后的消息能直接推到了，这时候才把之前攒下的取走交给 connect 补发
+func (rpc *RpcLogic) TakeOffline(ctx context.Context, args *proto.TakeOfflineRequest, reply *proto.TakeOfflineReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.UserId <= 0 {
+		return errors.New("userId empty")
+	}
+	reply.Offline = takeOffline(args.UserId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 离开房间
+func (rpc *RpcLogic) DisConnect(ctx context.Context, args *proto.DisConnectRequest, reply *proto.DisConnectReply) (err error) {
+	// 最后一个连接断了，之后的消息进离线收件箱
+	if args.Offline && args.UserId > 0 {
+		clearUserServer(args.UserId, args.ServerId)
+	}
+	if args.RoomId <= 0 {
 		return
 	}
+	leaveRoomRoster(args.UserId, args.RoomId)
+	_, err = publishRoomRoster(args.RoomId)
+	return
+}
+
+// 已建连的连接再进一个房间，和 Connect 一样检查，成功以后把房间当前状态带回去
+func (rpc *RpcLogic) JoinRoom(ctx context.Context, args *proto.JoinRoomRequest, reply *proto.JoinRoomReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, userName, seat, code, err := checkJoinRoom(args.AuthToken, args.RoomId)
+	if err != nil {
+		return err
+	}
+	if code != config.SuccessReplyCode {
+		reply.Code = code
+		return nil
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	seat, full := takeRoomSeat(userId, userName, args.RoomId, args.ServerId, seat)
+	if full {
+		reply.Code = config.RoomFullCode
+		return nil
+	}
+	var roomUserInfo map[string]string
+	if seat.Spectator {
+		// 观众不进名单，名单没变就不用推
+		logic := new(Logic)
+		roomUserInfo, _ = RedisClient.HGetAll(logic.getRoomUserKey(strconv.Itoa(args.RoomId))).Result()
+	} else {
+		roomUserInfo, _ = publishRoomRoster(args.RoomId)
+	}
+	r := new(dao.Room)
+	reply.UserId = userId
+	reply.Room = proto.RoomState{
+		RoomId:       args.RoomId,
+		Name:         r.GetById(args.RoomId).Name,
+		OnlineCount:  len(roomUserInfo),
+		RoomUserInfo: roomUserInfo,
+		RoomMeta:     roomMeta(args.RoomId),
+		RoomSeat:     seat,
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 连接不断，只离开一个房间
+func (rpc *RpcLogic) LeaveRoom(ctx context.Context, args *proto.DisConnectRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	if args.UserId <= 0 || args.RoomId <= 0 {
+		return errors.New("userId or roomId empty")
+	}
+	leaveRoomRoster(args.UserId, args.RoomId)
+	if _, err = publishRoomRoster(args.RoomId); err != nil {
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
 	return
 }
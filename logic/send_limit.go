@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strconv"
+	"time"
+)
+
+// 发言限流：房间的慢速模式 + 每个用户全局的令牌桶，状态都在 redis 里，多个 logic 实例共用
+
+// 令牌桶：tokens 和上次补充的时间（毫秒）存在一个 hash 里，脚本里算完再写回，保证原子
+// 返回 0 表示拿到令牌，否则返回还要等多少毫秒
+var sendBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+local ts = tonumber(redis.call('HGET', KEYS[1], 'ts'))
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	local refill = math.floor((now - ts) / interval)
+	if refill > 0 then
+		tokens = math.min(burst, tokens + refill)
+		ts = ts + refill * interval
+	end
+end
+if tokens >= burst then
+	ts = now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = ts + interval - now
+end
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], burst * interval + interval)
+return wait
+`)
+
+// 全局令牌桶，返回还要等多久，0 表示可以发
+func sendBucketRetryAfter(userId int) time.Duration {
+	conf := config.Conf.Logic.LogicSend
+	if conf.RatePerMinute <= 0 {
+		return 0
+	}
+	burst := conf.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	interval := int64(time.Minute/time.Millisecond) / int64(conf.RatePerMinute)
+	if interval <= 0 {
+		interval = 1
+	}
+	logic := new(Logic)
+	key := logic.getSendBucketKey(strconv.Itoa(userId))
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	wait, err := sendBucketScript.Run(RedisClient, []string{key}, burst, interval, now).Int64()
+	if err != nil {
+		// redis 出问题不拦发言
+		logrus.Warnf("send bucket script err:%s", err.Error())
+		return 0
+	}
+	return time.Duration(wait) * time.Millisecond
+}
+
+// 慢速模式：每个用户 N 秒内只能发一条，SET NX 抢到了才能发，没抢到就看还剩多久
+func slowModeRetryAfter(userId int, roomId int, seconds int) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	logic := new(Logic)
+	key := logic.getRoomSlowKey(strconv.Itoa(roomId), strconv.Itoa(userId))
+	ok, err := RedisClient.SetNX(key, 1, time.Duration(seconds)*time.Second).Result()
+	if err != nil {
+		logrus.Warnf("slow mode setnx err:%s", err.Error())
+		return 0
+	}
+	if ok {
+		return 0
+	}
+	ttl, err := RedisClient.TTL(key).Result()
+	if err != nil || ttl <= 0 {
+		return time.Second
+	}
+	return ttl
+}
+
+// 先看慢速模式再扣令牌，被慢速模式挡住的不扣令牌；moderator 以上不受慢速模式限制
+// 房间和权限由 PushRoom 查好传进来
+func sendRetryAfter(userId int, room dao.Room, perms proto.RoomPermissions) time.Duration {
+	roomId := room.Id
+	slowMode := room.SlowMode
+	if slowMode > 0 && perms.CanModerate {
+		slowMode = 0
+	}
+	if retryAfter := slowModeRetryAfter(userId, roomId, slowMode); retryAfter > 0 {
+		return retryAfter
+	}
+	retryAfter := sendBucketRetryAfter(userId)
+	if retryAfter > 0 && slowMode > 0 {
+		// 这条没发出去，慢速模式的计时也撤掉
+		logic := new(Logic)
+		RedisClient.Del(logic.getRoomSlowKey(strconv.Itoa(roomId), strconv.Itoa(userId)))
+	}
+	return retryAfter
+}
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"strconv"
+	"time"
+)
+
+// 会话过期以后 key 再多留一段时间，这段时间内来的请求能拿到明确的会话过期码，而不是笼统的会话错误
+const sessionExpiredNotice = 24 * time.Hour
+
+func sessionIdleTimeout() time.Duration {
+	if idle := config.Conf.Logic.LogicSession.IdleTimeout; idle > 0 {
+		return time.Duration(idle) * time.Second
+	}
+	return 86400 * time.Second
+}
+
+func sessionAbsoluteTimeout() time.Duration {
+	if absolute := config.Conf.Logic.LogicSession.AbsoluteTimeout; absolute > 0 {
+		return time.Duration(absolute) * time.Second
+	}
+	return 7 * 86400 * time.Second
+}
+
+// 登录设备信息，跟着会话一起存进 sess_token
+type sessionMeta struct {
+	DeviceName string
+	UserAgent  string
+	ClientIp   string
+}
+
+// 新建一个会话，sess_token 存用户和设备信息，sess_set_uid 记录这个用户所有的 token
+// 多端登录互不影响，不再踢掉之前的会话
+func createSession(userId int, userName string, meta sessionMeta) (authToken string, err error) {
+	authToken = tools.GetRandomToken(32)
+	sessionName := tools.CreateSessionId(authToken)
+	sessionSetKey := tools.GetSessionSetByUserId(userId)
+	now := time.Now().Unix()
+	userData := make(map[string]interface{})
+	userData["userId"] = userId
+	userData["userName"] = userName
+	userData["deviceName"] = meta.DeviceName
+	userData["userAgent"] = meta.UserAgent
+	userData["ip"] = meta.ClientIp
+	userData["createTime"] = now
+	userData["lastSeen"] = now
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(sessionName, userData)
+		pipe.Expire(sessionName, sessionIdleTimeout()+sessionExpiredNotice)
+		pipe.SAdd(sessionSetKey, authToken)
+		pipe.Expire(sessionSetKey, sessionAbsoluteTimeout()+sessionExpiredNotice)
+		return nil
+	})
+	return
+}
+
+// 删掉一个会话，会话集合空了才把用户-服务器映射一起删掉
+func deleteSession(userId int, authToken string) (err error) {
+	return removeSession(userId, authToken, false)
+}
+
+// 会话超时：sess_token 标上 expired 留到自己的 ttl 过完，这段时间内来的请求还能拿到过期码；
+// 从会话集合里摘掉，集合空了一样清掉用户-服务器映射
+func expireSession(userId int, authToken string) (err error) {
+	return removeSession(userId, authToken, true)
+}
+
+func removeSession(userId int, authToken string, keepExpired bool) (err error) {
+	sessionSetKey := tools.GetSessionSetByUserId(userId)
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		if keepExpired {
+			pipe.HSet(tools.GetSessionName(authToken), "expired", 1)
+		} else {
+			pipe.Del(tools.GetSessionName(authToken))
+		}
+		pipe.SRem(sessionSetKey, authToken)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if RedisSessClient.SCard(sessionSetKey).Val() == 0 {
+		logic := new(Logic)
+		err = RedisSessClient.Del(sessionSetKey, logic.getUserKey(fmt.Sprintf("%d", userId))).Err()
+	}
+	return
+}
+
+// 通过token拿到会话，会话不存在返回空map
+func getSession(authToken string) (userId int, userDataMap map[string]string, err error) {
+	if authToken == "" {
+		return 0, nil, errors.New("authToken empty")
+	}
+	userDataMap, err = RedisSessClient.HGetAll(tools.GetSessionName(authToken)).Result()
+	if err != nil {
+		return
+	}
+	userId, _ = strconv.Atoi(userDataMap["userId"])
+	return
+}
+
+// 有活动就续期：空闲超时从现在重新算，但不能超过登录时定下的最长有效期
+// 已经超时的会话标成过期、不再续期，返回 expired 让调用方给客户端明确的过期码
+func touchSession(userId int, authToken string, userDataMap map[string]string) (expired bool) {
+	if userDataMap["expired"] == "1" {
+		return true
+	}
+	now := time.Now()
+	idle := sessionIdleTimeout()
+	remaining := sessionAbsoluteTimeout()
+	if createTime, _ := strconv.ParseInt(userDataMap["createTime"], 10, 64); createTime > 0 {
+		remaining -= now.Sub(time.Unix(createTime, 0))
+	}
+	lastSeen, _ := strconv.ParseInt(userDataMap["lastSeen"], 10, 64)
+	if remaining <= 0 || (lastSeen > 0 && now.Sub(time.Unix(lastSeen, 0)) >= idle) {
+		if err := expireSession(userId, authToken); err != nil {
+			logrus.Warnf("expire session err:%s", err.Error())
+		}
+		return true
+	}
+	ttl := idle
+	if remaining < ttl {
+		ttl = remaining
+	}
+	sessionName := tools.GetSessionName(authToken)
+	_, err := RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(sessionName, "lastSeen", now.Unix())
+		pipe.Expire(sessionName, ttl+sessionExpiredNotice)
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("touch session err:%s", err.Error())
+	}
+	return false
+}
+
+// 列出这个用户名下还活着的会话，过期的顺手从集合里清掉
+func listSessions(userId int) (tokens []string, sessions []map[string]string) {
+	sessionSetKey := tools.GetSessionSetByUserId(userId)
+	members, err := RedisSessClient.SMembers(sessionSetKey).Result()
+	if err != nil {
+		logrus.Warnf("list session members err:%s", err.Error())
+		return
+	}
+	for _, token := range members {
+		data, err := RedisSessClient.HGetAll(tools.GetSessionName(token)).Result()
+		if err != nil {
+			logrus.Warnf("list session HGetAll err:%s", err.Error())
+			continue
+		}
+		if len(data) == 0 || data["expired"] == "1" {
+			RedisSessClient.SRem(sessionSetKey, token)
+			continue
+		}
+		tokens = append(tokens, token)
+		sessions = append(sessions, data)
+	}
+	return
+}
+
+func formatUnixTime(unix string) string {
+	sec, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || sec <= 0 {
+		return ""
+	}
+	return time.Unix(sec, 0).Format("2006-01-02 15:04:05")
+}
+
+func toSessionInfo(token string, data map[string]string, currentToken string) proto.SessionInfo {
+	return proto.SessionInfo{
+		SessionId:  tools.GetSessionPublicId(token),
+		DeviceName: data["deviceName"],
+		UserAgent:  data["userAgent"],
+		Ip:         data["ip"],
+		CreateTime: formatUnixTime(data["createTime"]),
+		LastSeen:   formatUnixTime(data["lastSeen"]),
+		Current:    token == currentToken,
+	}
+}
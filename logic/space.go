@@ -0,0 +1,314 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/proto"
+	"gochat/logic/dao"
+	"strconv"
+)
+
+// 空间：把一组房间和一批成员归在一起，多个团队共用一套 gochat 时互相隔离。
+// 空间成员能进空间里的公开房间，不是成员的看不到也进不去；空间的 owner/admin 管空间里所有房间
+
+var errSpaceNotFound = errors.New("space not found")
+
+var spaceRoleRank = map[string]int{
+	config.SpaceRoleMember: 1,
+	config.SpaceRoleAdmin:  2,
+	config.SpaceRoleOwner:  3,
+}
+
+// 用户在空间里的角色，不是成员返回空字符串
+func userSpaceRole(userId int, spaceId int) string {
+	m := new(dao.SpaceMember)
+	return m.GetRole(spaceId, userId)
+}
+
+func toSpaceInfo(space dao.Space, role string, memberCount int) proto.SpaceInfo {
+	return proto.SpaceInfo{
+		SpaceId:     space.Id,
+		Name:        space.Name,
+		Description: space.Description,
+		OwnerId:     space.OwnerId,
+		Private:     space.Private,
+		Role:        role,
+		MemberCount: memberCount,
+		CreateTime:  space.CreateTime.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 验证会话、空间存在，并且操作的人在空间里至少是 minRole；全局管理员按 owner 算
+func checkSpaceActor(authToken string, spaceId int, minRole string) (userId int, space dao.Space, role string, err error) {
+	userId, _, _, err = authUser(authToken)
+	if err != nil {
+		return
+	}
+	if userId == 0 {
+		err = errors.New("no this user session")
+		return
+	}
+	s := new(dao.Space)
+	space = s.GetById(spaceId)
+	if space.Id == 0 {
+		err = errSpaceNotFound
+		return
+	}
+	role = userSpaceRole(userId, spaceId)
+	u := new(dao.User)
+	if u.GetUserById(userId).Role == config.RoleAdmin {
+		role = config.SpaceRoleOwner
+	}
+	// 私有空间对外当作不存在
+	if role == "" && space.Private {
+		err = errSpaceNotFound
+		return
+	}
+	if spaceRoleRank[role] < spaceRoleRank[minRole] {
+		err = errors.Errorf("no permission in space %d", spaceId)
+	}
+	return
+}
+
+// 把用户从空间里所有在线的房间踢出去，退出或被移出空间时用
+func kickFromSpaceRooms(userId int, spaceId int) {
+	r := new(dao.Room)
+	logic := new(Logic)
+	for _, room := range r.ListBySpaceId(spaceId) {
+		roomUserKey := logic.getRoomUserKey(strconv.Itoa(room.Id))
+		if !RedisClient.HExists(roomUserKey, fmt.Sprintf("%d", userId)).Val() && !isRoomSpectator(userId, room.Id) {
+			continue
+		}
+		kickFromRoom(userId, room.Id, "removed from space", false)
+	}
+}
+
+func (rpc *RpcLogic) CreateSpace(ctx context.Context, args *proto.CreateSpaceRequest, reply *proto.SpaceInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	name, description, err := validateRoomName(args.Name, args.Description)
+	if err != nil {
+		return err
+	}
+	space := &dao.Space{Name: name, Description: description, OwnerId: userId, Private: args.Private}
+	if _, err = space.AddWithOwner(); err != nil {
+		logrus.Errorf("create space err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("space created,spaceId:%d,owner:%d", space.Id, userId)
+	reply.Space = toSpaceInfo(*space, config.SpaceRoleOwner, 1)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 公开空间谁都能看，私有空间只有成员能看
+func (rpc *RpcLogic) GetSpace(ctx context.Context, args *proto.SpaceRequest, reply *proto.SpaceInfoResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, "")
+	if err != nil {
+		return err
+	}
+	m := new(dao.SpaceMember)
+	reply.Space = toSpaceInfo(space, userSpaceRole(userId, space.Id), m.CountBySpaceIds([]int{space.Id})[space.Id])
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 公开空间和自己加入的空间
+func (rpc *RpcLogic) ListSpaces(ctx context.Context, args *proto.SpaceRequest, reply *proto.ListSpacesResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	m := new(dao.SpaceMember)
+	s := new(dao.Space)
+	list := s.ListVisible(m.ListSpaceIdsByUserId(userId))
+	spaceIds := make([]int, 0, len(list))
+	for _, space := range list {
+		spaceIds = append(spaceIds, space.Id)
+	}
+	counts := m.CountBySpaceIds(spaceIds)
+	reply.Spaces = make([]proto.SpaceInfo, 0, len(list))
+	for _, space := range list {
+		reply.Spaces = append(reply.Spaces, toSpaceInfo(space, userSpaceRole(userId, space.Id), counts[space.Id]))
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 公开空间自己加入，私有空间要空间管理员拉
+func (rpc *RpcLogic) JoinSpace(ctx context.Context, args *proto.SpaceRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, "")
+	if err != nil {
+		return err
+	}
+	if space.Private {
+		return errors.New("space is private, ask a space admin to add you")
+	}
+	m := new(dao.SpaceMember)
+	if err = m.AddMember(space.Id, userId); err != nil {
+		logrus.Errorf("join space err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("space joined,spaceId:%d,userId:%d", space.Id, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 退出空间，顺带退出空间里的房间；owner 不能退
+func (rpc *RpcLogic) LeaveSpace(ctx context.Context, args *proto.SpaceRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, "")
+	if err != nil {
+		return err
+	}
+	role := userSpaceRole(userId, space.Id)
+	if role == "" {
+		return errors.New("not a member of this space")
+	}
+	if role == config.SpaceRoleOwner {
+		return errors.New("space owner can not leave")
+	}
+	m := new(dao.SpaceMember)
+	if err = m.RemoveMember(space.Id, userId); err != nil {
+		logrus.Errorf("leave space err:%s", err.Error())
+		return err
+	}
+	kickFromSpaceRooms(userId, space.Id)
+	logrus.Infof("space left,spaceId:%d,userId:%d", space.Id, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 拉人进空间，admin 以上
+func (rpc *RpcLogic) AddSpaceMember(ctx context.Context, args *proto.SpaceMemberRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, config.SpaceRoleAdmin)
+	if err != nil {
+		return err
+	}
+	u := new(dao.User)
+	if u.GetUserById(args.UserId).Id == 0 {
+		return errors.New("no this user")
+	}
+	m := new(dao.SpaceMember)
+	if err = m.AddMember(space.Id, args.UserId); err != nil {
+		logrus.Errorf("add space member err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("space member added,spaceId:%d,userId:%d,by:%d", space.Id, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 移出空间，admin 以上能移出比自己角色低的人，移出以后空间里的房间都进不去了
+func (rpc *RpcLogic) RemoveSpaceMember(ctx context.Context, args *proto.SpaceMemberRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, role, err := checkSpaceActor(args.AuthToken, args.SpaceId, config.SpaceRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if args.UserId == userId {
+		return errors.New("use leave to leave the space")
+	}
+	targetRole := userSpaceRole(args.UserId, space.Id)
+	if targetRole == "" {
+		return errors.New("not a member of this space")
+	}
+	if spaceRoleRank[targetRole] >= spaceRoleRank[role] {
+		return errors.New("no permission to remove this member")
+	}
+	m := new(dao.SpaceMember)
+	if err = m.RemoveMember(space.Id, args.UserId); err != nil {
+		logrus.Errorf("remove space member err:%s", err.Error())
+		return err
+	}
+	kickFromSpaceRooms(args.UserId, space.Id)
+	logrus.Infof("space member removed,spaceId:%d,userId:%d,by:%d", space.Id, args.UserId, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 设空间角色，只有 owner 能设，只能在 admin 和 member 之间切换
+func (rpc *RpcLogic) SetSpaceRole(ctx context.Context, args *proto.SpaceMemberRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, config.SpaceRoleOwner)
+	if err != nil {
+		return err
+	}
+	if args.Role != config.SpaceRoleAdmin && args.Role != config.SpaceRoleMember {
+		return errors.Errorf("unknown space role: %s", args.Role)
+	}
+	targetRole := userSpaceRole(args.UserId, space.Id)
+	if targetRole == "" {
+		return errors.New("not a member of this space")
+	}
+	if targetRole == config.SpaceRoleOwner {
+		return errors.New("can not change the space owner role")
+	}
+	m := new(dao.SpaceMember)
+	if err = m.SetRole(space.Id, args.UserId, args.Role); err != nil {
+		logrus.Errorf("set space role err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("space role changed,spaceId:%d,userId:%d,role:%s,by:%d", space.Id, args.UserId, args.Role, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 公开空间谁都能看成员，私有空间只有成员能看
+func (rpc *RpcLogic) ListSpaceMembers(ctx context.Context, args *proto.SpaceRequest, reply *proto.ListSpaceMembersResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	_, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, "")
+	if err != nil {
+		return err
+	}
+	m := new(dao.SpaceMember)
+	list := m.ListBySpaceId(space.Id)
+	u := new(dao.User)
+	reply.Members = make([]proto.RoomMemberInfo, 0, len(list))
+	for _, item := range list {
+		reply.Members = append(reply.Members, proto.RoomMemberInfo{
+			UserId:     item.UserId,
+			UserName:   u.GetUserNameByUserId(item.UserId),
+			Role:       item.Role,
+			CreateTime: item.CreateTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 删空间，只有 owner 能删；里面还有房间的要先把房间删掉
+func (rpc *RpcLogic) DeleteSpace(ctx context.Context, args *proto.SpaceRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, space, _, err := checkSpaceActor(args.AuthToken, args.SpaceId, config.SpaceRoleOwner)
+	if err != nil {
+		return err
+	}
+	r := new(dao.Room)
+	if r.CountBySpaceId(space.Id) > 0 {
+		return errors.New("space still has rooms, delete them first")
+	}
+	if err = space.Delete(space.Id); err != nil {
+		logrus.Errorf("delete space err:%s", err.Error())
+		return err
+	}
+	logrus.Infof("space deleted,spaceId:%d,by:%d", space.Id, userId)
+	reply.Code = config.SuccessReplyCode
+	return
+}
@@ -0,0 +1,198 @@
+package logic
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/pkg/authtoken"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"strconv"
+	"time"
+)
+
+// 签名 token 模式：access token 短期有效，api/connect 本地验签；refresh token 存 redis，每次刷新都换新的
+
+func accessTokenTtl() time.Duration {
+	if ttl := config.Conf.Api.ApiAuth.AccessTokenTtl; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 15 * time.Minute
+}
+
+func refreshTokenTtl() time.Duration {
+	if ttl := config.Conf.Api.ApiAuth.RefreshTokenTtl; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 30 * 24 * time.Hour
+}
+
+// 签一对新的 access token + refresh token
+func issueTokens(userId int, userName string, meta sessionMeta) (accessToken string, refreshToken string, expiresIn int, err error) {
+	now := time.Now()
+	ttl := accessTokenTtl()
+	claims := authtoken.Claims{
+		UserId:   userId,
+		UserName: userName,
+		TokenId:  tools.GetRandomToken(16),
+		IssuedAt: now.Unix(),
+		ExpireAt: now.Add(ttl).Unix(),
+	}
+	accessToken, err = authtoken.Sign(claims, []byte(config.Conf.Api.ApiAuth.TokenSecret))
+	if err != nil {
+		return
+	}
+	refreshToken = tools.GetRandomToken(32)
+	refreshKey := tools.GetRefreshTokenKey(refreshToken)
+	refreshSetKey := tools.GetRefreshTokenSetKey(userId)
+	refreshData := make(map[string]interface{})
+	refreshData["userId"] = userId
+	refreshData["userName"] = userName
+	refreshData["accessTokenId"] = claims.TokenId
+	refreshData["accessExpireAt"] = claims.ExpireAt
+	refreshData["deviceName"] = meta.DeviceName
+	refreshData["userAgent"] = meta.UserAgent
+	refreshData["ip"] = meta.ClientIp
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(refreshKey, refreshData)
+		pipe.Expire(refreshKey, refreshTokenTtl())
+		pipe.SAdd(refreshSetKey, refreshToken)
+		pipe.Expire(refreshSetKey, refreshTokenTtl())
+		return nil
+	})
+	expiresIn = int(ttl / time.Second)
+	return
+}
+
+// access token 进黑名单，过期以后黑名单自己消失
+func denyAccessToken(tokenId string, expireAt int64) error {
+	ttl := time.Until(time.Unix(expireAt, 0))
+	if tokenId == "" || ttl <= 0 {
+		return nil
+	}
+	return RedisSessClient.Set(tools.GetTokenDenyKey(tokenId), 1, ttl).Err()
+}
+
+// 吊销一个 refresh token，连同它签出去的 access token 一起拉黑
+func revokeRefreshToken(userId int, refreshToken string) (err error) {
+	refreshKey := tools.GetRefreshTokenKey(refreshToken)
+	data, err := RedisSessClient.HGetAll(refreshKey).Result()
+	if err != nil {
+		return
+	}
+	if len(data) > 0 {
+		expireAt, _ := strconv.ParseInt(data["accessExpireAt"], 10, 64)
+		if err = denyAccessToken(data["accessTokenId"], expireAt); err != nil {
+			return
+		}
+	}
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(refreshKey)
+		pipe.SRem(tools.GetRefreshTokenSetKey(userId), refreshToken)
+		return nil
+	})
+	return
+}
+
+// 两种认证模式的统一入口，userId 为0表示认证失败，expired 表示会话/token 已过期
+// redis 会话模式下顺便续期
+func authUser(authToken string) (userId int, userName string, expired bool, err error) {
+	if config.Conf.Api.ApiAuth.IsTokenMode() {
+		claims, err := tools.VerifyAccessToken(authToken)
+		if err == authtoken.ErrTokenExpired {
+			return 0, "", true, nil
+		}
+		if err != nil {
+			logrus.Infof("verify access token fail:%s", err.Error())
+			return 0, "", false, nil
+		}
+		return claims.UserId, claims.UserName, false, nil
+	}
+	userId, userDataMap, err := getSession(authToken)
+	if err != nil || userId == 0 {
+		return 0, "", false, err
+	}
+	if touchSession(userId, authToken, userDataMap) {
+		return 0, "", true, nil
+	}
+	return userId, userDataMap["userName"], false, nil
+}
+
+// 签名 token 模式登出：拉黑当前 access token，并吊销它对应的 refresh token
+func logoutAccessToken(authToken string) (err error) {
+	claims, err := authtoken.Parse(authToken, []byte(config.Conf.Api.ApiAuth.TokenSecret))
+	if err != nil && err != authtoken.ErrTokenExpired {
+		return err
+	}
+	if err = denyAccessToken(claims.TokenId, claims.ExpireAt); err != nil {
+		return err
+	}
+	refreshTokens, err := RedisSessClient.SMembers(tools.GetRefreshTokenSetKey(claims.UserId)).Result()
+	if err != nil {
+		return err
+	}
+	for _, refreshToken := range refreshTokens {
+		tokenId, _ := RedisSessClient.HGet(tools.GetRefreshTokenKey(refreshToken), "accessTokenId").Result()
+		if tokenId != claims.TokenId {
+			continue
+		}
+		return revokeRefreshToken(claims.UserId, refreshToken)
+	}
+	return nil
+}
+
+// 用 refresh token 换一对新的 token，旧的 refresh token 立刻作废，旧的 access token 拉黑
+func (rpc *RpcLogic) RefreshToken(ctx context.Context, args *proto.RefreshTokenRequest, reply *proto.RefreshTokenResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	if !config.Conf.Api.ApiAuth.IsTokenMode() {
+		return errors.New("refresh token only support in token auth mode")
+	}
+	refreshKey := tools.GetRefreshTokenKey(args.RefreshToken)
+	data, err := RedisSessClient.HGetAll(refreshKey).Result()
+	if err != nil {
+		logrus.Infof("refresh token HGetAll err:%s", err.Error())
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("refresh token invalid or expired")
+	}
+	// 并发用同一个 refresh token 刷新，只有删成功的那个能拿到新 token
+	deleted, err := RedisSessClient.Del(refreshKey).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.New("refresh token already used")
+	}
+	userId, _ := strconv.Atoi(data["userId"])
+	RedisSessClient.SRem(tools.GetRefreshTokenSetKey(userId), args.RefreshToken)
+	// 这个 refresh token 签出去的 access token，以及客户端带来的当前 access token（同一个用户的）都拉黑
+	accessExpireAt, _ := strconv.ParseInt(data["accessExpireAt"], 10, 64)
+	if err = denyAccessToken(data["accessTokenId"], accessExpireAt); err != nil {
+		logrus.Warnf("refresh token deny access token err:%s", err.Error())
+	}
+	if args.AuthToken != "" {
+		claims, err := authtoken.Parse(args.AuthToken, []byte(config.Conf.Api.ApiAuth.TokenSecret))
+		if (err == nil || err == authtoken.ErrTokenExpired) && claims.UserId == userId && claims.TokenId != data["accessTokenId"] {
+			if err = denyAccessToken(claims.TokenId, claims.ExpireAt); err != nil {
+				logrus.Warnf("refresh token deny current access token err:%s", err.Error())
+			}
+		}
+	}
+	accessToken, refreshToken, expiresIn, err := issueTokens(userId, data["userName"], sessionMeta{
+		DeviceName: data["deviceName"],
+		UserAgent:  data["userAgent"],
+		ClientIp:   data["ip"],
+	})
+	if err != nil {
+		logrus.Infof("refresh token issue fail:%s", err.Error())
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	reply.AuthToken = accessToken
+	reply.RefreshToken = refreshToken
+	reply.ExpiresIn = expiresIn
+	return
+}
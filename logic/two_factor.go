@@ -0,0 +1,288 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gochat/config"
+	"gochat/internal/pkg/totp"
+	"gochat/internal/proto"
+	"gochat/internal/tools"
+	"gochat/logic/dao"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 两步验证：绑定 -> 确认(拿恢复码) -> 登录时密码通过后再校验动态码
+
+const (
+	totpSetupTtl          = 10 * time.Minute
+	recoveryCodeCount     = 10
+	loginChallengeAttempt = 5 // 一个登录挑战最多试几次动态码
+)
+
+func totpIssuer() string {
+	if issuer := config.Conf.Logic.LogicAuth.TotpIssuer; issuer != "" {
+		return issuer
+	}
+	return "gochat"
+}
+
+func totpSkew() int {
+	if skew := config.Conf.Logic.LogicAuth.TotpSkew; skew > 0 {
+		return skew
+	}
+	return 1
+}
+
+func loginChallengeTtl() time.Duration {
+	if ttl := config.Conf.Logic.LogicAuth.LoginChallengeTtl; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// 密码通过了但是还要两步验证，先发一个短期的挑战 token，设备信息也先存着
+func createLoginChallenge(userId int, userName string, meta sessionMeta) (challengeToken string, expiresIn int, err error) {
+	logic := new(Logic)
+	challengeToken = tools.GetRandomToken(32)
+	challengeKey := logic.getLogin2faKey(challengeToken)
+	challengeData := make(map[string]interface{})
+	challengeData["userId"] = userId
+	challengeData["userName"] = userName
+	challengeData["deviceName"] = meta.DeviceName
+	challengeData["userAgent"] = meta.UserAgent
+	challengeData["ip"] = meta.ClientIp
+	challengeData["attempts"] = 0
+	_, err = RedisSessClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(challengeKey, challengeData)
+		pipe.Expire(challengeKey, loginChallengeTtl())
+		return nil
+	})
+	expiresIn = int(loginChallengeTtl() / time.Second)
+	return
+}
+
+// 校验动态码或者恢复码；恢复码用一个删一个，动态码同一个步长只能用一次
+func verifySecondFactor(user dao.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if !user.TotpEnabled || user.TotpSecret == "" || code == "" {
+		return false
+	}
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TotpSecret, code, time.Now(), totpSkew())
+		if !ok {
+			return false
+		}
+		logic := new(Logic)
+		usedKey := logic.getTotpUsedKey(strconv.Itoa(user.Id), strconv.FormatUint(step, 10))
+		window := time.Duration(2*totpSkew()+1) * totp.Period * time.Second
+		fresh, err := RedisSessClient.SetNX(usedKey, 1, window).Result()
+		if err != nil {
+			logrus.Warnf("totp mark used err:%s", err.Error())
+			return false
+		}
+		return fresh
+	}
+	return useRecoveryCode(user, code)
+}
+
+func useRecoveryCode(user dao.User, code string) bool {
+	hashed := hashRecoveryCode(code)
+	remain := make([]string, 0, recoveryCodeCount)
+	found := false
+	for _, item := range strings.Split(user.TotpRecovery, ",") {
+		if item == "" {
+			continue
+		}
+		if !found && item == hashed {
+			found = true
+			continue
+		}
+		remain = append(remain, item)
+	}
+	if !found {
+		return false
+	}
+	u := new(dao.User)
+	ok, err := u.UpdateTotpRecovery(user.Id, user.TotpRecovery, strings.Join(remain, ","))
+	if err != nil {
+		logrus.Warnf("use recovery code err:%s", err.Error())
+		return false
+	}
+	if ok {
+		logrus.Infof("user %d used a recovery code, %d left", user.Id, len(remain))
+	}
+	return ok
+}
+
+// 恢复码大小写、横线都不敏感
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// xxxxx-xxxxx 格式的恢复码，明文只返回给用户一次，库里只存哈希
+func generateRecoveryCodes() (codes []string, hashed []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := hex.EncodeToString(b)
+		code := fmt.Sprintf("%s-%s", raw[:5], raw[5:])
+		codes = append(codes, code)
+		hashed = append(hashed, hashRecoveryCode(code))
+	}
+	return
+}
+
+// 登录第二步：挑战 token + 动态码换真正的 AuthToken
+func (rpc *RpcLogic) Login2fa(ctx context.Context, args *proto.Login2faRequest, reply *proto.LoginResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	logic := new(Logic)
+	challengeKey := logic.getLogin2faKey(args.ChallengeToken)
+	challenge, err := RedisSessClient.HGetAll(challengeKey).Result()
+	if err != nil {
+		return err
+	}
+	if len(challenge) == 0 {
+		return errors.New("login challenge expired, please login again")
+	}
+	attempts, err := RedisSessClient.HIncrBy(challengeKey, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	if attempts > loginChallengeAttempt {
+		RedisSessClient.Del(challengeKey)
+		return errors.New("too many two factor attempts, please login again")
+	}
+	// 账号/IP 被锁期间挑战作废，不再给试动态码
+	userName, clientIp := challenge["userName"], challenge["ip"]
+	if retryAfter := loginRetryAfter(userName, clientIp); retryAfter > 0 {
+		RedisSessClient.Del(challengeKey)
+		logrus.Infof("login 2fa throttled,userName:%s,ip:%s,retryAfter:%s", userName, clientIp, retryAfter)
+		reply.RetryAfter = int((retryAfter + time.Second - 1) / time.Second)
+		return
+	}
+	userId, _ := strconv.Atoi(challenge["userId"])
+	u := new(dao.User)
+	user := u.GetUserById(userId)
+	if user.Id == 0 || !verifySecondFactor(user, args.Code) {
+		// 动态码错了和密码错了一样计入登录失败
+		recordLoginFailure(userName, clientIp)
+		return errors.New("two factor code error!")
+	}
+	// 挑战只能用一次，并发提交同一个挑战只放过先删掉的那个
+	if n, err := RedisSessClient.Del(challengeKey).Result(); err != nil || n == 0 {
+		return errors.New("login challenge expired, please login again")
+	}
+	meta := sessionMeta{
+		DeviceName: challenge["deviceName"],
+		UserAgent:  challenge["userAgent"],
+		ClientIp:   challenge["ip"],
+	}
+	reply.AuthToken, reply.RefreshToken, reply.ExpiresIn, err = issueLogin(user.Id, user.UserName, meta)
+	if err != nil {
+		logrus.Infof("login 2fa issue auth token fail:%s", err.Error())
+		return err
+	}
+	resetLoginFailure(userName)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 开始绑定：生成密钥暂存 redis，确认以后才写库
+func (rpc *RpcLogic) Setup2fa(ctx context.Context, args *proto.TwoFactorSetupRequest, reply *proto.TwoFactorSetupResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, userName, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	u := new(dao.User)
+	if u.GetUserById(userId).TotpEnabled {
+		return errors.New("two factor already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	logic := new(Logic)
+	if err = RedisSessClient.Set(logic.getTotpSetupKey(strconv.Itoa(userId)), secret, totpSetupTtl).Err(); err != nil {
+		return err
+	}
+	reply.Secret = secret
+	reply.Uri = totp.URI(totpIssuer(), userName, secret)
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 用 app 上的动态码确认绑定，返回一次性恢复码
+func (rpc *RpcLogic) Confirm2fa(ctx context.Context, args *proto.TwoFactorConfirmRequest, reply *proto.TwoFactorConfirmResponse) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	logic := new(Logic)
+	setupKey := logic.getTotpSetupKey(strconv.Itoa(userId))
+	secret, err := RedisSessClient.Get(setupKey).Result()
+	if err != nil || secret == "" {
+		return errors.New("two factor setup expired, please setup again")
+	}
+	if _, ok := totp.Validate(secret, strings.TrimSpace(args.Code), time.Now(), totpSkew()); !ok {
+		return errors.New("two factor code error!")
+	}
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	u := new(dao.User)
+	if err = u.EnableTotp(userId, secret, strings.Join(hashed, ",")); err != nil {
+		logrus.Errorf("enable totp err:%s", err.Error())
+		return err
+	}
+	RedisSessClient.Del(setupKey)
+	reply.RecoveryCodes = codes
+	reply.Code = config.SuccessReplyCode
+	return
+}
+
+// 关闭两步验证也要动态码或者恢复码，光有会话不够
+func (rpc *RpcLogic) Disable2fa(ctx context.Context, args *proto.TwoFactorDisableRequest, reply *proto.SuccessReply) (err error) {
+	reply.Code = config.FailReplyCode
+	userId, _, _, err := authUser(args.AuthToken)
+	if err != nil {
+		return err
+	}
+	if userId == 0 {
+		return errors.New("no this user session")
+	}
+	u := new(dao.User)
+	user := u.GetUserById(userId)
+	if !user.TotpEnabled {
+		return errors.New("two factor not enabled")
+	}
+	if !verifySecondFactor(user, args.Code) {
+		return errors.New("two factor code error!")
+	}
+	if err = u.DisableTotp(userId); err != nil {
+		logrus.Errorf("disable totp err:%s", err.Error())
+		return err
+	}
+	reply.Code = config.SuccessReplyCode
+	return
+}
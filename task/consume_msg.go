@@ -81,6 +81,14 @@ func (task *Task) Push(msg string) {
 	case config.OpRoomCountSend:
 		task.broadcastRoomCountToConnect(m.RoomId, m.Count)
 	case config.OpRoomInfoSend:
-		task.broadcastRoomInfoToConnect(m.RoomId, m.RoomUserInfo)
+		task.broadcastRoomInfoToConnect(m.RoomId, m.RoomUserInfo, m.RoomUserProfiles, m.RoomMeta)
+	case config.OpRoomMetaSend:
+		task.broadcastRoomMetaToConnect(m.RoomId, m.RoomMeta)
+	case config.OpRoomKick:
+		task.kickUserToConnect(m.ServerId, m.UserId, m.RoomId, m.Msg)
+	case config.OpRoomReadSend:
+		task.broadcastRoomReadToConnect(m.RoomId, m.Msg)
+	case config.OpDeliveredReceipt:
+		task.pushReceiptToConnect(m.ServerId, m.UserId, m.Msg)
 	}
 }
@@ -34,6 +34,7 @@ type wsInnerMsg struct {
 	Op           int    `json:"op"`                    // config.OpRoomSend = 3
 	CreateTime   string `json:"createTime"`            // "YYYY-MM-DD HH:MM:SS"
 	ClientMsgId  int64  `json:"clientMsgId,omitempty"` // 可选；不传我会兜底生成
+	IsBot        bool   `json:"isBot,omitempty"`       // AI 回复按机器人消息展示
 }
 
 // 在 Task 启动时调用一次
@@ -96,6 +97,7 @@ func (t *Task) InitAIResultsConsumer() error {
 				Op:           config.OpRoomSend, // 3
 				CreateTime:   tools.GetNowDateTime(),
 				ClientMsgId:  res.ClientMsgId,
+				IsBot:        true,
 			})
 
 			// 2) 先入库（幂等：主键/雪花ID冲突会 DoNothing）
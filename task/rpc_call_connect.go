@@ -243,6 +243,51 @@ func (task *Task) pushSingleToConnect(serverId string, userId int, msg []byte) {
 	logrus.Infof("reply %s", reply.Msg)
 }
 
+// 踢人，只发给用户所在的 connect
+func (task *Task) kickUserToConnect(serverId string, userId int, roomId int, msg []byte) {
+	kickReq := &proto2.KickUserRequest{
+		UserId: userId,
+		RoomId: roomId,
+		Msg: proto2.Msg{
+			Ver:       config.MsgVersion,
+			Operation: config.OpRoomKick,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      msg,
+		},
+	}
+	reply := &proto2.SuccessReply{}
+	connectRpc, err := RClient.GetRpcClientByServerId(serverId)
+	if err != nil {
+		logrus.Infof("get rpc client err %v", err)
+		return
+	}
+	if err = connectRpc.Call(context.Background(), "KickUser", kickReq, reply); err != nil {
+		logrus.Infof("kickUserToConnect Call err %v", err)
+	}
+}
+
+// 私信送达回执，只发给发信人所在的 connect；不走单聊的推送管道，connect 那边不要求客户端确认
+func (task *Task) pushReceiptToConnect(serverId string, userId int, msg []byte) {
+	pushMsgReq := &proto2.PushMsgRequest{
+		UserId: userId,
+		Msg: proto2.Msg{
+			Ver:       config.MsgVersion,
+			Operation: config.OpDeliveredReceipt,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      msg,
+		},
+	}
+	reply := &proto2.SuccessReply{}
+	connectRpc, err := RClient.GetRpcClientByServerId(serverId)
+	if err != nil {
+		logrus.Infof("get rpc client err %v", err)
+		return
+	}
+	if err = connectRpc.Call(context.Background(), "PushSingleMsg", pushMsgReq, reply); err != nil {
+		logrus.Infof("pushReceiptToConnect Call err %v", err)
+	}
+}
+
 // 广播消息发送，话说RPC注册函数进去给人使用，这一块我还没有哦弄清楚？
 func (task *Task) broadcastRoomToConnect(roomId int, msg []byte) {
 	pushRoomMsgReq := &proto2.PushRoomMsgRequest{
@@ -267,8 +312,9 @@ func (task *Task) broadcastRoomToConnect(roomId int, msg []byte) {
 // 广播房间人数
 func (task *Task) broadcastRoomCountToConnect(roomId, count int) {
 	msg := &proto2.RedisRoomCountMsg{
-		Count: count,
-		Op:    config.OpRoomCountSend,
+		Count:  count,
+		Op:     config.OpRoomCountSend,
+		RoomId: roomId,
 	}
 	var body []byte
 	var err error
@@ -295,12 +341,16 @@ func (task *Task) broadcastRoomCountToConnect(roomId, count int) {
 }
 
 // 广播房间元信息
-func (task *Task) broadcastRoomInfoToConnect(roomId int, roomUserInfo map[string]string) {
+func (task *Task) broadcastRoomInfoToConnect(roomId int, roomUserInfo map[string]string, roomUserProfiles map[string]proto2.RoomUserProfile, roomMeta *proto2.RoomMeta) {
 	msg := &proto2.RedisRoomInfo{
-		Count:        len(roomUserInfo),
-		Op:           config.OpRoomInfoSend,
-		RoomUserInfo: roomUserInfo,
-		RoomId:       roomId,
+		Count:            len(roomUserInfo),
+		Op:               config.OpRoomInfoSend,
+		RoomUserInfo:     roomUserInfo,
+		RoomUserProfiles: roomUserProfiles,
+		RoomId:           roomId,
+	}
+	if roomMeta != nil {
+		msg.RoomMeta = *roomMeta
 	}
 	var body []byte
 	var err error
@@ -325,3 +375,51 @@ func (task *Task) broadcastRoomInfoToConnect(roomId int, roomUserInfo map[string
 		logrus.Infof("broadcastRoomInfoToConnect rpc  reply %v", reply)
 	}
 }
+
+// 房间话题、公告、置顶变了，和房间信息一样广播
+func (task *Task) broadcastRoomMetaToConnect(roomId int, roomMeta *proto2.RoomMeta) {
+	msg := &proto2.RedisRoomMetaMsg{
+		Op:     config.OpRoomMetaSend,
+		RoomId: roomId,
+	}
+	if roomMeta != nil {
+		msg.RoomMeta = *roomMeta
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		logrus.Warnf("broadcastRoomMetaToConnect json.Marshal err :%s", err.Error())
+		return
+	}
+	pushRoomMsgReq := &proto2.PushRoomMsgRequest{
+		RoomId: roomId,
+		Msg: proto2.Msg{
+			Ver:       config.MsgVersion,
+			Operation: config.OpRoomMetaSend,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      body,
+		},
+	}
+	reply := &proto2.SuccessReply{}
+	rpcList := RClient.GetAllConnectTypeRpcClient()
+	for _, rpc := range rpcList {
+		rpc.Call(context.Background(), "PushRoomInfo", pushRoomMsgReq, reply)
+	}
+}
+
+// 已读回执，广播给房间里的人，不存历史
+func (task *Task) broadcastRoomReadToConnect(roomId int, msg []byte) {
+	pushRoomMsgReq := &proto2.PushRoomMsgRequest{
+		RoomId: roomId,
+		Msg: proto2.Msg{
+			Ver:       config.MsgVersion,
+			Operation: config.OpRoomReadSend,
+			SeqId:     tools.GetSnowflakeIdString(),
+			Body:      msg,
+		},
+	}
+	reply := &proto2.SuccessReply{}
+	rpcList := RClient.GetAllConnectTypeRpcClient()
+	for _, rpc := range rpcList {
+		rpc.Call(context.Background(), "PushRoomInfo", pushRoomMsgReq, reply)
+	}
+}